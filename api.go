@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/annbelievable/go_listing/apitoken"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+)
+
+type apiPage struct {
+	Id      uint64 `json:"id"`
+	Url     string `json:"url"`
+	Title   string `json:"title"`
+	Teaser  string `json:"teaser"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+func apiPageFrom(page models.Page) apiPage {
+	return apiPage{
+		Id:      page.Id,
+		Url:     page.Url,
+		Title:   page.Title,
+		Teaser:  page.Teaser,
+		Content: page.Content,
+		Status:  page.Status,
+	}
+}
+
+type apiListing struct {
+	Id          uint64 `json:"id"`
+	ExternalId  string `json:"external_id"`
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Status      string `json:"status"`
+}
+
+func apiListingFrom(listing models.Listing) apiListing {
+	return apiListing{
+		Id:          listing.Id,
+		ExternalId:  listing.ExternalId,
+		Url:         listing.Url,
+		Title:       listing.Title,
+		Description: listing.Description,
+		Category:    listing.Category,
+		Status:      listing.Status,
+	}
+}
+
+// requireScope lets through admins logged in with a session, and API tokens
+// that were granted the scope.
+func requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := r.Context().Value("ApiToken").(models.ApiToken); ok {
+			if !apitoken.HasScope(token, scope) {
+				writeJSONError(w, http.StatusForbidden, "token is missing scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, ok := r.Context().Value("Session").(models.AdminUserSession); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "authentication required")
+	})
+}
+
+func (s *server) ApiPages(w http.ResponseWriter, r *http.Request) {
+	pages, err := s.pages.List(r.Context())
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load pages")
+		return
+	}
+
+	list := make([]apiPage, 0, len(pages))
+	for _, page := range pages {
+		list = append(list, apiPageFrom(page))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) ApiCreatePage(w http.ResponseWriter, r *http.Request) {
+	var body apiPage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	page := models.Page{
+		Url:     body.Url,
+		Title:   body.Title,
+		Teaser:  body.Teaser,
+		Content: body.Content,
+		Status:  body.Status,
+	}
+	if page.Status == "" {
+		page.Status = models.PagePublished
+	}
+
+	errs, err := s.validatePage(r.Context(), page)
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not create page")
+		return
+	}
+	if errs != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": "invalid page", "fields": errs})
+		return
+	}
+
+	id, err := s.pages.Create(r.Context(), page)
+	if errors.Is(err, repository.ErrUniqueViolation) {
+		writeJSONError(w, http.StatusConflict, "a page with this url already exists")
+		return
+	}
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not create page")
+		return
+	}
+
+	page.Id = id
+	body.Id = id
+	body.Status = page.Status
+	s.recordAudit(r, s.currentActor(r), "page.create", "page", idString(id), nil, page)
+
+	writeJSON(w, http.StatusCreated, body)
+}
+
+func (s *server) ApiListings(w http.ResponseWriter, r *http.Request) {
+	listings, err := s.listings.List(r.Context())
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not load listings")
+		return
+	}
+
+	list := make([]apiListing, 0, len(listings))
+	for _, listing := range listings {
+		list = append(list, apiListingFrom(listing))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) ApiCreateListing(w http.ResponseWriter, r *http.Request) {
+	var body apiListing
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	listing := models.Listing{
+		ExternalId:  body.ExternalId,
+		Url:         body.Url,
+		Title:       body.Title,
+		Description: body.Description,
+		Category:    body.Category,
+		Status:      body.Status,
+	}
+	if listing.Status == "" {
+		listing.Status = models.ListingActive
+	}
+
+	errs, err := s.validateListing(r.Context(), listing)
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not create listing")
+		return
+	}
+	if errs != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": "invalid listing", "fields": errs})
+		return
+	}
+
+	id, err := s.listings.Create(r.Context(), listing)
+	if errors.Is(err, repository.ErrUniqueViolation) {
+		writeJSONError(w, http.StatusConflict, "a listing with this url or external id already exists")
+		return
+	}
+	if err != nil {
+		LogError(r, err)
+		writeJSONError(w, http.StatusInternalServerError, "could not create listing")
+		return
+	}
+
+	listing.Id = id
+	body.Id = id
+	body.Status = listing.Status
+	s.recordAudit(r, s.currentActor(r), "listing.create", "listing", idString(id), nil, listing)
+
+	writeJSON(w, http.StatusCreated, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		LogError(nil, err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
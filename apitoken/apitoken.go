@@ -0,0 +1,67 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/annbelievable/go_listing/models"
+)
+
+// Prefix marks personal access tokens so they are easy to spot in logs and
+// secret scanners.
+const Prefix = "glpat_"
+
+const (
+	ScopePagesRead     = "pages:read"
+	ScopePagesWrite    = "pages:write"
+	ScopeListingsRead  = "listings:read"
+	ScopeListingsWrite = "listings:write"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []string{ScopePagesRead, ScopePagesWrite, ScopeListingsRead, ScopeListingsWrite}
+
+// Generate returns a new token and the hash to store for it. The token itself
+// is only shown to the admin once.
+func Generate() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := Prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, Hash(token), nil
+}
+
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidScopes drops anything that is not a known scope.
+func ValidScopes(scopes []string) []string {
+	var valid []string
+	for _, scope := range scopes {
+		for _, known := range Scopes {
+			if scope == known {
+				valid = append(valid, scope)
+				break
+			}
+		}
+	}
+
+	return valid
+}
+
+func HasScope(token models.ApiToken, scope string) bool {
+	for _, s := range strings.Fields(token.Scopes) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+)
+
+type auditActor struct {
+	Id    uint64
+	Email string
+}
+
+// currentActor is the admin behind the request, logged in by session or token.
+func (s *server) currentActor(r *http.Request) auditActor {
+	if token, ok := r.Context().Value("ApiToken").(models.ApiToken); ok {
+		return auditActor{Id: token.AdminUser, Email: token.AdminEmail}
+	}
+
+	if current, ok := r.Context().Value("Session").(models.AdminUserSession); ok {
+		actor := auditActor{Id: current.AdminUser}
+		admin, err := s.admins.Get(r.Context(), current.AdminUser)
+		if err != nil {
+			LogError(r, err)
+		}
+		actor.Email = admin.Email
+		return actor
+	}
+
+	return auditActor{}
+}
+
+// recordAudit stores who did what to which entity, with the values before and
+// after the change. A failed write is logged and does not fail the request.
+func (s *server) recordAudit(r *http.Request, actor auditActor, action, entityType, entityId string, before, after interface{}) {
+	err := s.audit.Insert(r.Context(), newAuditEntry(r, actor, action, entityType, entityId, before, after))
+	if err != nil {
+		LogError(r, err)
+	}
+}
+
+// newAuditEntry fills in an entry from the request, for changes that are
+// recorded after the request has been answered.
+func newAuditEntry(r *http.Request, actor auditActor, action, entityType, entityId string, before, after interface{}) models.AuditLog {
+	entry := models.AuditLog{
+		ActorEmail: actor.Email,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Before:     auditValue(before),
+		After:      auditValue(after),
+		IpAddress:  GetIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+	if actor.Id != 0 {
+		entry.ActorId = sql.NullInt64{Int64: int64(actor.Id), Valid: true}
+	}
+	// the columns are bounded and the values come from the client, a value
+	// that does not fit must not keep the entry out of the log
+	if len(entry.ActorEmail) > 255 {
+		entry.ActorEmail = entry.ActorEmail[:255]
+	}
+	if len(entry.IpAddress) > 64 {
+		entry.IpAddress = entry.IpAddress[:64]
+	}
+	if len(entry.UserAgent) > 255 {
+		entry.UserAgent = entry.UserAgent[:255]
+	}
+
+	return entry
+}
+
+func auditValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		LogError(nil, err)
+		return ""
+	}
+
+	return string(b)
+}
+
+func auditFilter(r *http.Request) repository.AuditFilter {
+	q := r.URL.Query()
+	filter := repository.AuditFilter{
+		Actor:      q.Get("actor"),
+		EntityType: q.Get("entity"),
+	}
+
+	if from, err := time.Parse("2006-01-02", q.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse("2006-01-02", q.Get("to")); err == nil {
+		// include the whole "to" day
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
+
+type auditData struct {
+	Actor       string
+	Entity      string
+	From        string
+	To          string
+	EntityTypes []string
+	Entries     []models.AuditLog
+	ExportURL   string
+}
+
+func (s *server) AuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("Session").(models.AdminUserSession); !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	filter := auditFilter(r)
+	filter.Limit = 500
+
+	entries, err := s.audit.List(r.Context(), filter)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	entityTypes, err := s.audit.EntityTypes(r.Context())
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	page := models.Page{
+		Title:   "Audit Log",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+		Misc: auditData{
+			Actor:       q.Get("actor"),
+			Entity:      q.Get("entity"),
+			From:        q.Get("from"),
+			To:          q.Get("to"),
+			EntityTypes: entityTypes,
+			Entries:     entries,
+			ExportURL:   "/audit-log.csv?" + r.URL.RawQuery,
+		},
+	}
+
+	renderPage(w, r, "audit_log.html", data)
+}
+
+func (s *server) AuditLogCSV(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("Session").(models.AdminUserSession); !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	entries, err := s.audit.List(r.Context(), auditFilter(r))
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "date", "actor_id", "actor_email", "action", "entity_type", "entity_id", "before", "after", "ip_address", "user_agent"})
+	for _, e := range entries {
+		actorId := ""
+		if e.ActorId.Valid {
+			actorId = strconv.FormatInt(e.ActorId.Int64, 10)
+		}
+		cw.Write([]string{
+			strconv.FormatUint(e.Id, 10),
+			e.DateCreated.Format(time.RFC3339),
+			actorId,
+			csvCell(e.ActorEmail),
+			e.Action,
+			e.EntityType,
+			csvCell(e.EntityId),
+			csvCell(e.Before),
+			csvCell(e.After),
+			csvCell(e.IpAddress),
+			csvCell(e.UserAgent),
+		})
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		LogError(r, err)
+	}
+}
+
+// csvCell keeps a spreadsheet from reading the cell as a formula. Emails and
+// user agents are typed by whoever tries to log in.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/tabular"
+	"github.com/annbelievable/go_listing/validate"
+	"github.com/annbelievable/go_listing/worker"
+
+	"github.com/gorilla/mux"
+)
+
+// bulkInlineLimit is the largest selection a bulk action runs for while the
+// request waits. Larger ones run in the background and report their progress.
+const bulkInlineLimit = 20
+
+// bulkLabels names the bulk actions, by the audit action they record.
+var bulkLabels = map[string]string{
+	"page.import":            "Import pages",
+	"listing.import":         "Import listings",
+	"feed.run":               "Run a feed",
+	"page.bulk_publish":      "Publish pages",
+	"page.bulk_unpublish":    "Unpublish pages",
+	"page.bulk_delete":       "Delete pages",
+	"listing.bulk_publish":   "Publish listings",
+	"listing.bulk_unpublish": "Unpublish listings",
+	"listing.bulk_category":  "Move listings to a category",
+	"listing.bulk_delete":    "Delete listings",
+}
+
+// bulkSummary is what the audit log keeps of a bulk action, one entry for the
+// whole selection.
+type bulkSummary struct {
+	Task string
+	// Options are what the action was run with, such as the category.
+	Options   map[string]string `json:",omitempty"`
+	Items     []string          `json:",omitempty"`
+	Succeeded int
+	// Failed maps the items that failed to the reason.
+	Failed map[string]string `json:",omitempty"`
+}
+
+// selectedIds reads the ticked rows of a bulk form, in order and without
+// repeats.
+func selectedIds(r *http.Request) ([]string, bool) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, value := range r.Form["id"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		if key := idString(id); !seen[key] {
+			seen[key] = true
+			ids = append(ids, key)
+		}
+	}
+	return ids, true
+}
+
+// bulkReason is an item failure explained in words the admin can act on, it
+// is shown as it is.
+type bulkReason string
+
+func (reason bulkReason) Error() string {
+	return string(reason)
+}
+
+// bulkItemError is the reason shown for a failed item. Errors the admin can
+// do nothing about are logged and shown without their details.
+func bulkItemError(r *http.Request, err error) error {
+	var reason bulkReason
+	switch {
+	case errors.As(err, &reason):
+		return reason
+	case errors.Is(err, repository.ErrNotFound):
+		return errors.New("not found, it may have been deleted")
+	case errors.Is(err, repository.ErrConflict):
+		return errors.New("edited by someone else meanwhile")
+	case errors.Is(err, repository.ErrUniqueViolation):
+		return errors.New("its url is used by another row")
+	case errors.Is(err, repository.ErrTimeout):
+		return errors.New("the database timed out")
+	default:
+		LogError(r, err)
+		return errors.New("internal error, see the logs")
+	}
+}
+
+// byId adapts an action on a row to the ids runBulk passes as items.
+func byId(fn func(ctx context.Context, id uint64) (string, error)) worker.ItemFunc {
+	return func(ctx context.Context, item string) (string, error) {
+		id, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return fn(ctx, id)
+	}
+}
+
+// runBulk runs fn over the items, in the request for small selections and in
+// the background for large ones, audits the whole run as one entry once it is
+// done and redirects to its results.
+func (s *server) runBulk(w http.ResponseWriter, r *http.Request, action, entityType string, options map[string]string, items []string, fn worker.ItemFunc) {
+	entry := newAuditEntry(r, s.currentActor(r), action, entityType, "", nil, nil)
+
+	item := func(ctx context.Context, item string) (string, error) {
+		label, err := fn(ctx, item)
+		if err != nil {
+			return label, bulkItemError(r, err)
+		}
+		return label, nil
+	}
+
+	done := func(task worker.Task) {
+		summary := bulkSummary{Task: task.Id, Options: options, Items: items}
+		for _, result := range task.Results {
+			if result.Error == "" {
+				summary.Succeeded++
+				continue
+			}
+			if summary.Failed == nil {
+				summary.Failed = make(map[string]string)
+			}
+			summary.Failed[result.Item] = result.Error
+		}
+
+		entry.After = auditValue(summary)
+		// the request may be long gone
+		if err := s.audit.Insert(context.Background(), entry); err != nil {
+			LogError(r, err)
+		}
+	}
+
+	var id string
+	if len(items) <= bulkInlineLimit {
+		id = s.tasks.Run(r.Context(), action, items, item, done)
+	} else {
+		id = s.tasks.Start(action, items, item, done)
+	}
+
+	http.Redirect(w, r, "/bulk/"+id, http.StatusFound)
+}
+
+// taskRole is the role needed to start the task, imports and feed runs are
+// for admins.
+func taskRole(name string) string {
+	if name == "feed.run" || strings.HasSuffix(name, ".import") {
+		return models.RoleAdmin
+	}
+	return models.RoleEditor
+}
+
+type bulkView struct {
+	Task worker.Task
+	Back string
+	// Columns head the item and label columns of the results.
+	Columns [2]string
+}
+
+// BulkTask shows the progress of a bulk action, then how every item went.
+// Only admins may look at the tasks only admins can start.
+func (s *server) BulkTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.tasks.Get(mux.Vars(r)["id"])
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+	if !s.checkRole(w, r, taskRole(task.Name)) {
+		return
+	}
+
+	view := bulkView{Task: task, Back: pageTransfer.List, Columns: [2]string{"id", "url"}}
+	if strings.HasPrefix(task.Name, "listing.") {
+		view.Back = listingTransfer.List
+	}
+	if strings.HasSuffix(task.Name, ".import") {
+		view.Columns = [2]string{"line", "key"}
+	}
+	if strings.HasPrefix(task.Name, "feed.") {
+		view.Back = "/feeds"
+		view.Columns = [2]string{"feed", "result"}
+	}
+
+	data := TemplateData{
+		Page: models.Page{Title: bulkLabels[task.Name]},
+		Misc: view,
+	}
+	if task.Running() {
+		data.Content = fmt.Sprintf("%d of %d done, this page refreshes until all are.", task.Done(), task.Total)
+	} else {
+		data.Content = fmt.Sprintf("%d of %d succeeded.", task.Total-task.Failed, task.Total)
+	}
+	renderPage(w, r, "bulk_task.html", data)
+}
+
+// PagesBulkAction applies the action chosen under the page list to the
+// ticked pages.
+func (s *server) PagesBulkAction(w http.ResponseWriter, r *http.Request) {
+	ids, ok := selectedIds(r)
+	if !ok {
+		BadRequest(w, r)
+		return
+	}
+	if len(ids) == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		s.renderPages(w, r, "Select at least one page.")
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "publish":
+		s.runBulk(w, r, "page.bulk_publish", "page", nil, ids, byId(s.setPageStatus(models.PagePublished)))
+	case "unpublish":
+		s.runBulk(w, r, "page.bulk_unpublish", "page", nil, ids, byId(s.setPageStatus(models.PageDraft)))
+	case "delete":
+		s.runBulk(w, r, "page.bulk_delete", "page", nil, ids, byId(func(ctx context.Context, id uint64) (string, error) {
+			page, err := s.pages.Get(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return page.Url, s.pages.Trash(ctx, id)
+		}))
+	case "export_csv":
+		s.exportPages(w, r, tabular.CSV, ids)
+	case "export_jsonl":
+		s.exportPages(w, r, tabular.JSONLines, ids)
+	default:
+		BadRequest(w, r)
+	}
+}
+
+func (s *server) setPageStatus(status string) func(ctx context.Context, id uint64) (string, error) {
+	return func(ctx context.Context, id uint64) (string, error) {
+		page, err := s.pages.Get(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if page.Status == status {
+			return page.Url, nil
+		}
+		page.Status = status
+		return page.Url, s.pages.Update(ctx, page)
+	}
+}
+
+func (s *server) exportPages(w http.ResponseWriter, r *http.Request, format string, ids []string) {
+	var rows [][]string
+	for _, item := range ids {
+		id, _ := strconv.ParseUint(item, 10, 64)
+		page, err := s.pages.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			repositoryError(w, r, err)
+			return
+		}
+		rows = append(rows, pageRow(page))
+	}
+
+	summary := bulkSummary{Options: map[string]string{"format": format}, Items: ids, Succeeded: len(rows)}
+	s.recordAudit(r, s.currentActor(r), "page.bulk_export", "page", "", nil, summary)
+	writeTable(w, r, pageTransfer, format, rows)
+}
+
+// Listings lists the listings for the admin, with their bulk actions.
+func (s *server) Listings(w http.ResponseWriter, r *http.Request) {
+	s.renderListings(w, r, "", nil)
+}
+
+// listingsView is the Misc of listings.html.
+type listingsView struct {
+	Listings []models.Listing
+	Filter   listingFilter
+	Statuses []string
+	Exports  []exportLink
+	// Category is the category the selection was to be moved to.
+	Category string
+}
+
+func (s *server) renderListings(w http.ResponseWriter, r *http.Request, message string, errs validate.Errors) {
+	filter := listingFilterFrom(r)
+	listings, err := s.findListings(r.Context(), filter)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		Page:    models.Page{Title: "Listings"},
+		Message: message,
+		Errors:  errs,
+		Misc: listingsView{
+			Listings: listings,
+			Filter:   filter,
+			Statuses: []string{models.ListingActive, models.ListingExpired},
+			Exports:  exportLinks(listingTransfer, filter.values()),
+			Category: r.PostForm.Get("category"),
+		},
+	}
+	renderPage(w, r, "listings.html", data)
+}
+
+// ListingsBulkAction applies the action chosen under the listing list to the
+// ticked listings.
+func (s *server) ListingsBulkAction(w http.ResponseWriter, r *http.Request) {
+	ids, ok := selectedIds(r)
+	if !ok {
+		BadRequest(w, r)
+		return
+	}
+	if len(ids) == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		s.renderListings(w, r, "Select at least one listing.", nil)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "publish":
+		s.runBulk(w, r, "listing.bulk_publish", "listing", nil, ids, byId(s.updateListing(func(l *models.Listing) { l.Status = models.ListingActive })))
+	case "unpublish":
+		s.runBulk(w, r, "listing.bulk_unpublish", "listing", nil, ids, byId(s.updateListing(func(l *models.Listing) { l.Status = models.ListingExpired })))
+	case "category":
+		category := strings.TrimSpace(r.PostForm.Get("category"))
+		errs, err := validate.Check(validate.Field{Name: "Category", Value: category, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar)}})
+		if err != nil {
+			LogError(r, err)
+			InternalServerError(w, r)
+			return
+		}
+		if errs != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			s.renderListings(w, r, "", errs)
+			return
+		}
+		s.runBulk(w, r, "listing.bulk_category", "listing", map[string]string{"category": category}, ids, byId(s.updateListing(func(l *models.Listing) { l.Category = category })))
+	case "delete":
+		s.runBulk(w, r, "listing.bulk_delete", "listing", nil, ids, byId(func(ctx context.Context, id uint64) (string, error) {
+			listing, err := s.listings.Get(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return listing.Url, s.listings.Delete(ctx, id)
+		}))
+	case "export_csv":
+		s.exportListings(w, r, tabular.CSV, ids)
+	case "export_jsonl":
+		s.exportListings(w, r, tabular.JSONLines, ids)
+	default:
+		BadRequest(w, r)
+	}
+}
+
+func (s *server) updateListing(change func(*models.Listing)) func(ctx context.Context, id uint64) (string, error) {
+	return func(ctx context.Context, id uint64) (string, error) {
+		listing, err := s.listings.Get(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		change(&listing)
+		return listing.Url, s.listings.Update(ctx, listing)
+	}
+}
+
+func (s *server) exportListings(w http.ResponseWriter, r *http.Request, format string, ids []string) {
+	var rows [][]string
+	for _, item := range ids {
+		id, _ := strconv.ParseUint(item, 10, 64)
+		listing, err := s.listings.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			repositoryError(w, r, err)
+			return
+		}
+		rows = append(rows, listingRow(listing))
+	}
+
+	summary := bulkSummary{Options: map[string]string{"format": format}, Items: ids, Succeeded: len(rows)}
+	s.recordAudit(r, s.currentActor(r), "listing.bulk_export", "listing", "", nil, summary)
+	writeTable(w, r, listingTransfer, format, rows)
+}
@@ -0,0 +1,863 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/handlers"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/media"
+	"github.com/annbelievable/go_listing/migrations"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/session"
+	"github.com/annbelievable/go_listing/validate"
+	"github.com/annbelievable/go_listing/wordpress"
+)
+
+// Exit codes shared by all commands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// exitPending is returned by "migrate status" when migrations are missing.
+	exitPending = 3
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+// commands is filled in init because the help command refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "go_listing serve [flags]", "run the web site (the default command)", serve},
+		{"migrate", migrateUsage, "apply, revert, list or create database migrations", migrateCommand},
+		{"create-admin", "go_listing create-admin [-role admin|editor] [flags] <email>\n\nThe password is read from the first line of standard input.", "create an admin account", createAdminCommand},
+		{"reset-password", "go_listing reset-password [flags] <email>\n\nThe new password is read from the first line of standard input. All\nsessions and remember-me tokens of the admin are ended.", "set a new password for an admin", resetPasswordCommand},
+		{"sessions", "usage:\n  go_listing sessions list [-admin email] [flags]\n  go_listing sessions delete [flags] <handle>...\n  go_listing sessions delete -admin email [flags]\n\nOnly sessions of the postgres session store can be managed here.", "list or end admin sessions", sessionsCommand},
+		{"export", "go_listing export [-o file] [flags]\n\nPages are written as JSON Lines, one page per line.", "export pages", exportCommand},
+		{"import", "go_listing import [-dry-run] [flags] [file]\n\nPages are read as JSON Lines from file or standard input. A page with the\nsame url is updated, otherwise a new page is created. A page without a\nstatus keeps its own, a new one is published.", "import pages", importCommand},
+		{"import-wordpress", "go_listing import-wordpress [-dry-run] [flags] <file>\n\nReads a WordPress export (WXR) file. Pages and posts become pages at their\nslug, a page with the same url is updated. Attachments are downloaded into\nmedia.dir and the old permalinks redirect to the new addresses. Running it\nagain updates what an earlier run imported.", "import pages and media from WordPress", importWordPressCommand},
+		{"config", "usage:\n  go_listing config print [flags]\n  go_listing config check [flags]", "show or check the configuration", configCommand},
+		{"help", "go_listing help [command]", "show help for a command", helpCommand},
+	}
+}
+
+// run dispatches args to a command and returns the exit code. Without a
+// command, or when the first argument is a flag, the site is served.
+func run(args []string) int {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0])) {
+		return serve(args)
+	}
+
+	if isHelpFlag(args[0]) {
+		return helpCommand(nil)
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		printCommands(os.Stderr)
+		return exitUsage
+	}
+
+	if len(args) > 1 && isHelpFlag(args[1]) {
+		commandUsage(cmd.name)
+		return exitOK
+	}
+
+	return cmd.run(args[1:])
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		printCommands(os.Stdout)
+		return exitOK
+	}
+
+	if _, ok := findCommand(args[0]); !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return exitUsage
+	}
+
+	commandUsage(args[0])
+	return exitOK
+}
+
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "usage: go_listing <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command accepts the configuration flags, e.g. -config file or")
+	fmt.Fprintln(w, "-database.host host. Run \"go_listing config print\" to see all settings.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "exit codes: 0 success, 1 failure, 2 usage error,")
+	fmt.Fprintln(w, "3 migrations pending (migrate status)")
+}
+
+// commandUsage prints the usage of a command to stderr.
+func commandUsage(name string) {
+	cmd, _ := findCommand(name)
+	usage := cmd.usage
+	if !strings.HasPrefix(usage, "usage:") {
+		usage = "usage: " + usage
+	}
+	fmt.Fprintln(os.Stderr, usage)
+}
+
+// loadCommand parses the flags of a command and loads the configuration. The
+// returned code is -1 when the command should go on.
+func loadCommand(fs *flag.FlagSet, args []string) (config.Config, []string, int) {
+	cfg, rest, err := config.LoadFlags(fs, args)
+	if err == flag.ErrHelp {
+		return cfg, nil, exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return cfg, nil, exitUsage
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return cfg, nil, exitFailure
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return cfg, nil, exitFailure
+	}
+	return cfg, rest, -1
+}
+
+// newCommandFlags returns a flag set whose usage is the usage of the command.
+func newCommandFlags(name string) *flag.FlagSet {
+	fs := config.NewFlagSet(name, os.Stderr)
+	fs.Usage = func() { commandUsage(name) }
+	return fs
+}
+
+// configCommand implements "config print", which shows the effective settings
+// with secrets redacted, and "config check", which only validates them.
+func configCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "print" && args[0] != "check") {
+		commandUsage("config")
+		return exitUsage
+	}
+
+	cfg, rest, err := config.Load(args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if len(rest) > 0 {
+		commandUsage("config")
+		return exitUsage
+	}
+
+	if args[0] == "print" {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	if args[0] == "check" {
+		fmt.Println("configuration is valid")
+	}
+
+	return exitOK
+}
+
+const migrateUsage = `usage:
+  go_listing migrate up [flags]
+  go_listing migrate down [flags] [steps]
+  go_listing migrate status [flags]
+  go_listing migrate create [-dir migrations] <name>
+
+"migrate status" exits with 3 when migrations are pending.`
+
+// migrateCommand implements the migrate subcommands.
+func migrateCommand(args []string) int {
+	if len(args) == 0 {
+		commandUsage("migrate")
+		return exitUsage
+	}
+
+	if args[0] == "create" {
+		return migrateCreate(args[1:])
+	}
+
+	cfg, rest, err := config.Load(args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(rest) > 0 {
+			steps, err = strconv.Atoi(rest[0])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "steps must be a positive number")
+				return exitUsage
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+
+		pending := 0
+		for _, s := range statuses {
+			switch {
+			case s.Unknown:
+				fmt.Printf("%04d  applied %s  (unknown to this build)\n", s.Version, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			case s.Applied:
+				fmt.Printf("%04d  applied %s  %s\n", s.Version, s.AppliedAt.Format("2006-01-02 15:04:05"), s.Name)
+			default:
+				pending++
+				fmt.Printf("%04d  pending                      %s\n", s.Version, s.Name)
+			}
+		}
+		if pending > 0 {
+			return exitPending
+		}
+	default:
+		commandUsage("migrate")
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+func migrateCreate(args []string) int {
+	fs := newCommandFlags("migrate")
+	dir := fs.String("dir", "migrations", "directory holding the migration files")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		commandUsage("migrate")
+		return exitUsage
+	}
+
+	up, down, err := migrations.Create(*dir, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	fmt.Println("created", up)
+	fmt.Println("created", down)
+	return exitOK
+}
+
+func createAdminCommand(args []string) int {
+	fs := newCommandFlags("create-admin")
+	role := fs.String("role", models.RoleAdmin, "role of the new admin: admin or editor")
+	cfg, rest, code := loadCommand(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(rest) != 1 {
+		commandUsage("create-admin")
+		return exitUsage
+	}
+	if *role != models.RoleAdmin && *role != models.RoleEditor {
+		fmt.Fprintf(os.Stderr, "unknown role %q\n", *role)
+		return exitUsage
+	}
+
+	email := strings.TrimSpace(rest[0])
+	if message, _ := validate.Email(email); message != "" || email == "" {
+		fmt.Fprintf(os.Stderr, "invalid email %q\n", email)
+		return exitUsage
+	}
+	password, err := readPassword(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	ctx := context.Background()
+	if database.AdminEmailExist(ctx, db, email) {
+		fmt.Fprintf(os.Stderr, "an admin with email %s already exists\n", email)
+		return exitFailure
+	}
+
+	hashedPwd, err := handlers.HashAndSalt(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	id, err := database.InsertAdmin(ctx, db, models.AdminUser{Email: email, Password: hashedPwd, Role: *role})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	recordCommandAudit(db, "admin.register", "admin_user", idString(id), nil, map[string]string{"email": email, "role": *role})
+
+	fmt.Printf("created %s admin %s\n", *role, email)
+	return exitOK
+}
+
+func resetPasswordCommand(args []string) int {
+	fs := newCommandFlags("reset-password")
+	cfg, rest, code := loadCommand(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(rest) != 1 {
+		commandUsage("reset-password")
+		return exitUsage
+	}
+
+	password, err := readPassword(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	ctx := context.Background()
+	admin, err := database.SelectAdmin(ctx, db, strings.TrimSpace(rest[0]))
+	if errors.Is(err, database.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "no admin with email %s\n", rest[0])
+		return exitFailure
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	hashedPwd, err := handlers.HashAndSalt(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	// a new password ends everything the old one let in, all of it or none
+	err = database.InTx(ctx, db, func(tx *sql.Tx) error {
+		if err := database.UpdateAdminPassword(ctx, tx, admin.Id, hashedPwd); err != nil {
+			return err
+		}
+		if err := database.DeleteAdminSessionByAdminId(ctx, tx, admin.Id); err != nil {
+			return err
+		}
+		return database.DeleteAdminRememberTokensByAdminId(ctx, tx, admin.Id)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	recordCommandAudit(db, "admin.password_reset", "admin_user", idString(admin.Id), nil, nil)
+
+	fmt.Printf("password of %s was reset\n", strings.TrimSpace(admin.Email))
+	return exitOK
+}
+
+// readPassword reads the first line of r. When r is a terminal a prompt is
+// shown; the input is echoed, so prefer piping the password in.
+func readPassword(r *os.File) (string, error) {
+	if info, err := r.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+
+	return password, nil
+}
+
+func sessionsCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "delete") {
+		commandUsage("sessions")
+		return exitUsage
+	}
+
+	fs := newCommandFlags("sessions")
+	adminEmail := fs.String("admin", "", "only the sessions of the admin with this email")
+	cfg, rest, code := loadCommand(fs, args[1:])
+	if code >= 0 {
+		return code
+	}
+
+	if cfg.Session.Store != "postgres" {
+		fmt.Fprintf(os.Stderr, "sessions are kept in the %s store and cannot be managed from the command line\n", cfg.Session.Store)
+		return exitFailure
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	ctx := context.Background()
+
+	var admin models.AdminUser
+	if *adminEmail != "" {
+		var err error
+		admin, err = database.SelectAdmin(ctx, db, *adminEmail)
+		if errors.Is(err, database.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "no admin with email %s\n", *adminEmail)
+			return exitFailure
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+
+	var list []models.AdminUserSession
+	var err error
+	if admin.Id != 0 {
+		list, err = database.SelectAdminSessionsByAdminId(ctx, db, admin.Id)
+	} else {
+		list, err = database.SelectAdminSessions(ctx, db)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	if args[0] == "list" {
+		if len(rest) > 0 {
+			commandUsage("sessions")
+			return exitUsage
+		}
+		return printSessions(db, list)
+	}
+
+	if admin.Id == 0 && len(rest) == 0 {
+		commandUsage("sessions")
+		return exitUsage
+	}
+	if admin.Id != 0 && len(rest) > 0 {
+		fmt.Fprintln(os.Stderr, "give either -admin or session handles, not both")
+		return exitUsage
+	}
+
+	wanted := make(map[string]bool)
+	for _, handle := range rest {
+		wanted[handle] = true
+	}
+
+	deleted := 0
+	for _, s := range list {
+		handle := session.Handle(s)
+		if admin.Id == 0 && !wanted[handle] {
+			continue
+		}
+		if err := database.DeleteAdminSession(ctx, db, s.SessionId); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		delete(wanted, handle)
+		deleted++
+		fmt.Println("deleted", handle)
+	}
+
+	if len(wanted) > 0 {
+		for handle := range wanted {
+			fmt.Fprintln(os.Stderr, "no session", handle)
+		}
+		return exitFailure
+	}
+
+	if deleted == 0 {
+		fmt.Println("no sessions to delete")
+	}
+	return exitOK
+}
+
+func printSessions(db *sql.DB, list []models.AdminUserSession) int {
+	ctx := context.Background()
+	emails := make(map[uint64]string)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HANDLE\tADMIN\tIP ADDRESS\tLAST SEEN\tEXPIRES")
+	for _, s := range list {
+		email, ok := emails[s.AdminUser]
+		if !ok {
+			admin, err := database.SelectAdminById(ctx, db, s.AdminUser)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+			email = admin.Email
+			emails[s.AdminUser] = email
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", session.Handle(s), email, s.IpAddress, s.LastSeen.Format("2006-01-02 15:04"), s.ExpiryDate.Format("2006-01-02 15:04"))
+	}
+	tw.Flush()
+
+	return exitOK
+}
+
+// pageRecord is the shape of a page in export and import files.
+type pageRecord struct {
+	Url     string `json:"url"`
+	Title   string `json:"title"`
+	Teaser  string `json:"teaser"`
+	Content string `json:"content"`
+	// Status is left out by files from before it was exported, the page then
+	// keeps its status.
+	Status string `json:"status,omitempty"`
+}
+
+func exportCommand(args []string) int {
+	fs := newCommandFlags("export")
+	output := fs.String("o", "", "write to this file instead of standard output")
+	cfg, rest, code := loadCommand(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(rest) > 0 {
+		commandUsage("export")
+		return exitUsage
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	ctx := context.Background()
+	pages, err := database.GetPages(ctx, db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		defer out.Close()
+	}
+
+	enc := json.NewEncoder(out)
+	for _, page := range pages {
+		err := enc.Encode(pageRecord{
+			Url:     strings.TrimSpace(page.Url),
+			Title:   strings.TrimSpace(page.Title),
+			Teaser:  page.Teaser,
+			Content: page.Content,
+			Status:  page.Status,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(os.Stderr, "exported %d pages to %s\n", len(pages), *output)
+	}
+
+	return exitOK
+}
+
+func importCommand(args []string) int {
+	fs := newCommandFlags("import")
+	dryRun := fs.Bool("dry-run", false, "check the file without writing to the database")
+	cfg, rest, code := loadCommand(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(rest) > 1 {
+		commandUsage("import")
+		return exitUsage
+	}
+
+	in := os.Stdin
+	if len(rest) == 1 && rest[0] != "-" {
+		f, err := os.Open(rest[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	ctx := context.Background()
+
+	var created, updated, failed int
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record pageRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", line, err)
+			failed++
+			continue
+		}
+
+		record.Url = strings.TrimSpace(record.Url)
+		record.Title = strings.TrimSpace(record.Title)
+		// the form rules without the uniqueness check, an existing url is
+		// updated
+		errs, _ := validate.Check(
+			validate.Field{Name: "url", Value: record.Url, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar), validate.Path}},
+			validate.Field{Name: "title", Value: record.Title, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar)}},
+			validate.Field{Name: "teaser", Value: record.Teaser, Rules: []validate.Rule{validate.MaxLength(maxVarchar)}},
+			validate.Field{Name: "status", Value: record.Status, Rules: []validate.Rule{validate.OneOf(models.PagePublished, models.PageDraft)}},
+		)
+		if errs != nil {
+			for _, name := range []string{"url", "title", "teaser", "status"} {
+				if message, ok := errs[name]; ok {
+					fmt.Fprintf(os.Stderr, "line %d: %s: %s\n", line, name, message)
+				}
+			}
+			failed++
+			continue
+		}
+
+		// the lookup and the save run in one transaction, a page saved in
+		// between makes the update fail with a conflict instead of being lost
+		var exists bool
+		err := database.InTx(ctx, db, func(tx *sql.Tx) error {
+			page, err := database.GetPageByUrl(ctx, tx, record.Url)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				return err
+			}
+			exists = err == nil
+
+			page.Url = record.Url
+			page.Title = record.Title
+			page.Teaser = record.Teaser
+			page.Content = record.Content
+			if record.Status != "" {
+				page.Status = record.Status
+			}
+
+			if *dryRun {
+				return nil
+			}
+			if exists {
+				return database.UpdatePage(ctx, tx, page)
+			}
+			_, err = database.InsertPage(ctx, tx, page)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", line, err)
+			failed++
+			continue
+		}
+
+		if exists {
+			updated++
+		} else {
+			created++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	if *dryRun {
+		fmt.Printf("dry run: %d pages would be created, %d updated, %d failed\n", created, updated, failed)
+	} else {
+		fmt.Printf("%d pages created, %d updated, %d failed\n", created, updated, failed)
+	}
+
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func importWordPressCommand(args []string) int {
+	fs := newCommandFlags("import-wordpress")
+	dryRun := fs.Bool("dry-run", false, "report what would change without saving or downloading anything")
+	cfg, rest, code := loadCommand(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(rest) != 1 {
+		commandUsage("import-wordpress")
+		return exitUsage
+	}
+
+	f, err := os.Open(rest[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	export, err := wordpress.Parse(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", rest[0], err)
+		return exitFailure
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	s := newServer(repository.NewPostgres(db), nil)
+	s.media = media.NewStore(cfg.Media.Dir)
+
+	opts := wordpressOptions{Client: &http.Client{Timeout: mediaTimeout}, DryRun: *dryRun}
+	report := s.importWordPress(context.Background(), export, opts)
+	for _, message := range report.Errors {
+		fmt.Fprintln(os.Stderr, message)
+	}
+
+	summary := fmt.Sprintf("%d pages created, %d updated, %d unchanged, %d skipped, %d media files, %d redirects, %d failed",
+		report.Created, report.Updated, report.Unchanged, report.Skipped, report.Media, report.Redirects, report.Failed)
+	if *dryRun {
+		fmt.Println("dry run: " + summary)
+	} else {
+		fmt.Println(summary)
+		recordCommandAudit(db, "page.wordpress_import", "page", "", nil, report)
+	}
+
+	if report.Failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// recordCommandAudit stores an audit entry for a change made from the command
+// line. Like recordAudit, a failure is only logged.
+func recordCommandAudit(db *sql.DB, action, entityType, entityId string, before, after interface{}) {
+	ctx := context.Background()
+	entry := models.AuditLog{
+		ActorEmail: "cli",
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Before:     auditValue(before),
+		After:      auditValue(after),
+		UserAgent:  "go_listing command line",
+	}
+
+	if err := database.InsertAuditLog(ctx, db, entry); err != nil {
+		LogError(nil, err)
+	}
+}
+
+// checkSchema stops the server when the database misses migrations. When the
+// database cannot be reached the check is skipped, the server starts without it.
+func checkSchema(db *sql.DB) {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		logger.Default().Error("could not load migrations", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	err = migrator.Check(context.Background())
+	if err == migrations.ErrOutdated {
+		logger.Default().Error(err.Error())
+		os.Exit(exitFailure)
+	}
+	if err != nil {
+		logger.Default().Warn("could not check schema version", "error", err)
+	}
+}
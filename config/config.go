@@ -0,0 +1,374 @@
+// Package config loads the application settings. Values come from the
+// defaults below, then a YAML file, then environment variables and finally
+// command line flags, each source overriding the ones before it.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+)
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Session  Session  `yaml:"session"`
+	SSO      SSO      `yaml:"sso"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Pages    Pages    `yaml:"pages"`
+	Media    Media    `yaml:"media"`
+	// Feeds can only be set in the file.
+	Feeds []Feed `yaml:"feeds"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" env:"SERVER_ADDR" help:"address the HTTP server listens on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" help:"time allowed to read a whole request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" help:"time allowed to read the request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" help:"time allowed to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" help:"how long an idle keep-alive connection stays open"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" help:"largest accepted request header in bytes"`
+	// ShutdownDelay keeps serving while readiness reports "not ready", so load
+	// balancers stop sending traffic before the listener closes.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" help:"time between failing readiness and closing the listener on shutdown"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" help:"time allowed for in-flight requests and workers to finish on shutdown"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host" env:"DATABASE_HOST" help:"PostgreSQL host"`
+	Port            int           `yaml:"port" env:"DATABASE_PORT" help:"PostgreSQL port"`
+	User            string        `yaml:"user" env:"DATABASE_USER" help:"PostgreSQL user"`
+	Password        string        `yaml:"password" env:"DATABASE_PASSWORD" secret:"true" help:"PostgreSQL password"`
+	Name            string        `yaml:"name" env:"DATABASE_NAME" help:"PostgreSQL database name"`
+	SSLMode         string        `yaml:"sslmode" env:"DATABASE_SSLMODE" help:"PostgreSQL sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS" help:"maximum open connections"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS" help:"maximum idle connections"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DATABASE_CONN_MAX_IDLE_TIME" help:"close connections idle for longer than this"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME" help:"close connections older than this"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"DATABASE_QUERY_TIMEOUT" help:"longest time a single query may run"`
+}
+
+type Session struct {
+	// Store is postgres, memory or cookie.
+	Store            string        `yaml:"store" env:"SESSION_STORE" help:"session store: postgres, memory or cookie"`
+	Secret           string        `yaml:"secret" env:"SESSION_SECRET" secret:"true" help:"signing key for the cookie store, at least 32 bytes"`
+	Lifetime         time.Duration `yaml:"lifetime" env:"SESSION_LIFETIME" help:"idle time before a session expires"`
+	RememberLifetime time.Duration `yaml:"remember_lifetime" env:"SESSION_REMEMBER_LIFETIME" help:"lifetime of remember-me tokens"`
+	Cookie           Cookie        `yaml:"cookie"`
+}
+
+type Cookie struct {
+	Name     string `yaml:"name" env:"SESSION_COOKIE_NAME" help:"session cookie name, use a __Host- prefix in production"`
+	Domain   string `yaml:"domain" env:"SESSION_COOKIE_DOMAIN" help:"session cookie domain"`
+	Secure   bool   `yaml:"secure" env:"SESSION_COOKIE_SECURE" help:"only send session cookies over https"`
+	SameSite string `yaml:"samesite" env:"SESSION_COOKIE_SAMESITE" help:"SameSite attribute: lax, strict or none"`
+}
+
+type SSO struct {
+	Issuer       string `yaml:"issuer" env:"OIDC_ISSUER" help:"OpenID provider issuer url, empty turns SSO off"`
+	ClientID     string `yaml:"client_id" env:"OIDC_CLIENT_ID" help:"OpenID client id"`
+	ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" help:"OpenID client secret"`
+	RedirectURL  string `yaml:"redirect_url" env:"OIDC_REDIRECT_URL" help:"callback url registered with the provider"`
+	GroupsClaim  string `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM" help:"ID token claim holding the user's groups"`
+	// RoleMap maps provider groups to local roles.
+	RoleMap       map[string]string `yaml:"role_map" env:"OIDC_ROLE_MAP" help:"group=role pairs, comma separated"`
+	AutoCreate    bool              `yaml:"auto_create" env:"OIDC_AUTO_CREATE" help:"create unknown admins on first SSO login"`
+	PasswordLogin bool              `yaml:"password_login" env:"PASSWORD_LOGIN" help:"allow password login and registration"`
+}
+
+type Pages struct {
+	TrashRetention time.Duration `yaml:"trash_retention" env:"PAGES_TRASH_RETENTION" help:"time deleted pages stay in the trash before they are purged, 0 keeps them"`
+}
+
+type Media struct {
+	Dir string `yaml:"dir" env:"MEDIA_DIR" help:"directory media files are stored in and served from under /media/"`
+}
+
+// Feed is a partner's listing feed, imported on a schedule. Listings get the
+// feed name and the key of their item as external id, and are expired when
+// their item leaves the feed.
+type Feed struct {
+	Name string `yaml:"name"`
+	// URL or Path is where the feed is read from, only one is set.
+	URL      string        `yaml:"url"`
+	Path     string        `yaml:"path"`
+	Format   string        `yaml:"format"`
+	Interval time.Duration `yaml:"interval"`
+	// Item is the XML element of one listing.
+	Item string `yaml:"item"`
+	// Key is the column or element that identifies an item in the feed.
+	Key string `yaml:"key"`
+	// Mapping maps the listing fields url, title, description and category
+	// to columns or elements.
+	Mapping map[string]string `yaml:"mapping"`
+	// MaxSize is the largest feed read in bytes, 0 is 64 MiB. A larger feed
+	// fails its run.
+	MaxSize int64 `yaml:"max_size"`
+}
+
+// FeedFields are the listing fields a feed can map.
+var FeedFields = []string{"url", "title", "description", "category"}
+
+var feedName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" help:"lowest level logged: debug, info, warn or error"`
+	Format string `yaml:"format" env:"LOG_FORMAT" help:"log line format: text or json"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout, file or otlp.
+	Exporter    string            `yaml:"exporter" env:"TRACING_EXPORTER" help:"where spans go: none, stdout, file or otlp"`
+	File        string            `yaml:"file" env:"TRACING_FILE" help:"file the file exporter appends to"`
+	Endpoint    string            `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" help:"OTLP/HTTP collector url, e.g. http://localhost:4318"`
+	Headers     map[string]string `yaml:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true" help:"headers sent to the collector, key=value pairs comma separated"`
+	ServiceName string            `yaml:"service_name" env:"OTEL_SERVICE_NAME" help:"service name recorded with every span"`
+	SampleRatio float64           `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" help:"share of new traces recorded, from 0 to 1"`
+}
+
+// Default returns the settings used when nothing else is configured. They
+// match a local development database.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Host:            "127.0.0.1",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "password",
+			Name:            "go_my_diary",
+			SSLMode:         "disable",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxIdleTime: 1 * time.Second,
+			ConnMaxLifetime: 30 * time.Second,
+			QueryTimeout:    5 * time.Second,
+		},
+		Session: Session{
+			Store:            "postgres",
+			Lifetime:         30 * time.Minute,
+			RememberLifetime: 30 * 24 * time.Hour,
+			Cookie: Cookie{
+				Name:     "session_id",
+				SameSite: "lax",
+			},
+		},
+		SSO: SSO{
+			GroupsClaim:   "groups",
+			PasswordLogin: true,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			File:        "traces.jsonl",
+			ServiceName: "go_listing",
+			SampleRatio: 1,
+		},
+		Pages: Pages{
+			TrashRetention: 30 * 24 * time.Hour,
+		},
+		Media: Media{
+			Dir: "uploads",
+		},
+	}
+}
+
+// DSN is the connection string for the pgx driver.
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(d.Host), d.Port, quote(d.User), quote(d.Password), quote(d.Name), quote(d.SSLMode))
+}
+
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// SameSite maps the configured string to the http.SameSite value.
+func (c Cookie) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(c.SameSite) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+
+	return http.SameSiteDefaultMode, fmt.Errorf("unknown SameSite value %q", c.SameSite)
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Server.Addr == "" {
+		problems = append(problems, "server.addr must not be empty")
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		problems = append(problems, "server timeouts must not be negative")
+	}
+	if c.Server.MaxHeaderBytes < 1024 {
+		problems = append(problems, "server.max_header_bytes must be at least 1024")
+	}
+	if c.Server.ShutdownDelay < 0 || c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_delay must not be negative and server.shutdown_timeout must be positive")
+	}
+
+	if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" {
+		problems = append(problems, "database.host, database.user and database.name are required")
+	}
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		problems = append(problems, "database.port must be between 1 and 65535")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		problems = append(problems, "database.max_open_conns must be at least 1")
+	}
+	if c.Database.QueryTimeout <= 0 {
+		problems = append(problems, "database.query_timeout must be positive")
+	}
+
+	switch c.Session.Store {
+	case "postgres", "memory":
+	case "cookie":
+		if len(c.Session.Secret) < 32 {
+			problems = append(problems, "session.secret must be at least 32 bytes for the cookie store")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("session.store %q must be postgres, memory or cookie", c.Session.Store))
+	}
+	if c.Session.Lifetime <= 0 {
+		problems = append(problems, "session.lifetime must be positive")
+	}
+	if c.Session.RememberLifetime <= 0 {
+		problems = append(problems, "session.remember_lifetime must be positive")
+	}
+	if c.Session.Cookie.Name == "" {
+		problems = append(problems, "session.cookie.name must not be empty")
+	}
+	if _, err := c.Session.Cookie.SameSiteMode(); err != nil {
+		problems = append(problems, "session.cookie.samesite: "+err.Error())
+	}
+
+	if c.SSO.Issuer != "" {
+		if c.SSO.ClientID == "" || c.SSO.RedirectURL == "" {
+			problems = append(problems, "sso.client_id and sso.redirect_url are required when sso.issuer is set")
+		}
+	} else if !c.SSO.PasswordLogin {
+		problems = append(problems, "sso.password_login cannot be turned off without sso.issuer, nobody could log in")
+	}
+	var groups []string
+	for group := range c.SSO.RoleMap {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if role := c.SSO.RoleMap[group]; role != models.RoleAdmin && role != models.RoleEditor {
+			problems = append(problems, fmt.Sprintf("sso.role_map: group %q has role %q, use %s or %s", group, role, models.RoleAdmin, models.RoleEditor))
+		}
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		problems = append(problems, fmt.Sprintf("log.format %q must be text or json", c.Log.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			problems = append(problems, "tracing.file is required for the file exporter")
+		}
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			problems = append(problems, "tracing.endpoint is required for the otlp exporter")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q must be none, stdout, file or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+
+	if c.Pages.TrashRetention < 0 {
+		problems = append(problems, "pages.trash_retention must not be negative")
+	}
+
+	if c.Media.Dir == "" {
+		problems = append(problems, "media.dir is required")
+	}
+
+	names := make(map[string]bool)
+	for i, feed := range c.Feeds {
+		name := fmt.Sprintf("feeds[%d]", i)
+		if !feedName.MatchString(feed.Name) {
+			problems = append(problems, name+".name must be up to 32 lowercase letters, digits, - and _")
+		} else if names[feed.Name] {
+			problems = append(problems, fmt.Sprintf("%s.name %q is used by another feed", name, feed.Name))
+		}
+		names[feed.Name] = true
+
+		if (feed.URL == "") == (feed.Path == "") {
+			problems = append(problems, name+" needs either url or path")
+		}
+		if feed.URL != "" && !strings.HasPrefix(feed.URL, "http://") && !strings.HasPrefix(feed.URL, "https://") {
+			problems = append(problems, name+".url must be an http or https url")
+		}
+		if feed.Format != "csv" && feed.Format != "xml" && feed.Format != "jsonl" {
+			problems = append(problems, fmt.Sprintf("%s.format %q must be csv, xml or jsonl", name, feed.Format))
+		}
+		if feed.Interval < time.Minute {
+			problems = append(problems, name+".interval must be at least 1m")
+		}
+		if feed.MaxSize < 0 {
+			problems = append(problems, name+".max_size must not be negative")
+		}
+		if feed.Key == "" {
+			problems = append(problems, name+".key is required")
+		}
+		if feed.Mapping["url"] == "" || feed.Mapping["title"] == "" {
+			problems = append(problems, name+".mapping must map url and title")
+		}
+		var unknown []string
+		for field := range feed.Mapping {
+			known := false
+			for _, f := range FeedFields {
+				known = known || f == field
+			}
+			if !known {
+				unknown = append(unknown, field)
+			}
+		}
+		sort.Strings(unknown)
+		for _, field := range unknown {
+			problems = append(problems, fmt.Sprintf("%s.mapping: unknown field %q, use %s", name, field, strings.Join(FeedFields, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when no file is given and it exists.
+const DefaultFile = "config.yaml"
+
+// Load builds the configuration from defaults, the YAML file, the environment
+// and the flags in args. The file is taken from the -config flag, then the
+// CONFIG_FILE variable, then DefaultFile. Flags that are not config settings
+// are rejected. The arguments left after the flags are returned.
+func Load(args []string, stderr io.Writer) (Config, []string, error) {
+	return LoadFlags(NewFlagSet("config", stderr), args)
+}
+
+// LoadFlags is Load with a flag set prepared by the caller, so a command can
+// accept its own flags next to the config settings.
+func LoadFlags(fs *flag.FlagSet, args []string) (Config, []string, error) {
+	cfg := Default()
+
+	file := fs.String("config", "", "path to a YAML config file")
+	var set []flagValue
+	registerFlags(fs, reflect.ValueOf(&cfg).Elem(), "", &set)
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	path := *file
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+
+	if path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, nil, err
+	}
+
+	// flags were parsed before the file and environment were read, so they
+	// are applied again to take precedence
+	for _, f := range set {
+		if err := setValue(f.value, f.raw); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// NewFlagSet returns a flag set that reports errors instead of exiting.
+func NewFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if output != nil {
+		fs.SetOutput(output)
+	}
+	return fs
+}
+
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func loadEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("config: %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+type flagValue struct {
+	value reflect.Value
+	raw   string
+}
+
+// registerFlags adds a flag named after the YAML path of every setting, e.g.
+// -database.host, and records the flags that were set in set.
+func registerFlags(fs *flag.FlagSet, v reflect.Value, prefix string, set *[]flagValue) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		name := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct {
+			registerFlags(fs, value, name+".", set)
+			continue
+		}
+		// lists are only read from the file
+		if field.Type.Kind() == reflect.Slice {
+			continue
+		}
+
+		usage := field.Tag.Get("help")
+		if env := field.Tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+
+		fs.Func(name, usage, func(raw string) error {
+			if err := setValue(value, raw); err != nil {
+				return err
+			}
+			*set = append(*set, flagValue{value: value, raw: raw})
+			return nil
+		})
+	}
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(raw)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case map[string]string:
+		m := make(map[string]string)
+		for _, pair := range strings.Split(raw, ",") {
+			i := strings.Index(pair, "=")
+			if i < 0 {
+				if strings.TrimSpace(pair) == "" {
+					continue
+				}
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			m[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+// Redacted returns a copy with every secret setting that is set replaced by a
+// placeholder, safe to print or log. Feed urls keep their host and path but
+// lose their user info and query values, where partners put credentials.
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+
+	if c.Feeds != nil {
+		// the feeds are shared with the original config, so copy them
+		feeds := make([]Feed, len(c.Feeds))
+		for i, feed := range c.Feeds {
+			feed.URL = redactURL(feed.URL)
+			feeds[i] = feed
+		}
+		c.Feeds = feeds
+	}
+	return c
+}
+
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[REDACTED]"
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for key := range q {
+			q.Set(key, "REDACTED")
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			redact(value)
+			continue
+		}
+
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+
+		switch {
+		case value.Kind() == reflect.String && value.String() != "":
+			value.SetString("[REDACTED]")
+		case value.Kind() == reflect.Map && value.Len() > 0:
+			// the map is shared with the original config, so replace it
+			redacted := reflect.MakeMap(value.Type())
+			for _, key := range value.MapKeys() {
+				redacted.SetMapIndex(key, reflect.ValueOf("[REDACTED]"))
+			}
+			value.Set(redacted)
+		}
+	}
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func Print(w io.Writer, c Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
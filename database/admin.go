@@ -1,53 +1,103 @@
-package database
-
-import (
-	"database/sql"
-	"time"
-
-	"github.com/annbelievable/go_listing/models"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
-)
-
-func InsertAdmin(db *sql.DB, email, password string) error {
-	_, err := db.Exec("INSERT INTO admin_user(email, password, dateupdated, datecreated) VALUES($1, $2, $3, $4);", email, password, time.Now(), time.Now())
-
-	return err
-}
-
-func SelectAdmin(db *sql.DB, email string) (models.AdminUser, error) {
-	row := db.QueryRow("SELECT id, email, password AS count FROM admin_user WHERE email = $1;", email)
-	var admin models.AdminUser
-	err := row.Scan(&admin.Id, &admin.Email, &admin.Password)
-
-	if err != nil {
-		return admin, err
-	}
-
-	return admin, nil
-}
-
-func SelectAdminHpwd(db *sql.DB, email string) (string, error) {
-	row := db.QueryRow("SELECT password FROM admin_user WHERE email = $1;", email)
-
-	var hpwd string
-	err := row.Scan(&hpwd)
-
-	if err != nil {
-		return hpwd, err
-	}
-
-	return hpwd, nil
-}
-
-func AdminEmailExist(db *sql.DB, email string) bool {
-	row := db.QueryRow("SELECT count(*) AS count FROM admin_user WHERE email = $1;", email)
-	var count int
-	err := row.Scan(&count)
-
-	if err != nil {
-		return false
-	}
-
-	return count > 0
-}
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// InsertAdmin creates the admin and returns its id. An empty role defaults to
+// models.RoleAdmin.
+func InsertAdmin(ctx context.Context, db Queryer, admin models.AdminUser) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if admin.Role == "" {
+		admin.Role = models.RoleAdmin
+	}
+
+	var id uint64
+	err := db.QueryRowContext(ctx, "INSERT INTO admin_user(email, password, role, dateupdated, datecreated) VALUES($1, $2, $3, $4, $5) RETURNING id;", admin.Email, admin.Password, admin.Role, time.Now(), time.Now()).Scan(&id)
+
+	return id, mapError(err)
+}
+
+func SelectAdmin(ctx context.Context, db Queryer, email string) (models.AdminUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT id, TRIM(email), TRIM(password), role FROM admin_user WHERE email = $1;", email)
+	var admin models.AdminUser
+	err := row.Scan(&admin.Id, &admin.Email, &admin.Password, &admin.Role)
+
+	if err != nil {
+		return admin, mapError(err)
+	}
+
+	return admin, nil
+}
+
+func SelectAdminById(ctx context.Context, db Queryer, id uint64) (models.AdminUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT id, TRIM(email), role FROM admin_user WHERE id = $1;", id)
+	var admin models.AdminUser
+	err := row.Scan(&admin.Id, &admin.Email, &admin.Role)
+
+	if err != nil {
+		return admin, mapError(err)
+	}
+
+	return admin, nil
+}
+
+func UpdateAdminRole(ctx context.Context, db Queryer, id uint64, role string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE admin_user SET role = $1, dateupdated = $2 WHERE id = $3;", role, time.Now(), id)
+	return affectedOne(result, err)
+}
+
+func UpdateAdminPassword(ctx context.Context, db Queryer, id uint64, password string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE admin_user SET password = $1, dateupdated = $2 WHERE id = $3;", password, time.Now(), id)
+	return affectedOne(result, err)
+}
+
+func SelectAdminHpwd(ctx context.Context, db Queryer, email string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT password FROM admin_user WHERE email = $1;", email)
+
+	var hpwd string
+	err := row.Scan(&hpwd)
+
+	if err != nil {
+		return hpwd, mapError(err)
+	}
+
+	return hpwd, nil
+}
+
+func AdminEmailExist(ctx context.Context, db Queryer, email string) bool {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT count(*) AS count FROM admin_user WHERE email = $1;", email)
+	var count int
+	err := row.Scan(&count)
+
+	if err != nil {
+		return false
+	}
+
+	return count > 0
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// AuditFilter narrows SelectAuditLogs. Zero values match everything.
+type AuditFilter struct {
+	Actor      string
+	EntityType string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+func InsertAuditLog(ctx context.Context, db Queryer, entry models.AuditLog) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO audit_log(actor_id, actor_email, action, entity_type, entity_id, before_value, after_value, ip_address, user_agent, datecreated) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);", entry.ActorId, entry.ActorEmail, entry.Action, entry.EntityType, entry.EntityId, entry.Before, entry.After, entry.IpAddress, entry.UserAgent, time.Now())
+
+	return mapError(err)
+}
+
+// SelectAuditLogs returns the matching entries, newest first.
+func SelectAuditLogs(ctx context.Context, db Queryer, filter AuditFilter) ([]models.AuditLog, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+
+	if filter.Actor != "" {
+		args = append(args, "%"+escapeLike(filter.Actor)+"%")
+		where = append(where, fmt.Sprintf("actor_email ILIKE $%d", len(args)))
+	}
+	if filter.EntityType != "" {
+		args = append(args, filter.EntityType)
+		where = append(where, fmt.Sprintf("entity_type = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		where = append(where, fmt.Sprintf("datecreated >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		where = append(where, fmt.Sprintf("datecreated < $%d", len(args)))
+	}
+
+	query := "SELECT id, actor_id, actor_email, action, entity_type, entity_id, before_value, after_value, ip_address, user_agent, datecreated FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditLog
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := rows.Scan(&entry.Id, &entry.ActorId, &entry.ActorEmail, &entry.Action, &entry.EntityType, &entry.EntityId, &entry.Before, &entry.After, &entry.IpAddress, &entry.UserAgent, &entry.DateCreated); err != nil {
+			return entries, mapError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, mapError(rows.Err())
+}
+
+func SelectAuditEntityTypes(ctx context.Context, db Queryer) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT entity_type FROM audit_log ORDER BY entity_type;")
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return types, mapError(err)
+		}
+		types = append(types, t)
+	}
+
+	return types, mapError(rows.Err())
+}
@@ -1,31 +1,85 @@
-package database
-
-import (
-	"database/sql"
-	"fmt"
-	"log"
-	"time"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
-)
-
-func ConnectDatabase() *sql.DB {
-	psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", "127.0.0.1", 5432, "postgres", "password", "go_my_diary")
-
-	db, err := sql.Open("pgx", psqlconn)
-
-	if err != nil {
-		log.Printf("could not connect to database: %v\n", err)
-	}
-
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(10)
-	db.SetConnMaxIdleTime(1 * time.Second)
-	db.SetConnMaxLifetime(30 * time.Second)
-
-	if err := db.Ping(); err != nil {
-		log.Printf("unable to reach database: %v\n", err)
-	}
-
-	return db
-}
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/logger"
+
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// QueryTimeout bounds every statement run by this package. A context with an
+// earlier deadline, such as a request that is going away, ends it sooner.
+var QueryTimeout = 5 * time.Second
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
+// Queryer runs statements, it is satisfied by both *sql.DB and *sql.Tx so the
+// functions of this package work inside and outside a transaction.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InTx runs fn in a transaction, committing when it returns nil and rolling
+// back otherwise. Statements that must see or leave a consistent state, such
+// as a read followed by a write, belong in one.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return mapError(tx.Commit())
+}
+
+func ConnectDatabase(cfg config.Database) *sql.DB {
+	if cfg.QueryTimeout > 0 {
+		QueryTimeout = cfg.QueryTimeout
+	}
+
+	connector, err := stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(cfg.DSN())
+
+	if err != nil {
+		logger.Default().Error("could not connect to database", "error", err)
+		connector = failedConnector{err: err}
+	}
+
+	db := sql.OpenDB(tracedConnector{Connector: connector, database: cfg.Name})
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		logger.Default().Warn("unable to reach database", "error", err)
+	}
+
+	return db
+}
+
+// failedConnector stands in when the settings cannot be parsed, so every use
+// of the pool reports why instead of the process crashing on a nil pool.
+type failedConnector struct {
+	err error
+}
+
+func (c failedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c failedConnector) Driver() driver.Driver {
+	return stdlib.GetDefaultDriver()
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// Domain errors returned by this package. Check for them with errors.Is; the
+// driver error stays available through errors.As and Unwrap.
+var (
+	ErrNotFound        = errors.New("database: not found")
+	ErrUniqueViolation = errors.New("database: unique violation")
+	ErrTimeout         = errors.New("database: query timed out")
+	// ErrConflict means the row changed since the version the caller read.
+	ErrConflict = errors.New("database: version conflict")
+)
+
+// Error ties a driver error to the domain error it stands for.
+type Error struct {
+	Kind error
+	// Constraint names the violated constraint, if any.
+	Constraint string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// PostgreSQL error codes, see the errcodes appendix of the manual.
+const (
+	codeUniqueViolation = "23505"
+	codeQueryCanceled   = "57014"
+)
+
+// mapError turns the errors handlers care about into domain errors and leaves
+// the rest, including nil, alone.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case codeUniqueViolation:
+			return &Error{Kind: ErrUniqueViolation, Constraint: pgErr.ConstraintName, Err: err}
+		case codeQueryCanceled:
+			return &Error{Kind: ErrTimeout, Err: err}
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+
+	return err
+}
+
+// affectedOne maps an update or delete that matched no row to ErrNotFound.
+func affectedOne(result sql.Result, err error) error {
+	if err != nil {
+		return mapError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return mapError(err)
+	}
+	if n == 0 {
+		return &Error{Kind: ErrNotFound, Err: sql.ErrNoRows}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+const feedRunColumns = "id, feed, items, created, updated, unchanged, expired, failed, error, item_errors, datestarted, datefinished"
+
+// item errors are stored one per line
+func joinItemErrors(errs []string) string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = strings.ReplaceAll(err, "\n", " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func InsertFeedRun(ctx context.Context, db Queryer, run models.FeedRun) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var id uint64
+	err := db.QueryRowContext(ctx, "INSERT INTO feed_run(feed, items, created, updated, unchanged, expired, failed, error, item_errors, datestarted, datefinished) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id;",
+		run.Feed, run.Items, run.Created, run.Updated, run.Unchanged, run.Expired, run.Failed, run.Error, joinItemErrors(run.ItemErrors), run.DateStarted, run.DateFinished).Scan(&id)
+
+	return id, mapError(err)
+}
+
+// GetFeedRuns returns the last runs of the feed, or of every feed when feed is
+// empty, newest first.
+func GetFeedRuns(ctx context.Context, db Queryer, feed string, limit int) ([]models.FeedRun, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+feedRunColumns+" FROM feed_run WHERE $1 = '' OR feed = $1 ORDER BY datestarted DESC, id DESC LIMIT $2;", feed, limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var runs []models.FeedRun
+	for rows.Next() {
+		var run models.FeedRun
+		var itemErrors string
+		err := rows.Scan(&run.Id, &run.Feed, &run.Items, &run.Created, &run.Updated, &run.Unchanged, &run.Expired, &run.Failed, &run.Error, &itemErrors, &run.DateStarted, &run.DateFinished)
+		if err != nil {
+			return runs, mapError(err)
+		}
+		if itemErrors != "" {
+			run.ItemErrors = strings.Split(itemErrors, "\n")
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, mapError(rows.Err())
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+const listingColumns = "id, external_id, title, url, description, category, status, dateupdated, datecreated"
+
+func scanListing(row interface{ Scan(...interface{}) error }) (models.Listing, error) {
+	var listing models.Listing
+	err := row.Scan(&listing.Id, &listing.ExternalId, &listing.Title, &listing.Url, &listing.Description, &listing.Category, &listing.Status, &listing.DateUpdated, &listing.DateCreated)
+	return listing, err
+}
+
+func InsertListing(ctx context.Context, db Queryer, listing models.Listing) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if listing.Status == "" {
+		listing.Status = models.ListingActive
+	}
+
+	var id uint64
+	now := time.Now()
+	err := db.QueryRowContext(ctx, "INSERT INTO listing(external_id, title, url, description, category, status, dateupdated, datecreated) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;", listing.ExternalId, listing.Title, listing.Url, listing.Description, listing.Category, listing.Status, now, now).Scan(&id)
+
+	return id, mapError(err)
+}
+
+func GetListingById(ctx context.Context, db Queryer, id uint64) (models.Listing, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	listing, err := scanListing(db.QueryRowContext(ctx, "SELECT "+listingColumns+" FROM listing WHERE id = $1;", id))
+	return listing, mapError(err)
+}
+
+func GetListingByExternalId(ctx context.Context, db Queryer, externalId string) (models.Listing, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	listing, err := scanListing(db.QueryRowContext(ctx, "SELECT "+listingColumns+" FROM listing WHERE external_id = $1 AND external_id <> '';", externalId))
+	return listing, mapError(err)
+}
+
+func GetListingByUrl(ctx context.Context, db Queryer, url string) (models.Listing, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	listing, err := scanListing(db.QueryRowContext(ctx, "SELECT "+listingColumns+" FROM listing WHERE url = $1;", url))
+	return listing, mapError(err)
+}
+
+func GetListings(ctx context.Context, db Queryer) ([]models.Listing, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+listingColumns+" FROM listing ORDER BY url ASC;")
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var listings []models.Listing
+	for rows.Next() {
+		listing, err := scanListing(rows)
+		if err != nil {
+			return listings, mapError(err)
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings, mapError(rows.Err())
+}
+
+// CountListings counts the listings with the status, or all of them when
+// status is empty.
+func CountListings(ctx context.Context, db Queryer, status string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM listing WHERE $1 = '' OR status = $1;", status).Scan(&count)
+	return count, mapError(err)
+}
+
+func UpdateListing(ctx context.Context, db Queryer, listing models.Listing) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE listing SET external_id = $1, title = $2, url = $3, description = $4, category = $5, status = $6, dateupdated = $7 WHERE id = $8;", listing.ExternalId, listing.Title, listing.Url, listing.Description, listing.Category, listing.Status, time.Now(), listing.Id)
+	return affectedOne(result, err)
+}
+
+func DeleteListing(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM listing WHERE id = $1;", id)
+	return affectedOne(result, err)
+}
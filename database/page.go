@@ -1,69 +1,270 @@
-package database
-
-import (
-	"database/sql"
-	"time"
-
-	"github.com/annbelievable/go_listing/models"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
-)
-
-func InsertPage(db *sql.DB, page models.Page) error {
-	_, err := db.Exec("INSERT INTO page(title, url, teaser, content, dateupdated, datecreated) VALUES($1, $2, $3, $4, $5, $6);", page.Title, page.Url, page.Teaser, page.Content, time.Now(), time.Now())
-
-	return err
-}
-
-func GetPageById(db *sql.DB, id uint64) (models.Page, error) {
-	row := db.QueryRow("SELECT id, title, url, teaser, content FROM page WHERE id = $1;", id)
-	var page models.Page
-	err := row.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Content)
-
-	if err != nil {
-		return page, err
-	}
-
-	return page, nil
-}
-
-func GetPageByUrl(db *sql.DB, url string) (models.Page, error) {
-	row := db.QueryRow("SELECT title, url, teaser, content FROM page WHERE url = $1;", url)
-	var page models.Page
-	err := row.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Content)
-
-	if err != nil {
-		return page, err
-	}
-
-	return page, nil
-}
-
-func GetPages(db *sql.DB) ([]models.Page, error) {
-	rows, err := db.Query("SELECT id, title, url, teaser, content FROM page ORDER BY url ASC;")
-
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var pages []models.Page
-	for rows.Next() {
-		var page models.Page
-		if err := rows.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Content); err != nil {
-			return pages, err
-		}
-		pages = append(pages, page)
-	}
-
-	return pages, nil
-}
-
-func UpdatePage(db *sql.DB, page models.Page) error {
-	_, err := db.Exec("UPDATE page SET title = $1, url = $2, teaser = $3, content = $4 WHERE id = $5;", page.Title, page.Url, page.Teaser, page.Content, page.Id)
-	return err
-}
-
-func DeletePage(db *sql.DB, id uint64) {
-	db.Exec("DELETE FROM page WHERE id = $1;", id)
-}
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+const pageColumns = "id, title, url, teaser, content, status, version, dateupdated"
+
+func scanPage(row interface{ Scan(...interface{}) error }) (models.Page, error) {
+	var page models.Page
+	err := row.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Content, &page.Status, &page.Version, &page.DateUpdated)
+	return page, err
+}
+
+func InsertPage(ctx context.Context, db Queryer, page models.Page) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if page.Status == "" {
+		page.Status = models.PagePublished
+	}
+
+	var id uint64
+	err := db.QueryRowContext(ctx, "INSERT INTO page(title, url, teaser, content, status, dateupdated, datecreated) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;", page.Title, page.Url, page.Teaser, page.Content, page.Status, time.Now(), time.Now()).Scan(&id)
+
+	return id, mapError(err)
+}
+
+func GetPageById(ctx context.Context, db Queryer, id uint64) (models.Page, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	page, err := scanPage(db.QueryRowContext(ctx, "SELECT "+pageColumns+" FROM page WHERE id = $1 AND datedeleted IS NULL;", id))
+	return page, mapError(err)
+}
+
+func GetPageByUrl(ctx context.Context, db Queryer, url string) (models.Page, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	page, err := scanPage(db.QueryRowContext(ctx, "SELECT "+pageColumns+" FROM page WHERE url = $1 AND datedeleted IS NULL;", url))
+	return page, mapError(err)
+}
+
+func GetPages(ctx context.Context, db Queryer) ([]models.Page, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+pageColumns+" FROM page WHERE datedeleted IS NULL ORDER BY url ASC;")
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var pages []models.Page
+	for rows.Next() {
+		page, err := scanPage(rows)
+		if err != nil {
+			return pages, mapError(err)
+		}
+		pages = append(pages, page)
+	}
+
+	return pages, mapError(rows.Err())
+}
+
+// pageSortKeys are the expressions the sort columns order by. Text is
+// compared byte by byte so the order does not depend on the database locale.
+var pageSortKeys = map[string]string{
+	PageSortTitle:   `lower(title) COLLATE "C"`,
+	PageSortUrl:     `url COLLATE "C"`,
+	PageSortUpdated: "dateupdated",
+	PageSortStatus:  `status COLLATE "C"`,
+}
+
+// FindPages returns a window of the live pages for the admin list. It leaves
+// out the content, which the list does not show.
+func FindPages(ctx context.Context, db Queryer, q PageQuery) (PageList, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	q = q.Normalize()
+	where := []string{"datedeleted IS NULL"}
+	var args []interface{}
+
+	if q.Search != "" {
+		args = append(args, "%"+escapeLike(q.Search)+"%")
+		where = append(where, fmt.Sprintf("(title ILIKE $%d OR url ILIKE $%d)", len(args), len(args)))
+	}
+	if q.Status != "" {
+		args = append(args, q.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	key := pageSortKeys[q.Sort]
+	desc := q.Desc
+	cursor := q.After
+	if q.Before != nil {
+		// read backwards from the cursor, NewPageList turns the rows around
+		cursor = q.Before
+		desc = !desc
+	}
+	if cursor != nil {
+		var value interface{} = cursor.Value
+		param := `$%d COLLATE "C"`
+		if q.Sort == PageSortUpdated {
+			t, err := time.Parse(pageTimeFormat, cursor.Value)
+			if err != nil {
+				return PageList{}, fmt.Errorf("page cursor: %w", err)
+			}
+			value = t
+			param = "$%d"
+		}
+
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		args = append(args, value, cursor.Id)
+		where = append(where, fmt.Sprintf("(%s, id) %s ("+param+", $%d)", key, op, len(args)-1, len(args)))
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	query := fmt.Sprintf("SELECT id, title, url, teaser, status, version, dateupdated FROM page WHERE %s ORDER BY %s %s, id %s LIMIT %d;", strings.Join(where, " AND "), key, dir, dir, q.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return PageList{}, mapError(err)
+	}
+	defer rows.Close()
+
+	var pages []models.Page
+	for rows.Next() {
+		var page models.Page
+		if err := rows.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Status, &page.Version, &page.DateUpdated); err != nil {
+			return PageList{}, mapError(err)
+		}
+		pages = append(pages, page)
+	}
+	if err := rows.Err(); err != nil {
+		return PageList{}, mapError(err)
+	}
+
+	return NewPageList(pages, q), nil
+}
+
+// escapeLike makes the wildcards of a LIKE pattern match themselves.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// CountPages counts the live pages with the status, or all of them when
+// status is empty.
+func CountPages(ctx context.Context, db Queryer, status string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM page WHERE datedeleted IS NULL AND ($1 = '' OR status = $1);", status).Scan(&count)
+	return count, mapError(err)
+}
+
+// LockPageVersion returns the current version of the page and locks its row
+// until the transaction ends.
+func LockPageVersion(ctx context.Context, db Queryer, id uint64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT version FROM page WHERE id = $1 AND datedeleted IS NULL FOR UPDATE;", id).Scan(&version)
+	return version, mapError(err)
+}
+
+// UpdatePage saves the page if it is still at page.Version and bumps the
+// version. It returns ErrConflict when no row matched, which is also the case
+// for a missing page; call LockPageVersion first in the same transaction to
+// tell the two apart.
+func UpdatePage(ctx context.Context, db Queryer, page models.Page) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE page SET title = $1, url = $2, teaser = $3, content = $4, status = $5, dateupdated = $6, version = version + 1 WHERE id = $7 AND version = $8 AND datedeleted IS NULL;", page.Title, page.Url, page.Teaser, page.Content, page.Status, time.Now(), page.Id, page.Version)
+	err = affectedOne(result, err)
+	if errors.Is(err, ErrNotFound) {
+		return &Error{Kind: ErrConflict, Err: sql.ErrNoRows}
+	}
+
+	return err
+}
+
+// TrashPage moves the page to the trash. Trashed pages are left out of every
+// other query and their url is free for a new page.
+func TrashPage(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE page SET datedeleted = $1 WHERE id = $2 AND datedeleted IS NULL;", time.Now(), id)
+	return affectedOne(result, err)
+}
+
+// GetTrashedPages returns the pages in the trash, most recently deleted first.
+func GetTrashedPages(ctx context.Context, db Queryer) ([]models.Page, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, title, url, teaser, status, version, dateupdated, datedeleted FROM page WHERE datedeleted IS NOT NULL ORDER BY datedeleted DESC, id DESC;")
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var pages []models.Page
+	for rows.Next() {
+		var page models.Page
+		if err := rows.Scan(&page.Id, &page.Title, &page.Url, &page.Teaser, &page.Status, &page.Version, &page.DateUpdated, &page.DateDeleted); err != nil {
+			return pages, mapError(err)
+		}
+		pages = append(pages, page)
+	}
+
+	return pages, mapError(rows.Err())
+}
+
+// RestorePage takes the page out of the trash. It fails with
+// ErrUniqueViolation when a live page took its url in the meantime.
+func RestorePage(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE page SET datedeleted = NULL, dateupdated = $1 WHERE id = $2 AND datedeleted IS NOT NULL;", time.Now(), id)
+	return affectedOne(result, err)
+}
+
+// PurgePage deletes a page in the trash for good.
+func PurgePage(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM page WHERE id = $1 AND datedeleted IS NOT NULL;", id)
+	return affectedOne(result, err)
+}
+
+// PurgeTrashedPages deletes the pages that went to the trash before the given
+// time and returns how many there were.
+func PurgeTrashedPages(ctx context.Context, db Queryer, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM page WHERE datedeleted < $1;", before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	n, err := result.RowsAffected()
+	return n, mapError(err)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+)
+
+// Columns a page list can be sorted by.
+const (
+	PageSortTitle   = "title"
+	PageSortUrl     = "url"
+	PageSortUpdated = "updated"
+	PageSortStatus  = "status"
+)
+
+// Page list sizes, the default and the most one window may hold.
+const (
+	DefaultPageLimit = 25
+	MaxPageLimit     = 100
+)
+
+// pageTimeFormat writes dateupdated at the microsecond precision of a
+// TIMESTAMP column, with a fixed width so the values sort as text.
+const pageTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// PageCursor marks a row of a page list by the value it is sorted by and its
+// id, which breaks ties.
+type PageCursor struct {
+	Value string
+	Id    uint64
+}
+
+// PageQuery selects a window of the live pages. Zero values list every page
+// by url.
+type PageQuery struct {
+	// Search matches the title or url, ignoring case.
+	Search string
+	Status string
+	Sort   string
+	Desc   bool
+	// After selects the rows following the cursor, Before the rows
+	// preceding it. At most one is set.
+	After  *PageCursor
+	Before *PageCursor
+	Limit  int
+}
+
+// Normalize fills in the defaults and replaces values out of range.
+func (q PageQuery) Normalize() PageQuery {
+	if _, ok := pageSortKeys[q.Sort]; !ok {
+		q.Sort = PageSortUrl
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit > MaxPageLimit {
+		q.Limit = MaxPageLimit
+	}
+	if q.After != nil && q.Before != nil {
+		q.Before = nil
+	}
+	return q
+}
+
+// PageList is a window of the page list. Next and Prev are the cursors of the
+// neighbouring windows, nil at either end.
+type PageList struct {
+	Pages []models.Page
+	Next  *PageCursor
+	Prev  *PageCursor
+}
+
+// PageSortValue returns what the page is sorted by under sort, the Value of
+// its cursor.
+func PageSortValue(page models.Page, sort string) string {
+	switch sort {
+	case PageSortTitle:
+		return strings.ToLower(page.Title)
+	case PageSortUpdated:
+		return page.DateUpdated.UTC().Format(pageTimeFormat)
+	case PageSortStatus:
+		return page.Status
+	}
+	return page.Url
+}
+
+// NewPageList builds the window from the rows read for q, in the order they
+// were read: at most q.Limit+1 rows, backwards when q.Before is set. The extra
+// row only tells that more rows follow in that direction.
+func NewPageList(rows []models.Page, q PageQuery) PageList {
+	q = q.Normalize()
+
+	more := len(rows) > q.Limit
+	if more {
+		rows = rows[:q.Limit]
+	}
+	if q.Before != nil {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	list := PageList{Pages: rows}
+	if len(rows) == 0 {
+		return list
+	}
+
+	first := &PageCursor{Value: PageSortValue(rows[0], q.Sort), Id: rows[0].Id}
+	last := &PageCursor{Value: PageSortValue(rows[len(rows)-1], q.Sort), Id: rows[len(rows)-1].Id}
+	if q.Before != nil {
+		// the window was reached going back, so rows follow it
+		list.Next = last
+		if more {
+			list.Prev = first
+		}
+	} else {
+		if more {
+			list.Next = last
+		}
+		if q.After != nil {
+			list.Prev = first
+		}
+	}
+
+	return list
+}
+
+// String encodes the cursor for a query string.
+func (c PageCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(c.Id, 10) + ":" + c.Value))
+}
+
+// ParsePageCursor decodes a cursor written by String for a list sorted by
+// sort.
+func ParsePageCursor(s, sort string) (*PageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("page cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("page cursor: no id")
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("page cursor: %w", err)
+	}
+	if sort == PageSortUpdated {
+		if _, err := time.Parse(pageTimeFormat, parts[1]); err != nil {
+			return nil, fmt.Errorf("page cursor: %w", err)
+		}
+	}
+
+	return &PageCursor{Value: parts[1], Id: id}, nil
+}
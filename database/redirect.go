@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func GetRedirect(ctx context.Context, db Queryer, path string) (models.Redirect, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var redirect models.Redirect
+	err := db.QueryRowContext(ctx, "SELECT id, path, target, dateupdated FROM redirect WHERE path = $1;", path).
+		Scan(&redirect.Id, &redirect.Path, &redirect.Target, &redirect.DateUpdated)
+	return redirect, mapError(err)
+}
+
+// SaveRedirect creates the redirect from path, or points the existing one at
+// the new target.
+func SaveRedirect(ctx context.Context, db Queryer, redirect models.Redirect) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO redirect(path, target, dateupdated) VALUES($1, $2, $3) ON CONFLICT (path) DO UPDATE SET target = EXCLUDED.target, dateupdated = EXCLUDED.dateupdated;",
+		redirect.Path, redirect.Target, time.Now())
+	return mapError(err)
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func InsertAdminRememberToken(ctx context.Context, db Queryer, token models.AdminRememberToken) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO admin_remember_token(selector, token_hash, admin_user, expiry_date, user_agent, datecreated) VALUES($1, $2, $3, $4, $5, $6);", token.Selector, token.TokenHash, token.AdminUser, token.ExpiryDate, token.UserAgent, token.DateCreated)
+
+	return mapError(err)
+}
+
+func SelectAdminRememberToken(ctx context.Context, db Queryer, selector string) (models.AdminRememberToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT selector, token_hash, admin_user, expiry_date, user_agent, datecreated FROM admin_remember_token WHERE selector = $1;", selector)
+	var token models.AdminRememberToken
+	err := row.Scan(&token.Selector, &token.TokenHash, &token.AdminUser, &token.ExpiryDate, &token.UserAgent, &token.DateCreated)
+
+	if err != nil {
+		return token, mapError(err)
+	}
+
+	return token, nil
+}
+
+func SelectAdminRememberTokensByAdminId(ctx context.Context, db Queryer, adminId uint64) ([]models.AdminRememberToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT selector, token_hash, admin_user, expiry_date, user_agent, datecreated FROM admin_remember_token WHERE admin_user = $1 AND expiry_date > $2 ORDER BY datecreated DESC;", adminId, time.Now())
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var tokens []models.AdminRememberToken
+	for rows.Next() {
+		var token models.AdminRememberToken
+		if err := rows.Scan(&token.Selector, &token.TokenHash, &token.AdminUser, &token.ExpiryDate, &token.UserAgent, &token.DateCreated); err != nil {
+			return tokens, mapError(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, mapError(rows.Err())
+}
+
+func DeleteAdminRememberToken(ctx context.Context, db Queryer, selector string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM admin_remember_token WHERE selector = $1;", selector)
+	return mapError(err)
+}
+
+func DeleteAdminRememberTokensByAdminId(ctx context.Context, db Queryer, adminId uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM admin_remember_token WHERE admin_user = $1;", adminId)
+	return mapError(err)
+}
+
+// DeleteExpiredAdminRememberTokens removes the tokens that expired before now.
+func DeleteExpiredAdminRememberTokens(ctx context.Context, db Queryer, now time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM admin_remember_token WHERE expiry_date <= $1;", now)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return res.RowsAffected()
+}
@@ -1,49 +1,147 @@
-package database
-
-import (
-	"database/sql"
-	"time"
-
-	"github.com/annbelievable/go_listing/models"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
-)
-
-func InsertAdminSession(db *sql.DB, session_id string, admin_user uint64, expiry_date time.Time) error {
-	_, err := db.Exec("INSERT INTO admin_user_session(session_id, admin_user, expiry_date, datecreated) VALUES($1, $2, $3, $4);", session_id, admin_user, expiry_date, time.Now())
-
-	return err
-}
-
-func SelectAdminSession(db *sql.DB, sessionId string) (models.AdminUserSession, error) {
-	row := db.QueryRow("SELECT session_id, admin_user, expiry_date FROM admin_user_session WHERE session_id = $1;", sessionId)
-	var session models.AdminUserSession
-	err := row.Scan(&session.SessionId, &session.AdminUser, &session.ExpiryDate)
-
-	if err != nil {
-		return session, err
-	}
-
-	return session, nil
-}
-
-func AdminSessionExist(db *sql.DB, session_id string) bool {
-	row := db.QueryRow("SELECT count(*) FROM admin_user_session WHERE session_id = $1;", session_id)
-
-	var count int
-	err := row.Scan(&count)
-
-	if err != nil {
-		return false
-	}
-
-	return count > 0
-}
-
-func DeleteAdminSession(db *sql.DB, session_id string) {
-	db.Exec("DELETE FROM admin_user_session WHERE session_id = $1;", session_id)
-}
-
-func DeleteAdminSessionByAdminId(db *sql.DB, adminId uint64) {
-	db.Exec("DELETE FROM admin_user_session WHERE admin_user = $1;", adminId)
-}
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func InsertAdminSession(ctx context.Context, db Queryer, session_id string, admin_user uint64, expiry_date time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO admin_user_session(session_id, admin_user, expiry_date, datecreated, last_seen) VALUES($1, $2, $3, $4, $4);", session_id, admin_user, expiry_date, time.Now())
+
+	return mapError(err)
+}
+
+// UpsertAdminSession inserts the session, or slides the expiry date and last
+// seen time forward when the session already exists.
+func UpsertAdminSession(ctx context.Context, db Queryer, session models.AdminUserSession) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO admin_user_session(session_id, admin_user, expiry_date, user_agent, ip_address, datecreated, last_seen) VALUES($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (session_id) DO UPDATE SET expiry_date = EXCLUDED.expiry_date, last_seen = EXCLUDED.last_seen;", session.SessionId, session.AdminUser, session.ExpiryDate, session.UserAgent, session.IpAddress, session.DateCreated, session.LastSeen)
+
+	return mapError(err)
+}
+
+func SelectAdminSession(ctx context.Context, db Queryer, sessionId string) (models.AdminUserSession, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT session_id, admin_user, expiry_date, user_agent, ip_address, datecreated, last_seen FROM admin_user_session WHERE session_id = $1;", sessionId)
+	var session models.AdminUserSession
+	err := row.Scan(&session.SessionId, &session.AdminUser, &session.ExpiryDate, &session.UserAgent, &session.IpAddress, &session.DateCreated, &session.LastSeen)
+
+	if err != nil {
+		return session, mapError(err)
+	}
+
+	return session, nil
+}
+
+func SelectAdminSessionsByAdminId(ctx context.Context, db Queryer, adminId uint64) ([]models.AdminUserSession, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT session_id, admin_user, expiry_date, user_agent, ip_address, datecreated, last_seen FROM admin_user_session WHERE admin_user = $1 AND expiry_date > $2 ORDER BY last_seen DESC;", adminId, time.Now())
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var sessions []models.AdminUserSession
+	for rows.Next() {
+		var session models.AdminUserSession
+		if err := rows.Scan(&session.SessionId, &session.AdminUser, &session.ExpiryDate, &session.UserAgent, &session.IpAddress, &session.DateCreated, &session.LastSeen); err != nil {
+			return sessions, mapError(err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, mapError(rows.Err())
+}
+
+// SelectAdminSessions returns the live sessions of all admins, most recently
+// seen first.
+func SelectAdminSessions(ctx context.Context, db Queryer) ([]models.AdminUserSession, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT session_id, admin_user, expiry_date, user_agent, ip_address, datecreated, last_seen FROM admin_user_session WHERE expiry_date > $1 ORDER BY last_seen DESC;", time.Now())
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var sessions []models.AdminUserSession
+	for rows.Next() {
+		var session models.AdminUserSession
+		if err := rows.Scan(&session.SessionId, &session.AdminUser, &session.ExpiryDate, &session.UserAgent, &session.IpAddress, &session.DateCreated, &session.LastSeen); err != nil {
+			return sessions, mapError(err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, mapError(rows.Err())
+}
+
+func AdminSessionExist(ctx context.Context, db Queryer, session_id string) bool {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT count(*) FROM admin_user_session WHERE session_id = $1;", session_id)
+
+	var count int
+	err := row.Scan(&count)
+
+	if err != nil {
+		return false
+	}
+
+	return count > 0
+}
+
+func DeleteAdminSession(ctx context.Context, db Queryer, session_id string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM admin_user_session WHERE session_id = $1;", session_id)
+	return mapError(err)
+}
+
+func DeleteAdminSessionByAdminId(ctx context.Context, db Queryer, adminId uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM admin_user_session WHERE admin_user = $1;", adminId)
+	return mapError(err)
+}
+
+// DeleteExpiredAdminSessions removes the sessions that expired before now.
+func DeleteExpiredAdminSessions(ctx context.Context, db Queryer, now time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM admin_user_session WHERE expiry_date <= $1;", now)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return res.RowsAffected()
+}
+
+func CountActiveAdminSessions(ctx context.Context, db Queryer) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM admin_user_session WHERE expiry_date > $1;", time.Now()).Scan(&count)
+	return count, mapError(err)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// InsertApiToken creates the token and returns its id.
+func InsertApiToken(ctx context.Context, db Queryer, token models.ApiToken) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var id uint64
+	err := db.QueryRowContext(ctx, "INSERT INTO api_token(admin_user, name, token_hash, scopes, expiry_date, datecreated) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;", token.AdminUser, token.Name, token.TokenHash, token.Scopes, token.ExpiryDate, time.Now()).Scan(&id)
+
+	return id, mapError(err)
+}
+
+func SelectApiTokenByHash(ctx context.Context, db Queryer, hash string) (models.ApiToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := db.QueryRowContext(ctx, "SELECT t.id, t.admin_user, TRIM(a.email), t.name, t.token_hash, t.scopes, t.expiry_date, t.last_used, t.datecreated FROM api_token t JOIN admin_user a ON a.id = t.admin_user WHERE t.token_hash = $1;", hash)
+	var token models.ApiToken
+	err := row.Scan(&token.Id, &token.AdminUser, &token.AdminEmail, &token.Name, &token.TokenHash, &token.Scopes, &token.ExpiryDate, &token.LastUsed, &token.DateCreated)
+
+	if err != nil {
+		return token, mapError(err)
+	}
+
+	return token, nil
+}
+
+func SelectApiTokens(ctx context.Context, db Queryer) ([]models.ApiToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT t.id, t.admin_user, TRIM(a.email), t.name, t.token_hash, t.scopes, t.expiry_date, t.last_used, t.datecreated FROM api_token t JOIN admin_user a ON a.id = t.admin_user ORDER BY t.datecreated DESC;")
+
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var tokens []models.ApiToken
+	for rows.Next() {
+		var token models.ApiToken
+		if err := rows.Scan(&token.Id, &token.AdminUser, &token.AdminEmail, &token.Name, &token.TokenHash, &token.Scopes, &token.ExpiryDate, &token.LastUsed, &token.DateCreated); err != nil {
+			return tokens, mapError(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, mapError(rows.Err())
+}
+
+func UpdateApiTokenLastUsed(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "UPDATE api_token SET last_used = $1 WHERE id = $2;", time.Now(), id)
+	return mapError(err)
+}
+
+func DeleteApiToken(ctx context.Context, db Queryer, id uint64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM api_token WHERE id = $1;", id)
+	return affectedOne(result, err)
+}
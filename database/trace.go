@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/annbelievable/go_listing/tracing"
+)
+
+// maxStatementLength keeps long statements from bloating the spans.
+const maxStatementLength = 2000
+
+// tracedConnector wraps the pgx connector so every statement run through the
+// pool gets a client span, whichever package issues it.
+type tracedConnector struct {
+	driver.Connector
+	database string
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, database: c.database}, nil
+}
+
+// tracedConn forwards to the pgx connection. Every optional interface pgx
+// implements is forwarded as well, otherwise database/sql would fall back to
+// slower or different code paths.
+type tracedConn struct {
+	driver.Conn
+	database string
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	_, span := c.start(ctx, query)
+	defer span.End()
+
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != nil {
+		span.RecordError(err)
+	} else if n, rerr := result.RowsAffected(); rerr == nil {
+		span.SetAttributes("db.rows_affected", n)
+	}
+	return result, err
+}
+
+// QueryContext times the query until the first rows arrive. Reading the rows
+// is left out of the span.
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	_, span := c.start(ctx, query)
+	defer span.End()
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) start(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	operation := statementOperation(query)
+	ctx, span := tracing.Start(ctx, operation, tracing.KindClient)
+
+	statement := query
+	if len(statement) > maxStatementLength {
+		statement = statement[:maxStatementLength]
+	}
+	span.SetAttributes(
+		"db.system", "postgresql",
+		"db.name", c.database,
+		"db.operation", operation,
+		"db.statement", statement,
+	)
+	return ctx, span
+}
+
+// statementOperation returns the first keyword of the statement, e.g. SELECT.
+func statementOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], ";"))
+}
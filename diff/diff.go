@@ -0,0 +1,105 @@
+// Package diff compares two texts line by line.
+package diff
+
+import "strings"
+
+// Op says where a line of the diff comes from.
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Delete Op = "delete"
+	Insert Op = "insert"
+)
+
+// Line is a line of a diff. Delete lines are only in the text before, Insert
+// lines only in the text after.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells bounds the table of the longest common subsequence. Texts too long
+// for it are shown as entirely replaced.
+const maxCells = 4 << 20
+
+// Lines returns the diff turning before into after, based on their longest common
+// subsequence of lines. Windows line endings count as plain ones.
+func Lines(before, after string) []Line {
+	a := split(before)
+	b := split(after)
+
+	if len(a)*len(b) > maxCells {
+		return replaced(a, b)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []Line
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, Line{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Insert, b[j]})
+	}
+
+	return lines
+}
+
+// Changed reports whether lines holds anything but equal lines.
+func Changed(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+func replaced(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a {
+		lines = append(lines, Line{Delete, text})
+	}
+	for _, text := range b {
+		lines = append(lines, Line{Insert, text})
+	}
+	return lines
+}
@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []Line
+	}{
+		{"empty", "", "", nil},
+		{"same", "a\nb", "a\r\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"added", "", "a", []Line{{Insert, "a"}}},
+		{"removed", "a", "", []Line{{Delete, "a"}}},
+		{
+			"changed line",
+			"one\ntwo\nthree",
+			"one\n2\nthree",
+			[]Line{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}},
+		},
+		{
+			"moved line",
+			"a\nb\nc",
+			"b\nc\na",
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Lines(test.before, test.after)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			if Changed(got) != (test.before != test.after && test.name != "same") {
+				t.Fatalf("Changed(%v) = %v", got, Changed(got))
+			}
+		})
+	}
+}
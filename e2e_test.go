@@ -0,0 +1,1720 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annbelievable/go_listing/apitoken"
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/media"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/oidc"
+	"github.com/annbelievable/go_listing/oidc/oidctest"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/repository/repositorytest"
+	"github.com/annbelievable/go_listing/tabular"
+	"github.com/annbelievable/go_listing/wordpress"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// testRequestId is sent with every request so error pages render the same
+// id each run.
+const testRequestId = "e2e-test"
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	quiet, err := logger.New(io.Discard, logger.LevelError, "text")
+	if err != nil {
+		panic(err)
+	}
+	logger.SetDefault(quiet)
+
+	templates, err = template.ParseGlob(templateGlob)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testSite is the whole site behind an httptest server, over the in-memory
+// repositories or the database in repositorytest.EnvDatabaseURL. Its client
+// keeps cookies and does not follow redirects.
+type testSite struct {
+	t      *testing.T
+	repos  repository.Repositories
+	app    *server
+	server *httptest.Server
+	client *http.Client
+}
+
+func newTestSite(t *testing.T) *testSite {
+	t.Helper()
+	return newTestSiteWithSessions(t, config.Default().Session)
+}
+
+// newTestSiteWithSessions is a test site keeping its sessions as cfg says.
+func newTestSiteWithSessions(t *testing.T, cfg config.Session) *testSite {
+	t.Helper()
+
+	repos := repository.NewMemory()
+	if db := repositorytest.OpenPostgres(t); db != nil {
+		repositorytest.Reset(t, db)
+		repos = repository.NewPostgres(db)
+	}
+
+	sessions, err := newSessionManager(cfg, repos.Sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newServer(repos, sessions)
+	server := httptest.NewServer(app.newHandler())
+	t.Cleanup(server.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &testSite{t: t, repos: repos, app: app, server: server, client: client}
+}
+
+// newAdminSite is a test site with an admin logged in.
+func newAdminSite(t *testing.T) *testSite {
+	t.Helper()
+
+	site := newTestSite(t)
+	site.register("admin@example.com", "secret")
+	site.login("admin@example.com", "secret", false)
+	return site
+}
+
+func (s *testSite) do(req *http.Request) (*http.Response, string) {
+	s.t.Helper()
+
+	req.Header.Set("X-Request-ID", testRequestId)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return resp, string(body)
+}
+
+func (s *testSite) get(path string) (*http.Response, string) {
+	s.t.Helper()
+
+	req, err := http.NewRequest("GET", s.server.URL+path, nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return s.do(req)
+}
+
+func (s *testSite) post(path string, form url.Values) (*http.Response, string) {
+	s.t.Helper()
+
+	req, err := http.NewRequest("POST", s.server.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// upload posts a file as the field "file" of a multipart form.
+func (s *testSite) upload(path string, form url.Values, fileName, content string) (*http.Response, string) {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for key, values := range form {
+		for _, value := range values {
+			mw.WriteField(key, value)
+		}
+	}
+	if fileName != "" {
+		fw, err := mw.CreateFormFile("file", fileName)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	if err := mw.Close(); err != nil {
+		s.t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", s.server.URL+path, &body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return s.do(req)
+}
+
+func (s *testSite) cookie(name string) *http.Cookie {
+	u, _ := url.Parse(s.server.URL)
+	for _, c := range s.client.Jar.Cookies(u) {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *testSite) dropCookie(name string) {
+	u, _ := url.Parse(s.server.URL)
+	s.client.Jar.SetCookies(u, []*http.Cookie{{Name: name, Value: "", Path: "/", MaxAge: -1}})
+}
+
+func (s *testSite) register(email, password string) {
+	s.t.Helper()
+
+	resp, _ := s.post("/admin-register", url.Values{"email": {email}, "password": {password}})
+	expectRedirect(s.t, resp, "/admin-login")
+}
+
+func (s *testSite) login(email, password string, remember bool) {
+	s.t.Helper()
+
+	form := url.Values{"email": {email}, "password": {password}}
+	if remember {
+		form.Set("remember", "on")
+	}
+	resp, _ := s.post("/admin-login", form)
+	expectRedirect(s.t, resp, "/admin-homepage")
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: status %d, want %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status)
+	}
+}
+
+func expectRedirect(t *testing.T, resp *http.Response, location string) {
+	t.Helper()
+	expectStatus(t, resp, http.StatusFound)
+	if got := resp.Header.Get("Location"); got != location {
+		t.Fatalf("%s %s: redirected to %q, want %q", resp.Request.Method, resp.Request.URL.Path, got, location)
+	}
+}
+
+func expectContains(t *testing.T, body, want string) {
+	t.Helper()
+	// the templates may be checked out with CRLF line endings
+	if !strings.Contains(strings.ReplaceAll(body, "\r\n", "\n"), want) {
+		t.Fatalf("body does not contain %q:\n%s", want, body)
+	}
+}
+
+var goldenDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}`)
+
+// exportDate matches the dates in exports.
+var exportDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z`)
+
+// expectGolden compares body with testdata/golden/name.html. Run the tests
+// with -update to accept a change to the templates.
+func expectGolden(t *testing.T, name, body string) {
+	t.Helper()
+
+	// dates change from run to run
+	body = goldenDate.ReplaceAllString(body, "YYYY-MM-DD hh:mm")
+
+	path := filepath.Join("testdata", "golden", name+".html")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create it", err)
+	}
+	// the templates and golden files may be checked out with CRLF line endings
+	if strings.ReplaceAll(body, "\r\n", "\n") != strings.ReplaceAll(string(want), "\r\n", "\n") {
+		t.Fatalf("%s does not match %s, run the tests with -update if the change is intended:\n%s", name, path, body)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	site := newTestSite(t)
+
+	resp, body := site.get("/admin-register")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "admin_register", body)
+
+	site.register("admin@example.com", "secret")
+	admin, err := site.repos.Admins.GetByEmail(context.Background(), "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Password == "secret" {
+		t.Fatal("the password was stored in the clear")
+	}
+
+	resp, body = site.post("/admin-register", url.Values{"email": {"admin@example.com"}, "password": {"other"}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectGolden(t, "admin_register_taken", body)
+
+	resp, body = site.post("/admin-register", url.Values{"email": {"not an email"}, "password": {""}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectGolden(t, "admin_register_invalid", body)
+}
+
+func TestLogin(t *testing.T) {
+	site := newTestSite(t)
+	site.register("admin@example.com", "secret")
+
+	resp, body := site.get("/admin-login")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "admin_login", body)
+
+	resp, body = site.post("/admin-login", url.Values{"email": {"admin@example.com"}, "password": {"wrong"}})
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "admin_login_failed", body)
+	if site.cookie("session_id") != nil {
+		t.Fatal("a failed login set a session cookie")
+	}
+
+	resp, _ = site.get("/admin-sessions")
+	expectRedirect(t, resp, "/admin-login")
+
+	site.login("admin@example.com", "secret", false)
+	if site.cookie("session_id") == nil {
+		t.Fatal("login did not set the session cookie")
+	}
+
+	resp, body = site.get("/admin-homepage")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "admin_homepage", body)
+
+	resp, _ = site.get("/admin-login")
+	expectRedirect(t, resp, "/admin-homepage")
+
+	resp, body = site.get("/admin-sessions")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Your Sessions")
+}
+
+// newSSOSite is a test site logging admins in through an oidctest provider.
+func newSSOSite(t *testing.T, roleMap map[string]string, autoCreate bool) (*testSite, *oidctest.Provider) {
+	t.Helper()
+
+	provider := oidctest.NewProvider("go-listing", "client-secret")
+	t.Cleanup(provider.Close)
+
+	site := newTestSite(t)
+	site.app.sso = ssoSettings{
+		Config: oidc.Config{
+			Issuer:       provider.Issuer(),
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  site.server.URL + "/admin-login/sso/callback",
+			Scopes:       []string{"email", "profile"},
+		},
+		RoleMap:    roleMap,
+		AutoCreate: autoCreate,
+	}
+	return site, provider
+}
+
+// ssoAuthorize starts an SSO login and returns the url the provider sends
+// the browser back to.
+func (s *testSite) ssoAuthorize(tamper func(url.Values)) string {
+	s.t.Helper()
+
+	resp, _ := s.get("/admin-login/sso")
+	expectStatus(s.t, resp, http.StatusFound)
+	authorize, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if tamper != nil {
+		q := authorize.Query()
+		tamper(q)
+		authorize.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest("GET", authorize.String(), nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp, _ = s.do(req)
+	expectStatus(s.t, resp, http.StatusFound)
+	return strings.TrimPrefix(resp.Header.Get("Location"), s.server.URL)
+}
+
+// ssoLogin runs a whole SSO login and returns the callback's answer.
+func (s *testSite) ssoLogin() (*http.Response, string) {
+	s.t.Helper()
+	return s.get(s.ssoAuthorize(nil))
+}
+
+func TestSSOLogin(t *testing.T) {
+	site, provider := newSSOSite(t, nil, true)
+	provider.SetUser(oidctest.User{Subject: "1", Email: "admin@example.com", EmailVerified: true})
+
+	resp, _ := site.ssoLogin()
+	expectRedirect(t, resp, "/admin-homepage")
+	if site.cookie("session_id") == nil {
+		t.Fatal("the SSO login did not set the session cookie")
+	}
+	if site.cookie(ssoStateCookie) != nil {
+		t.Fatal("the state cookie outlived the login")
+	}
+
+	admin, err := site.repos.Admins.GetByEmail(context.Background(), "admin@example.com")
+	if err != nil || admin.Role != models.RoleAdmin {
+		t.Fatalf("the created admin is %+v, %v", admin, err)
+	}
+}
+
+func TestSSOStateAndNonce(t *testing.T) {
+	site, provider := newSSOSite(t, nil, true)
+	provider.SetUser(oidctest.User{Subject: "1", Email: "admin@example.com", EmailVerified: true})
+
+	callback := site.ssoAuthorize(func(q url.Values) { q.Set("state", "forged") })
+	resp, body := site.get(callback)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Login failed.")
+
+	callback = site.ssoAuthorize(func(q url.Values) { q.Set("nonce", "replayed") })
+	resp, body = site.get(callback)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Login failed.")
+
+	// the callback only works once, with the cookie of the login it ends
+	callback = site.ssoAuthorize(nil)
+	resp, _ = site.get(callback)
+	expectRedirect(t, resp, "/admin-homepage")
+	site.dropCookie("session_id")
+	resp, body = site.get(callback)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Login session expired, please try again.")
+
+	if site.cookie("session_id") != nil {
+		t.Fatal("a failed login set a session cookie")
+	}
+}
+
+func TestSSOEmailVerified(t *testing.T) {
+	site, provider := newSSOSite(t, nil, true)
+	site.register("admin@example.com", "secret")
+
+	for _, user := range []oidctest.User{
+		{Subject: "1", Email: "admin@example.com", OmitEmailVerified: true},
+		{Subject: "1", Email: "admin@example.com", EmailVerified: false},
+	} {
+		provider.SetUser(user)
+		resp, body := site.ssoLogin()
+		expectStatus(t, resp, http.StatusOK)
+		expectContains(t, body, "Your account is not allowed to access the admin.")
+		if site.cookie("session_id") != nil {
+			t.Fatalf("%+v logged in", user)
+		}
+	}
+}
+
+func TestSSORoleMap(t *testing.T) {
+	site, provider := newSSOSite(t, map[string]string{"cms-admins": models.RoleAdmin, "cms-editors": models.RoleEditor}, true)
+	ctx := context.Background()
+
+	provider.SetUser(oidctest.User{Subject: "1", Email: "staff@example.com", EmailVerified: true, Groups: []string{"staff"}})
+	resp, body := site.ssoLogin()
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Your account is not allowed to access the admin.")
+	if _, err := site.repos.Admins.GetByEmail(ctx, "staff@example.com"); err == nil {
+		t.Fatal("a user without a mapped group was created")
+	}
+
+	provider.SetUser(oidctest.User{Subject: "2", Email: "editor@example.com", EmailVerified: true, Groups: []string{"staff", "cms-editors"}})
+	resp, _ = site.ssoLogin()
+	expectRedirect(t, resp, "/admin-homepage")
+	admin, err := site.repos.Admins.GetByEmail(ctx, "editor@example.com")
+	if err != nil || admin.Role != models.RoleEditor {
+		t.Fatalf("the created admin is %+v, %v", admin, err)
+	}
+	resp, _ = site.get("/audit-log")
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	provider.SetUser(oidctest.User{Subject: "2", Email: "editor@example.com", EmailVerified: true, Groups: []string{"cms-editors", "cms-admins"}})
+	resp, _ = site.ssoLogin()
+	expectRedirect(t, resp, "/admin-homepage")
+	resp, _ = site.get("/audit-log")
+	expectStatus(t, resp, http.StatusOK)
+
+	entries, err := site.repos.Audit.List(ctx, repository.AuditFilter{EntityType: "admin_user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audited []string
+	for _, entry := range entries {
+		if entry.Action == "admin.role_change" || entry.Action == "admin.login_failed" {
+			audited = append(audited, entry.Action+" "+entry.ActorEmail)
+		}
+	}
+	want := "admin.role_change editor@example.com admin.login_failed staff@example.com"
+	if strings.Join(audited, " ") != want {
+		t.Fatalf("audited %v, want %s", audited, want)
+	}
+}
+
+func TestSSOWithoutAutoCreate(t *testing.T) {
+	site, provider := newSSOSite(t, nil, false)
+	site.register("admin@example.com", "secret")
+
+	provider.SetUser(oidctest.User{Subject: "1", Email: "stranger@example.com", EmailVerified: true})
+	resp, body := site.ssoLogin()
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "Your account is not allowed to access the admin.")
+	if _, err := site.repos.Admins.GetByEmail(context.Background(), "stranger@example.com"); err == nil {
+		t.Fatal("an unknown user was created with AutoCreate off")
+	}
+
+	provider.SetUser(oidctest.User{Subject: "2", Email: "admin@example.com", EmailVerified: true})
+	resp, _ = site.ssoLogin()
+	expectRedirect(t, resp, "/admin-homepage")
+}
+
+func TestSessionRefresh(t *testing.T) {
+	site := newTestSite(t)
+	site.register("admin@example.com", "secret")
+	site.login("admin@example.com", "secret", false)
+	ctx := context.Background()
+
+	token := site.cookie("session_id").Value
+	stored, err := site.repos.Sessions.Load(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend the admin has been idle, the next request slides the expiry
+	stored.LastSeen = time.Now().Add(-10 * time.Minute)
+	stored.ExpiryDate = time.Now().Add(time.Minute)
+	if _, err := site.repos.Sessions.Save(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := site.get("/admin-sessions")
+	expectStatus(t, resp, http.StatusOK)
+
+	refreshed, err := site.repos.Sessions.Load(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refreshed.ExpiryDate.After(time.Now().Add(10 * time.Minute)) {
+		t.Fatalf("the expiry was not slid forward: %v", refreshed.ExpiryDate)
+	}
+
+	var refreshedCookie bool
+	for _, c := range resp.Cookies() {
+		if c.Name == "session_id" {
+			refreshedCookie = true
+		}
+	}
+	if !refreshedCookie {
+		t.Fatal("the session cookie was not sent again")
+	}
+}
+
+// TestCookieSessions checks the sessions page with a store that cannot list
+// or revoke sessions.
+func TestCookieSessions(t *testing.T) {
+	cfg := config.Default().Session
+	cfg.Store = "cookie"
+	cfg.Secret = strings.Repeat("s", 32)
+	site := newTestSiteWithSessions(t, cfg)
+	site.register("admin@example.com", "secret")
+	site.login("admin@example.com", "secret", false)
+
+	resp, body := site.get("/admin-sessions")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "not supported by this session store")
+
+	resp, body = site.post("/admin-sessions/revoke", url.Values{"session": {"abc"}})
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "not supported by this session store")
+
+	resp, body = site.post("/admin-sessions/revoke-others", nil)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "not supported by this session store")
+
+	resp, _ = site.post("/admin-sessions/forget", url.Values{"selector": {"abc"}})
+	expectRedirect(t, resp, "/admin-sessions")
+
+	resp, _ = site.get("/admin-homepage")
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestRememberMe(t *testing.T) {
+	site := newTestSite(t)
+	site.register("admin@example.com", "secret")
+	site.login("admin@example.com", "secret", true)
+
+	if site.cookie("session_id_remember") == nil {
+		t.Fatal("login did not set the remember-me cookie")
+	}
+	old := site.cookie("session_id").Value
+
+	// the browser was closed, only the remember-me cookie is left
+	site.dropCookie("session_id")
+
+	resp, _ := site.get("/admin-sessions")
+	expectStatus(t, resp, http.StatusOK)
+
+	c := site.cookie("session_id")
+	if c == nil || c.Value == old {
+		t.Fatal("the session was not resumed with a new id")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	site := newTestSite(t)
+	site.register("admin@example.com", "secret")
+	site.login("admin@example.com", "secret", false)
+	token := site.cookie("session_id").Value
+
+	resp, _ := site.post("/admin-logout", nil)
+	expectRedirect(t, resp, "/")
+
+	if site.cookie("session_id") != nil {
+		t.Fatal("logout did not clear the session cookie")
+	}
+
+	ctx := context.Background()
+	if _, err := site.repos.Sessions.Load(ctx, token); err == nil {
+		t.Fatal("the session is still stored")
+	}
+
+	resp, _ = site.get("/admin-sessions")
+	expectRedirect(t, resp, "/admin-login")
+}
+
+func TestPages(t *testing.T) {
+	site := newAdminSite(t)
+
+	resp, body := site.get("/page")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "create_page", body)
+
+	resp, _ = site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}, "teaser": {"Who we are"}, "content": {"Hello"}})
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.post("/page", url.Values{"url": {"/contact"}, "title": {"Contact"}})
+	expectRedirect(t, resp, "/pages")
+
+	resp, body = site.get("/pages")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "pages", body)
+
+	resp, body = site.post("/page", url.Values{"url": {"/about"}, "title": {"About again"}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectGolden(t, "create_page_duplicate", body)
+
+	resp, body = site.post("/page", url.Values{"url": {"about us"}, "title": {" "}, "teaser": {strings.Repeat("x", 256)}, "content": {"Kept"}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectGolden(t, "create_page_invalid", body)
+
+	resp, body = site.get("/update-page/1")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "update_page", body)
+
+	resp, _ = site.post("/update-page/1", url.Values{"url": {"/about-us"}, "title": {"About us"}, "teaser": {"Who we are"}, "content": {"Hello"}, "status": {"published"}, "version": {"1"}})
+	expectRedirect(t, resp, "/pages")
+
+	ctx := context.Background()
+	page, err := site.repos.Pages.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Page{Id: 1, Url: "/about-us", Title: "About us", Teaser: "Who we are", Content: "Hello", Status: models.PagePublished, Version: 2, DateUpdated: page.DateUpdated}
+	if page != want {
+		t.Fatalf("stored %+v, want %+v", page, want)
+	}
+
+	resp, _ = site.post("/update-page/1", url.Values{"url": {"/contact"}, "title": {"About us"}, "status": {"published"}, "version": {"2"}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+
+	resp, _ = site.post("/update-page/1", url.Values{"url": {"/about-us"}, "title": {"About us"}})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp, _ = site.get("/update-page/99")
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, _ = site.post("/update-page/99", url.Values{"url": {"/x"}, "title": {"X"}, "version": {"1"}})
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestPageConflict(t *testing.T) {
+	site := newAdminSite(t)
+
+	resp, _ := site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}, "content": {"one\ntwo\nthree"}})
+	expectRedirect(t, resp, "/pages")
+
+	// two editors open version 1, the first one saves
+	resp, _ = site.post("/update-page/1", url.Values{"url": {"/about"}, "title": {"About"}, "content": {"one\n2\nthree"}, "status": {"published"}, "version": {"1"}})
+	expectRedirect(t, resp, "/pages")
+
+	resp, body := site.post("/update-page/1", url.Values{"url": {"/about"}, "title": {"About us"}, "content": {"one\ntwo\nthree\nfour"}, "status": {"published"}, "version": {"1"}})
+	expectStatus(t, resp, http.StatusConflict)
+	expectGolden(t, "page_conflict", body)
+
+	ctx := context.Background()
+	page, err := site.repos.Pages.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "About" || page.Version != 2 {
+		t.Fatalf("the losing save changed the page: %+v", page)
+	}
+
+	// sending the conflict form again saves over the first editor
+	resp, _ = site.post("/update-page/1", url.Values{"url": {"/about"}, "title": {"About us"}, "content": {"one\ntwo\nthree\nfour"}, "status": {"published"}, "version": {"2"}})
+	expectRedirect(t, resp, "/pages")
+	page, err = site.repos.Pages.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "About us" || page.Version != 3 {
+		t.Fatalf("stored %+v after resolving the conflict", page)
+	}
+}
+
+func TestPagesList(t *testing.T) {
+	site := newAdminSite(t)
+
+	for i := 1; i <= 27; i++ {
+		status := models.PagePublished
+		if i%3 == 0 {
+			status = models.PageDraft
+		}
+		_, err := site.repos.Pages.Create(context.Background(), models.Page{Url: fmt.Sprintf("/p%02d", i), Title: fmt.Sprintf("Page %d", i), Content: "secret body", Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, body := site.get("/pages")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "pages_first", body)
+	if strings.Contains(body, "secret body") {
+		t.Fatal("the list shows the content")
+	}
+
+	next := regexp.MustCompile(`<a href="([^"]+)">Next</a>`).FindStringSubmatch(body)
+	if next == nil {
+		t.Fatal("the first window has no next link")
+	}
+	resp, body = site.get(html.UnescapeString(next[1]))
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "/p26")
+	expectContains(t, body, "/p27")
+	if strings.Contains(body, "/p25<") || strings.Contains(body, ">Next</a>") {
+		t.Fatalf("the second window is wrong:\n%s", body)
+	}
+
+	prev := regexp.MustCompile(`<a href="([^"]+)">Previous</a>`).FindStringSubmatch(body)
+	if prev == nil {
+		t.Fatal("the second window has no previous link")
+	}
+	resp, body = site.get(html.UnescapeString(prev[1]))
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "/p01")
+	expectContains(t, body, "/p25")
+
+	resp, body = site.get("/pages?q=page+1&status=draft&sort=title&dir=desc")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "pages_filtered", body)
+
+	// edited links fall back to the defaults
+	resp, _ = site.get("/pages?sort=content&status=gone&after=garbage")
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestPageTrash(t *testing.T) {
+	site := newAdminSite(t)
+
+	resp, _ := site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}})
+	expectRedirect(t, resp, "/pages")
+
+	resp, body := site.get("/delete-page/1")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "delete_page", body)
+
+	resp, _ = site.post("/delete-page/1", nil)
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.get("/update-page/1")
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, _ = site.post("/delete-page/1", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp, body = site.get("/trash")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, `<form method="POST" action="/trash/1/restore">`)
+
+	// the url of a trashed page is free, and restoring waits until it is again
+	resp, _ = site.post("/page", url.Values{"url": {"/about"}, "title": {"New about"}})
+	expectRedirect(t, resp, "/pages")
+	resp, body = site.post("/trash/1/restore", nil)
+	expectStatus(t, resp, http.StatusConflict)
+	expectContains(t, body, "another page uses /about now")
+
+	resp, _ = site.post("/delete-page/2", nil)
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.post("/trash/1/restore", nil)
+	expectRedirect(t, resp, "/trash")
+	page, err := site.repos.Pages.GetByUrl(context.Background(), "/about")
+	if err != nil || page.Id != 1 {
+		t.Fatalf("after restoring /about is %+v, %v", page, err)
+	}
+
+	resp, body = site.get("/trash/2/purge")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "purge_page", body)
+	resp, _ = site.post("/trash/2/purge", nil)
+	expectRedirect(t, resp, "/trash")
+	resp, _ = site.get("/trash/2/purge")
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, _ = site.post("/trash/1/purge", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	entries, err := site.repos.Audit.List(context.Background(), repository.AuditFilter{EntityType: "page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	want := "page.purge page.restore page.delete page.create page.delete page.create"
+	if strings.Join(actions, " ") != want {
+		t.Fatalf("audited %v, want %s", actions, want)
+	}
+}
+
+// TestAdminRoutesNeedLogin checks that a visitor without a session is sent to
+// the login page and changes nothing.
+func TestAdminRoutesNeedLogin(t *testing.T) {
+	site := newAdminSite(t)
+	ctx := context.Background()
+
+	resp, _ := site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}})
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.post("/page", url.Values{"url": {"/gone"}, "title": {"Gone"}})
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.post("/delete-page/2", nil)
+	expectRedirect(t, resp, "/pages")
+	if _, err := site.repos.Listings.Create(ctx, models.Listing{Url: "/flat", Title: "Flat"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = site.post("/pages/bulk", url.Values{"action": {"unpublish"}, "id": {"1"}})
+	task := strings.TrimPrefix(resp.Header.Get("Location"), "/bulk/")
+	if task == "" {
+		t.Fatal("the bulk action did not start")
+	}
+	resp, _ = site.upload("/import", url.Values{"kind": {"pages"}}, "pages.csv", "url,title\n/about,Taken\n")
+	upload := strings.TrimPrefix(resp.Header.Get("Location"), "/import/")
+	if upload == "" {
+		t.Fatal("the upload was not stored")
+	}
+	site.dropCookie("session_id")
+
+	routes := []struct {
+		method, path string
+		form         url.Values
+	}{
+		{"GET", "/page", nil},
+		{"POST", "/page", url.Values{"url": {"/new"}, "title": {"New"}}},
+		{"GET", "/pages", nil},
+		{"GET", "/update-page/1", nil},
+		{"POST", "/update-page/1", url.Values{"url": {"/about"}, "title": {"Taken"}, "version": {"1"}}},
+		{"GET", "/delete-page/1", nil},
+		{"POST", "/delete-page/1", nil},
+		{"GET", "/trash", nil},
+		{"POST", "/trash/2/restore", nil},
+		{"GET", "/trash/2/purge", nil},
+		{"POST", "/trash/2/purge", nil},
+		{"POST", "/pages/bulk", url.Values{"action": {"delete"}, "id": {"1"}}},
+		{"GET", "/listings", nil},
+		{"POST", "/listings/bulk", url.Values{"action": {"delete"}, "id": {"1"}}},
+		{"GET", "/bulk/" + task, nil},
+		{"GET", "/export/pages?format=csv", nil},
+		{"GET", "/export/listings?format=jsonl", nil},
+		{"GET", "/import", nil},
+		{"POST", "/import", url.Values{"kind": {"pages"}}},
+		{"GET", "/import/" + upload, nil},
+		{"POST", "/import/" + upload, url.Values{"map_url": {"url"}, "map_title": {"title"}, "key": {"url"}, "mode": {"import"}}},
+		{"GET", "/feeds", nil},
+		{"POST", "/feeds/partner/run", nil},
+	}
+	for _, route := range routes {
+		var resp *http.Response
+		if route.method == "GET" {
+			resp, _ = site.get(route.path)
+		} else {
+			resp, _ = site.post(route.path, route.form)
+		}
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/admin-login" {
+			t.Errorf("%s %s answered %d to %q, want a redirect to /admin-login", route.method, route.path, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	page, err := site.repos.Pages.Get(ctx, 1)
+	if err != nil || page.Title != "About" {
+		t.Fatalf("page 1 is %+v, %v", page, err)
+	}
+	trashed, err := site.repos.Pages.ListTrash(ctx)
+	if err != nil || len(trashed) != 1 {
+		t.Fatalf("the trash has %+v, %v", trashed, err)
+	}
+	if _, err := site.repos.Pages.GetByUrl(ctx, "/new"); err == nil {
+		t.Fatal("an anonymous request created a page")
+	}
+	if _, err := site.repos.Listings.Get(ctx, 1); err != nil {
+		t.Fatalf("listing 1: %v", err)
+	}
+}
+
+// TestEditorRole checks that an editor works on the content but is refused
+// the routes reserved to admins.
+func TestEditorRole(t *testing.T) {
+	site := newTestSite(t)
+	ctx := context.Background()
+
+	site.register("editor@example.com", "secret")
+	editor, err := site.repos.Admins.GetByEmail(ctx, "editor@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := site.repos.Admins.UpdateRole(ctx, editor.Id, models.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	site.login("editor@example.com", "secret", false)
+
+	resp, _ := site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}})
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.post("/delete-page/1", nil)
+	expectRedirect(t, resp, "/pages")
+	resp, _ = site.get("/trash")
+	expectStatus(t, resp, http.StatusOK)
+
+	routes := []struct {
+		method, path string
+	}{
+		{"GET", "/trash/1/purge"},
+		{"POST", "/trash/1/purge"},
+		{"GET", "/export/pages?format=csv"},
+		{"GET", "/import"},
+		{"GET", "/feeds"},
+		{"POST", "/feeds/partner/run"},
+		{"GET", "/audit-log"},
+		{"GET", "/audit-log.csv"},
+		{"GET", "/api-tokens"},
+		{"POST", "/api-tokens"},
+	}
+	for _, route := range routes {
+		var resp *http.Response
+		if route.method == "GET" {
+			resp, _ = site.get(route.path)
+		} else {
+			resp, _ = site.post(route.path, nil)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s answered %d to an editor, want %d", route.method, route.path, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	trashed, err := site.repos.Pages.ListTrash(ctx)
+	if err != nil || len(trashed) != 1 {
+		t.Fatalf("the trash has %+v, %v", trashed, err)
+	}
+
+	// the results of a task are for those who may start it
+	noop := func(ctx context.Context, item string) (string, error) { return item, nil }
+	for name, status := range map[string]int{
+		"page.bulk_publish": http.StatusOK,
+		"page.import":       http.StatusUnauthorized,
+		"listing.import":    http.StatusUnauthorized,
+		"feed.run":          http.StatusUnauthorized,
+	} {
+		id := site.app.tasks.Run(ctx, name, []string{"1"}, noop, nil)
+		resp, _ := site.get("/bulk/" + id)
+		if resp.StatusCode != status {
+			t.Errorf("GET /bulk/%s of %s answered %d to an editor, want %d", id, name, resp.StatusCode, status)
+		}
+	}
+}
+
+// TestAuditLogCSV checks that values typed by visitors cannot turn into
+// spreadsheet formulas.
+// TestAuditLongValues checks that a failed login is audited even when the
+// client sends values longer than their columns.
+func TestAuditLongValues(t *testing.T) {
+	site := newTestSite(t)
+	email := strings.Repeat("e", 300) + "@example.com"
+
+	req, err := http.NewRequest("POST", site.server.URL+"/admin-login", strings.NewReader(url.Values{"email": {email}, "password": {"x"}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", strings.Repeat("1", 300))
+	req.Header.Set("User-Agent", strings.Repeat("u", 300))
+	resp, _ := site.do(req)
+	expectStatus(t, resp, http.StatusOK)
+
+	entries, err := site.repos.Audit.List(context.Background(), repository.AuditFilter{EntityType: "admin_user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "admin.login_failed" {
+		t.Fatalf("audited %+v", entries)
+	}
+	entry := entries[0]
+	if entry.ActorEmail != email[:255] || entry.IpAddress != strings.Repeat("1", 64) || len(entry.UserAgent) != 255 {
+		t.Fatalf("the values were not cut to their columns: %+v", entry)
+	}
+}
+
+func TestAuditLogCSV(t *testing.T) {
+	site := newAdminSite(t)
+
+	req, err := http.NewRequest("POST", site.server.URL+"/admin-login", strings.NewReader(url.Values{"email": {"=HYPERLINK(\"http://evil.example\")"}, "password": {"x"}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "@SUM(1+1)")
+	resp, _ := site.do(req)
+	expectStatus(t, resp, http.StatusFound)
+
+	resp, body := site.get("/audit-log.csv")
+	expectStatus(t, resp, http.StatusOK)
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, row := range rows {
+		if row[4] != "admin.login_failed" {
+			continue
+		}
+		found = true
+		if row[3] != `'=HYPERLINK("http://evil.example")` || row[10] != "'@SUM(1+1)" {
+			t.Fatalf("the failed login was exported as %q", row)
+		}
+	}
+	if !found {
+		t.Fatalf("no failed login in the export:\n%s", body)
+	}
+}
+
+func TestBulkPages(t *testing.T) {
+	site := newAdminSite(t)
+
+	for _, u := range []string{"/a", "/b", "/c"} {
+		resp, _ := site.post("/page", url.Values{"url": {u}, "title": {"Page " + u}})
+		expectRedirect(t, resp, "/pages")
+	}
+
+	resp, body := site.get("/pages")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, `<input type="checkbox" name="id" value="2" aria-label="Select Page /b">`)
+
+	resp, body = site.post("/pages/bulk", url.Values{"action": {"unpublish"}})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "Select at least one page.")
+	resp, _ = site.post("/pages/bulk", url.Values{"action": {"unpublish"}, "id": {"x"}})
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp, _ = site.post("/pages/bulk", url.Values{"action": {"rename"}, "id": {"1"}})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp, _ = site.post("/pages/bulk", url.Values{"action": {"unpublish"}, "id": {"1", "3", "9", "1"}})
+	expectStatus(t, resp, http.StatusFound)
+	resp, body = site.get(resp.Header.Get("Location"))
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "2 of 3 succeeded.")
+	expectContains(t, body, "<td>/c</td>")
+	expectContains(t, body, "Failed: not found, it may have been deleted")
+
+	for id, want := range map[uint64]string{1: models.PageDraft, 2: models.PagePublished, 3: models.PageDraft} {
+		page, err := site.repos.Pages.Get(context.Background(), id)
+		if err != nil || page.Status != want {
+			t.Fatalf("page %d is %q, %v, want %q", id, page.Status, err, want)
+		}
+	}
+
+	resp, body = site.post("/pages/bulk", url.Values{"action": {"export_csv"}, "id": {"2", "3"}})
+	expectStatus(t, resp, http.StatusOK)
+	want := "id,url,title,teaser,content,status,updated\n" +
+		"2,/b,Page /b,,,published,DATE\n" +
+		"3,/c,Page /c,,,draft,DATE\n"
+	if got := exportDate.ReplaceAllString(body, "DATE"); got != want {
+		t.Fatalf("exported\n%s\nwant\n%s", got, want)
+	}
+
+	resp, _ = site.post("/pages/bulk", url.Values{"action": {"delete"}, "id": {"2"}})
+	expectStatus(t, resp, http.StatusFound)
+	if _, err := site.repos.Pages.Get(context.Background(), 2); err == nil {
+		t.Fatal("page 2 was not deleted")
+	}
+
+	entries, err := site.repos.Audit.List(context.Background(), repository.AuditFilter{EntityType: "page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	if got := strings.Join(actions, " "); got != "page.bulk_delete page.bulk_export page.bulk_unpublish page.create page.create page.create" {
+		t.Fatalf("audited %s", got)
+	}
+	expectContains(t, entries[2].After, `"Succeeded":2,"Failed":{"9":"not found, it may have been deleted"}`)
+}
+
+func TestBulkListingsInBackground(t *testing.T) {
+	site := newAdminSite(t)
+
+	var ids []string
+	for i := 1; i <= bulkInlineLimit+5; i++ {
+		id, err := site.repos.Listings.Create(context.Background(), models.Listing{Url: fmt.Sprintf("/l%02d", i), Title: fmt.Sprintf("Listing %d", i), Category: "old"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, idString(id))
+	}
+
+	resp, body := site.post("/listings/bulk", url.Values{"action": {"category"}, "id": ids})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "This field is required.")
+
+	resp, _ = site.post("/listings/bulk", url.Values{"action": {"category"}, "category": {"houses"}, "id": ids})
+	expectStatus(t, resp, http.StatusFound)
+	location := resp.Header.Get("Location")
+
+	// the selection is too large to run in the request, wait for it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, body = site.get(location)
+		expectStatus(t, resp, http.StatusOK)
+		if !strings.Contains(body, `http-equiv="refresh"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the bulk action did not finish:\n%s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectContains(t, body, fmt.Sprintf("%d of %d succeeded.", len(ids), len(ids)))
+	expectContains(t, body, `<a href="/listings">Back to the list</a>`)
+
+	listings, err := site.repos.Listings.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, listing := range listings {
+		if listing.Category != "houses" {
+			t.Fatalf("listing %s is in %q", listing.Url, listing.Category)
+		}
+	}
+
+	resp, body = site.get("/listings")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "<td>houses</td>")
+
+	entries, err := site.repos.Audit.List(context.Background(), repository.AuditFilter{EntityType: "listing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "listing.bulk_category" {
+		t.Fatalf("audited %+v, want one listing.bulk_category entry", entries)
+	}
+
+	resp, _ = site.get("/bulk/0123abcd")
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestExport(t *testing.T) {
+	site := newAdminSite(t)
+	ctx := context.Background()
+
+	for i := 1; i <= 105; i++ {
+		status := models.PagePublished
+		if i%50 == 0 {
+			status = models.PageDraft
+		}
+		_, err := site.repos.Pages.Create(ctx, models.Page{Url: fmt.Sprintf("/p%03d", i), Title: fmt.Sprintf("Page %d", i), Content: "Body,\n\"quoted\"", Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, listing := range []models.Listing{
+		{ExternalId: "x1", Url: "/flat", Title: "Flat", Category: "Houses"},
+		{Url: "/bike", Title: "Bike", Category: "bikes", Status: models.ListingExpired},
+	} {
+		if _, err := site.repos.Listings.Create(ctx, listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, body := site.get("/pages")
+	expectContains(t, body, `<a href="/export/pages?format=csv">Export as CSV</a>`)
+	resp, body = site.get("/export/pages?format=csv")
+	expectStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="pages.csv"` {
+		t.Fatalf("exported as %s", got)
+	}
+	// every page, across more than one window of the list
+	table, err := tabular.Read(strings.NewReader(body), tabular.CSV, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Rows) != 105 || table.Rows[104].Values["url"] != "/p105" || table.Rows[0].Values["content"] != "Body,\n\"quoted\"" {
+		t.Fatalf("exported %d rows, the first %v", len(table.Rows), table.Rows[0].Values)
+	}
+
+	resp, body = site.get("/pages?status=draft&sort=title")
+	expectContains(t, body, `<a href="/export/pages?format=jsonl&amp;sort=title&amp;status=draft">Export as JSON Lines</a>`)
+	resp, body = site.get("/export/pages?format=jsonl&sort=title&status=draft")
+	expectStatus(t, resp, http.StatusOK)
+	want := `{"id":"100","url":"/p100","title":"Page 100","teaser":"","content":"Body,\n\"quoted\"","status":"draft","updated":"DATE"}` + "\n" +
+		`{"id":"50","url":"/p050","title":"Page 50","teaser":"","content":"Body,\n\"quoted\"","status":"draft","updated":"DATE"}` + "\n"
+	if got := exportDate.ReplaceAllString(body, "DATE"); got != want {
+		t.Fatalf("exported\n%s\nwant\n%s", got, want)
+	}
+
+	resp, body = site.get("/listings?category=houses")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "<td>/flat</td>")
+	if strings.Contains(body, "<td>/bike</td>") {
+		t.Fatal("the filter did not apply")
+	}
+	resp, body = site.get("/export/listings?format=csv&category=houses")
+	expectStatus(t, resp, http.StatusOK)
+	want = "id,external_id,url,title,description,category,status,updated\n" +
+		"1,x1,/flat,Flat,,Houses,active,DATE\n"
+	if got := exportDate.ReplaceAllString(body, "DATE"); got != want {
+		t.Fatalf("exported\n%s\nwant\n%s", got, want)
+	}
+
+	resp, _ = site.get("/export/pages?format=xlsx")
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp, _ = site.get("/export/admins?format=csv")
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestImportListings(t *testing.T) {
+	site := newAdminSite(t)
+	ctx := context.Background()
+
+	_, err := site.repos.Listings.Create(ctx, models.Listing{ExternalId: "x1", Url: "/l1", Title: "Flat", Category: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := site.upload("/import", url.Values{"kind": {"listings"}}, "", "")
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "Choose a file.")
+	resp, body = site.upload("/import", url.Values{"kind": {"listings"}}, "feed.xlsx", "x")
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "Choose the format of the file.")
+
+	file := "External ID,Name,URL,Category,Description,Status\n" +
+		"x1,Flat updated,/l1,houses,\"Big, bright\",\n" +
+		"x2,Bike,/l2,bikes,,Expired\n" +
+		"x3,,/l3,bikes,,active\n" +
+		"x2,Bike again,/l4,bikes,,\n" +
+		"x5,Car,not-a-path,cars,,sold\n"
+	resp, _ = site.upload("/import", url.Values{"kind": {"listings"}}, "listings.csv", file)
+	expectStatus(t, resp, http.StatusFound)
+	mapping := resp.Header.Get("Location")
+
+	resp, body = site.get(mapping)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "5 rows.")
+	expectContains(t, body, `<option value="External ID" selected>External ID</option>`)
+	expectContains(t, body, `<option value="Description" selected>Description</option>`)
+
+	form := url.Values{
+		"map_external_id": {"External ID"},
+		"map_url":         {"URL"},
+		"map_title":       {"Name"},
+		"map_description": {"Description"},
+		"map_category":    {"Category"},
+		"map_status":      {"Status"},
+		"key":             {"external_id"},
+		"mode":            {"preview"},
+	}
+	resp, body = site.post(mapping, form)
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "1 to create, 1 to update, 3 invalid.")
+	if !regexp.MustCompile(`<td>4</td>\s*<td>x3</td>\s*<td>title: This field is required. </td>`).MatchString(body) {
+		t.Fatalf("line 4 is not shown as invalid:\n%s", body)
+	}
+	expectContains(t, body, "external_id: line 3 has the same external_id.")
+	expectContains(t, body, "url: Enter a path that starts with /")
+	expectContains(t, body, "status: Choose one of active, expired.")
+	if listing, _ := site.repos.Listings.GetByExternalId(ctx, "x1"); listing.Title != "Flat" {
+		t.Fatal("the preview saved a row")
+	}
+
+	bad := url.Values{"map_url": {"Nope"}, "key": {"url"}, "mode": {"preview"}}
+	resp, _ = site.post(mapping, bad)
+	expectStatus(t, resp, http.StatusBadRequest)
+	unmapped := url.Values{"map_url": {"URL"}, "key": {"external_id"}, "mode": {"preview"}}
+	resp, body = site.post(mapping, unmapped)
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "Map a column to external_id")
+
+	form.Set("mode", "import")
+	resp, _ = site.post(mapping, form)
+	expectStatus(t, resp, http.StatusFound)
+	resp, body = site.get(resp.Header.Get("Location"))
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "2 of 5 succeeded.")
+	expectContains(t, body, "<td>x1 (updated)</td>")
+	expectContains(t, body, "<td>x2 (created)</td>")
+
+	listing, err := site.repos.Listings.GetByExternalId(ctx, "x1")
+	if err != nil || listing.Title != "Flat updated" || listing.Category != "houses" || listing.Description != "Big, bright" || listing.Status != models.ListingActive {
+		t.Fatalf("x1 is %+v, %v", listing, err)
+	}
+	listing, err = site.repos.Listings.GetByUrl(ctx, "/l2")
+	if err != nil || listing.ExternalId != "x2" || listing.Status != models.ListingExpired {
+		t.Fatalf("/l2 is %+v, %v", listing, err)
+	}
+
+	// running it again only updates
+	form.Set("mode", "preview")
+	resp, body = site.post(mapping, form)
+	expectContains(t, body, "0 to create, 2 to update, 3 invalid.")
+
+	entries, err := site.repos.Audit.List(ctx, repository.AuditFilter{EntityType: "listing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "listing.import" {
+		t.Fatalf("audited %+v, want one listing.import entry", entries)
+	}
+	expectContains(t, entries[0].After, `"file":"listings.csv"`)
+
+	resp, _ = site.get("/import/0123abcd")
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestImportPages(t *testing.T) {
+	site := newAdminSite(t)
+
+	resp, _ := site.post("/page", url.Values{"url": {"/about"}, "title": {"About"}, "content": {"old"}})
+	expectRedirect(t, resp, "/pages")
+
+	file := `{"url":"/about","content":"new"}` + "\n" + `{"url":"/contact","title":"Contact","status":"draft"}` + "\n"
+	resp, _ = site.upload("/import", url.Values{"kind": {"pages"}}, "pages.jsonl", file)
+	expectStatus(t, resp, http.StatusFound)
+	mapping := resp.Header.Get("Location")
+
+	form := url.Values{"map_url": {"url"}, "map_title": {"title"}, "map_content": {"content"}, "map_status": {"status"}, "key": {"url"}, "mode": {"import"}}
+	resp, _ = site.post(mapping, form)
+	expectStatus(t, resp, http.StatusFound)
+	resp, body := site.get(resp.Header.Get("Location"))
+	expectContains(t, body, "2 of 2 succeeded.")
+
+	// the title is mapped but missing from the first line, it keeps its value
+	page, err := site.repos.Pages.GetByUrl(context.Background(), "/about")
+	if err != nil || page.Title != "About" || page.Content != "new" || page.Version != 2 {
+		t.Fatalf("/about is %+v, %v", page, err)
+	}
+	page, err = site.repos.Pages.GetByUrl(context.Background(), "/contact")
+	if err != nil || page.Status != models.PageDraft {
+		t.Fatalf("/contact is %+v, %v", page, err)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	site := newAdminSite(t)
+	ctx := context.Background()
+
+	var feedBody string
+	var feedStatus int
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(feedStatus)
+		io.WriteString(w, feedBody)
+	}))
+	t.Cleanup(partner.Close)
+
+	feed := config.Feed{
+		Name:     "partner",
+		URL:      partner.URL,
+		Format:   "xml",
+		Interval: time.Hour,
+		Item:     "offer",
+		Key:      "sku",
+		Mapping:  map[string]string{"url": "path", "title": "name", "category": "type"},
+	}
+	site.app.feeds = []config.Feed{feed}
+
+	// a listing from elsewhere is never expired by the feed
+	if _, err := site.repos.Listings.Create(ctx, models.Listing{ExternalId: "other", Url: "/other", Title: "Other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	feedStatus = http.StatusOK
+	feedBody = `<offers>
+<offer sku="a1"><path>/a1</path><name>Flat</name><type>houses</type></offer>
+<offer sku="a2"><path>/a2</path><name>Bike</name><type>bikes</type></offer>
+<offer sku="a3"><path>/a3</path><name>Car</name><type>cars</type></offer>
+</offers>`
+	if err := site.app.runFeed(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	listing, err := site.repos.Listings.GetByExternalId(ctx, "partner:a1")
+	if err != nil || listing.Url != "/a1" || listing.Title != "Flat" || listing.Category != "houses" || listing.Status != models.ListingActive {
+		t.Fatalf("a1 is %+v, %v", listing, err)
+	}
+
+	feedBody = `<offers>
+<offer sku="a1"><path>/a1</path><name>Flat</name><type>houses</type></offer>
+<offer sku="a2"><path>/a2</path><name>Bike, red</name><type>bikes</type></offer>
+<offer sku="a4"><path>/a4</path><name></name></offer>
+<offer sku="a2"><path>/a5</path><name>Bike again</name></offer>
+<offer sku="a6"><path>/a6</path><name>Boat</name></offer>
+</offers>`
+	resp, _ := site.post("/feeds/partner/run", nil)
+	expectStatus(t, resp, http.StatusFound)
+	task := resp.Header.Get("Location")
+	for i := 0; ; i++ {
+		_, body := site.get(task)
+		if strings.Contains(body, "of 1 succeeded.") {
+			expectContains(t, body, "1 created, 1 updated, 1 unchanged, 1 expired, 2 failed")
+			break
+		}
+		if i == 100 {
+			t.Fatal("the feed run did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	listing, err = site.repos.Listings.GetByExternalId(ctx, "partner:a2")
+	if err != nil || listing.Title != "Bike, red" {
+		t.Fatalf("a2 is %+v, %v", listing, err)
+	}
+	listing, err = site.repos.Listings.GetByExternalId(ctx, "partner:a3")
+	if err != nil || listing.Status != models.ListingExpired {
+		t.Fatalf("a3 is %+v, %v", listing, err)
+	}
+	if _, err := site.repos.Listings.GetByExternalId(ctx, "partner:a6"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := site.repos.Listings.GetByExternalId(ctx, "partner:a4"); err == nil {
+		t.Fatal("the invalid item was created")
+	}
+
+	// a broken feed is recorded and expires nothing
+	feedStatus = http.StatusInternalServerError
+	if err := site.app.runFeed(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	feedStatus = http.StatusOK
+	feedBody = "<offers></offers>"
+	if err := site.app.runFeed(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	listing, err = site.repos.Listings.GetByExternalId(ctx, "partner:a1")
+	if err != nil || listing.Status != models.ListingActive {
+		t.Fatalf("a1 is %+v, %v", listing, err)
+	}
+	listing, err = site.repos.Listings.GetByExternalId(ctx, "other")
+	if err != nil || listing.Status != models.ListingActive {
+		t.Fatalf("other is %+v, %v", listing, err)
+	}
+
+	resp, body := site.get("/feeds")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, "every 1h0m0s, keyed by sku")
+	expectContains(t, body, "the feed has no &lt;offer&gt; elements")
+	expectContains(t, body, "500 Internal Server Error")
+	expectContains(t, body, "item 3 (a4): title: This field is required.")
+	expectContains(t, body, "item 4 (a2): an earlier item has the same sku")
+
+	runs, err := site.repos.FeedRuns.List(ctx, "partner", 10)
+	if err != nil || len(runs) != 4 {
+		t.Fatalf("%d runs, %v", len(runs), err)
+	}
+
+	resp, _ = site.post("/feeds/nope/run", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	// a feed being imported is not imported again meanwhile
+	site.app.feedLocks.lock("partner")
+	resp, body = site.post("/feeds/partner/run", nil)
+	expectStatus(t, resp, http.StatusConflict)
+	expectContains(t, body, "The feed partner is being imported already")
+	if err := site.app.runFeed(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	site.app.feedLocks.unlock("partner")
+	if runs, _ := site.repos.FeedRuns.List(ctx, "partner", 10); len(runs) != 4 {
+		t.Fatalf("%d runs after the runs that were skipped", len(runs))
+	}
+}
+
+// wxrExport is a WordPress export of the site at link.
+func wxrExport(link, items string) string {
+	return `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0" xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+<title>Old site</title>
+<link>` + link + `</link>
+<wp:wxr_version>1.2</wp:wxr_version>
+` + items + `
+</channel>
+</rss>`
+}
+
+func wxrItem(id int, postType, slug, status string, parent int, link, title, content string) string {
+	return fmt.Sprintf(`<item><title>%s</title><link>%s</link><content:encoded><![CDATA[%s]]></content:encoded><excerpt:encoded><![CDATA[]]></excerpt:encoded>
+<wp:post_id>%d</wp:post_id><wp:post_name>%s</wp:post_name><wp:status>%s</wp:status><wp:post_parent>%d</wp:post_parent><wp:post_type>%s</wp:post_type></item>
+`, title, link, content, id, slug, status, parent, postType)
+}
+
+func TestImportWordPress(t *testing.T) {
+	site := newTestSite(t)
+	site.app.media = media.NewStore(t.TempDir())
+	ctx := context.Background()
+
+	downloads := 0
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wp-content/uploads/2021/05/photo.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		downloads++
+		io.WriteString(w, "jpeg")
+	}))
+	t.Cleanup(old.Close)
+
+	items := wxrItem(2, "page", "about", "publish", 0, old.URL+"/about/", "About", "<p>Who we are.</p>") +
+		wxrItem(3, "page", "team", "draft", 2, old.URL+"/about/team/", "Team", "") +
+		wxrItem(12, "post", "hello", "publish", 0, old.URL+"/2021/05/hello/", "Hello",
+			`<!-- wp:paragraph --><p>See <a href="`+old.URL+`/about/">about</a>.</p><!-- /wp:paragraph --><!-- wp:image --><figure><img src="`+old.URL+`/wp-content/uploads/2021/05/photo-300x200.jpg" alt="Garden"/></figure><!-- /wp:image -->`) +
+		wxrItem(13, "attachment", "photo", "inherit", 12, old.URL+"/2021/05/hello/photo/", "photo", "") +
+		wxrItem(14, "attachment", "gone", "inherit", 12, old.URL+"/2021/05/hello/gone/", "gone", "") +
+		wxrItem(15, "post", "about", "publish", 0, old.URL+"/2021/06/about/", "About again", "") +
+		wxrItem(16, "post", "old", "trash", 0, old.URL+"/2021/06/old/", "Old", "") +
+		wxrItem(17, "nav_menu_item", "17", "publish", 0, old.URL+"/17/", "Menu", "")
+	items = strings.Replace(items, "<wp:post_type>attachment</wp:post_type></item>",
+		"<wp:post_type>attachment</wp:post_type><wp:attachment_url>"+old.URL+"/wp-content/uploads/2021/05/photo.jpg</wp:attachment_url></item>", 1)
+	items = strings.Replace(items, "<wp:post_type>attachment</wp:post_type></item>",
+		"<wp:post_type>attachment</wp:post_type><wp:attachment_url>"+old.URL+"/wp-content/uploads/2021/05/gone.jpg</wp:attachment_url></item>", 1)
+
+	export, err := wordpress.Parse(strings.NewReader(wxrExport(old.URL, items)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := wordpressOptions{Client: old.Client()}
+
+	report := site.app.importWordPress(ctx, export, wordpressOptions{Client: old.Client(), DryRun: true})
+	if report.Created != 3 || report.Media != 2 || downloads != 0 {
+		t.Fatalf("the dry run reported %+v after %d downloads", report, downloads)
+	}
+	if _, err := site.repos.Pages.GetByUrl(ctx, "/hello"); err == nil {
+		t.Fatal("the dry run created a page")
+	}
+
+	report = site.app.importWordPress(ctx, export, opts)
+	if report.Created != 3 || report.Skipped != 2 || report.Media != 1 || report.Failed != 2 {
+		t.Fatalf("the import reported %+v", report)
+	}
+	if want := []string{
+		"attachment 14 (gone): fetching " + old.URL + "/wp-content/uploads/2021/05/gone.jpg: 404 Not Found",
+		"post 15 (about): /about is also the url of page 2",
+	}; strings.Join(report.Errors, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("the import failed with %q, want %q", report.Errors, want)
+	}
+
+	page, err := site.repos.Pages.GetByUrl(ctx, "/hello")
+	if err != nil || page.Title != "Hello" || page.Status != models.PagePublished {
+		t.Fatalf("/hello is %+v, %v", page, err)
+	}
+	if want := "See [about](/about).\n\n![Garden](/media/2021/05/photo.jpg)"; page.Content != want {
+		t.Fatalf("the content is %q, want %q", page.Content, want)
+	}
+	page, err = site.repos.Pages.GetByUrl(ctx, "/about/team")
+	if err != nil || page.Status != models.PageDraft {
+		t.Fatalf("/about/team is %+v, %v", page, err)
+	}
+
+	resp, body := site.get("/media/2021/05/photo.jpg")
+	expectStatus(t, resp, http.StatusOK)
+	if body != "jpeg" {
+		t.Fatalf("the media file is %q", body)
+	}
+
+	for from, to := range map[string]string{
+		"/2021/05/hello/":                       "/hello",
+		"/2021/05/hello":                        "/hello",
+		"/?p=12":                                "/hello",
+		"/?page_id=2":                           "/about",
+		"/about/team/":                          "/about/team",
+		"/wp-content/uploads/2021/05/photo.jpg": "/media/2021/05/photo.jpg",
+		"/2021/05/hello/photo/":                 "/media/2021/05/photo.jpg",
+	} {
+		resp, _ := site.get(from)
+		if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != to {
+			t.Errorf("GET %s answered %d to %q, want a redirect to %s", from, resp.StatusCode, resp.Header.Get("Location"), to)
+		}
+	}
+	// the new url is not sent back to the old one with the slash
+	resp, _ = site.get("/about/team")
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, _ = site.get("/2021/06/old/")
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, _ = site.get("/")
+	expectStatus(t, resp, http.StatusOK)
+
+	// running it again changes nothing and downloads nothing
+	report = site.app.importWordPress(ctx, export, opts)
+	if report.Created != 0 || report.Updated != 0 || report.Unchanged != 3 || report.Media != 0 || downloads != 1 {
+		t.Fatalf("the second import reported %+v after %d downloads", report, downloads)
+	}
+	pages, err := site.repos.Pages.List(ctx)
+	if err != nil || len(pages) != 3 {
+		t.Fatalf("%d pages after the second import, %v", len(pages), err)
+	}
+
+	// an edited post updates its page
+	export.Items[0].Title = "About us"
+	report = site.app.importWordPress(ctx, export, opts)
+	if report.Updated != 1 || report.Unchanged != 2 {
+		t.Fatalf("the import of an edit reported %+v", report)
+	}
+	if page, _ := site.repos.Pages.GetByUrl(ctx, "/about"); page.Title != "About us" {
+		t.Fatalf("/about is %+v", page)
+	}
+}
+
+func TestApiListings(t *testing.T) {
+	site := newTestSite(t)
+	ctx := context.Background()
+	site.register("admin@example.com", "secret")
+	admin, err := site.repos.Admins.GetByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(scopes string) string {
+		value, hash, err := apitoken.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := site.repos.Tokens.Create(ctx, models.ApiToken{AdminUser: admin.Id, Name: scopes, TokenHash: hash, Scopes: scopes}); err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	reader, writer := token(apitoken.ScopeListingsRead), token(apitoken.ScopeListingsWrite+" "+apitoken.ScopePagesRead)
+	api := func(method, bearer, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, site.server.URL+"/api/listings", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		return site.do(req)
+	}
+
+	resp, _ := api("GET", "", "")
+	expectStatus(t, resp, http.StatusUnauthorized)
+	resp, _ = api("POST", reader, `{"url": "/flat", "title": "Flat"}`)
+	expectStatus(t, resp, http.StatusForbidden)
+	resp, _ = api("GET", writer, "")
+	expectStatus(t, resp, http.StatusForbidden)
+
+	resp, body := api("POST", writer, `{"url": "/flat", "title": "Flat", "category": "rent"}`)
+	expectStatus(t, resp, http.StatusCreated)
+	expectContains(t, body, `"id":1`)
+	expectContains(t, body, `"status":"active"`)
+	resp, body = api("POST", writer, `{"url": "/flat", "title": "Again"}`)
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	expectContains(t, body, "A listing with this url already exists.")
+
+	resp, body = api("GET", reader, "")
+	expectStatus(t, resp, http.StatusOK)
+	expectContains(t, body, `[{"id":1,"external_id":"","url":"/flat","title":"Flat","description":"","category":"rent","status":"active"}]`)
+
+	entries, err := site.repos.Audit.List(ctx, repository.AuditFilter{EntityType: "listing"})
+	if err != nil || len(entries) != 1 || entries[0].Action != "listing.create" || entries[0].ActorEmail != "admin@example.com" {
+		t.Fatalf("audited %+v, %v", entries, err)
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	site := newTestSite(t)
+
+	tests := []struct {
+		path   string
+		status int
+		golden string
+	}{
+		{"/no-such-page", http.StatusNotFound, "not_found"},
+		{"/bad-request", http.StatusBadRequest, "bad_request"},
+		{"/access-denied", http.StatusUnauthorized, "access_denied"},
+		{"/500", http.StatusInternalServerError, "internal_server_error"},
+	}
+
+	for _, test := range tests {
+		resp, body := site.get(test.path)
+		expectStatus(t, resp, test.status)
+		if got := resp.Header.Get("X-Request-ID"); got != testRequestId {
+			t.Fatalf("%s: X-Request-ID is %q, want %q", test.path, got, testRequestId)
+		}
+		expectGolden(t, test.golden, body)
+	}
+}
+
+func TestHomepage(t *testing.T) {
+	site := newTestSite(t)
+
+	resp, body := site.get("/")
+	expectStatus(t, resp, http.StatusOK)
+	expectGolden(t, "homepage", body)
+}
@@ -0,0 +1,162 @@
+// Package feed reads partner listing feeds, CSV or XML files fetched over
+// http or read from disk, into tables of named fields.
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/annbelievable/go_listing/tabular"
+)
+
+// Formats a feed can have, besides the tabular ones.
+const XML = "xml"
+
+// DefaultItem is the XML element of one item when the feed does not name
+// one.
+const DefaultItem = "item"
+
+// DefaultMaxSize is the size limit of a feed that does not set one.
+const DefaultMaxSize = 64 << 20
+
+// ErrTooLarge is returned when reading a feed past its size limit.
+var ErrTooLarge = errors.New("the feed is larger than its size limit")
+
+// Open returns the feed at url, or at path on disk when url is empty. Reading
+// more than maxSize bytes fails with ErrTooLarge, 0 means DefaultMaxSize.
+func Open(ctx context.Context, client *http.Client, url, path string, maxSize int64) (io.ReadCloser, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	if url == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return newLimitedBody(f, maxSize), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "go_listing feed importer")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return newLimitedBody(resp.Body, maxSize), nil
+}
+
+// limitedBody reads one byte past the limit, to tell a feed of exactly
+// maxSize bytes from a larger one.
+type limitedBody struct {
+	io.Closer
+	r    io.Reader
+	left int64
+}
+
+func newLimitedBody(body io.ReadCloser, maxSize int64) *limitedBody {
+	return &limitedBody{Closer: body, r: io.LimitReader(body, maxSize+1), left: maxSize}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return 0, ErrTooLarge
+	}
+	return n, err
+}
+
+// Parse reads the items of a feed. The rows of an XML feed are its item
+// elements, numbered from 1, with a column for each attribute and child
+// element.
+func Parse(r io.Reader, format, item string) (tabular.Table, error) {
+	if format != XML {
+		return tabular.Read(r, format, 0)
+	}
+	if item == "" {
+		item = DefaultItem
+	}
+	return parseXML(r, item)
+}
+
+func parseXML(r io.Reader, item string) (tabular.Table, error) {
+	var table tabular.Table
+	seen := make(map[string]bool)
+	column := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			table.Columns = append(table.Columns, name)
+		}
+	}
+
+	dec := xml.NewDecoder(r)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tabular.Table{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != item {
+			continue
+		}
+
+		row := tabular.Row{Line: len(table.Rows) + 1, Values: make(map[string]string)}
+		for _, attr := range start.Attr {
+			column(attr.Name.Local)
+			row.Values[attr.Name.Local] = attr.Value
+		}
+		if err := parseItem(dec, row.Values, column); err != nil {
+			return tabular.Table{}, fmt.Errorf("item %d: %w", row.Line, err)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	if len(table.Rows) == 0 {
+		return tabular.Table{}, errors.New("the feed has no <" + item + "> elements")
+	}
+	return table, nil
+}
+
+// parseItem reads the child elements of an item up to its end element. A
+// child is read as its text, elements nested deeper are left out.
+func parseItem(dec *xml.Decoder, values map[string]string, column func(string)) error {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			var child struct {
+				Text string `xml:",chardata"`
+			}
+			if err := dec.DecodeElement(&child, &t); err != nil {
+				return err
+			}
+			column(t.Name.Local)
+			values[t.Name.Local] = strings.TrimSpace(child.Text)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/annbelievable/go_listing/tabular"
+)
+
+func TestParseXML(t *testing.T) {
+	in := `<?xml version="1.0" encoding="UTF-8"?>
+<inventory>
+  <offer sku="a1">
+    <name>Flat &amp; garden</name>
+    <summary><![CDATA[Two <b>rooms</b>]]></summary>
+    <photos><photo>1.jpg</photo></photos>
+  </offer>
+  <offer sku="b2"><name>Bike</name></offer>
+</inventory>`
+
+	table, err := Parse(strings.NewReader(in), XML, "offer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sku", "name", "summary", "photos"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Fatalf("columns %q, want %q", table.Columns, want)
+	}
+	want := []tabular.Row{
+		{Line: 1, Values: map[string]string{"sku": "a1", "name": "Flat & garden", "summary": "Two <b>rooms</b>", "photos": ""}},
+		{Line: 2, Values: map[string]string{"sku": "b2", "name": "Bike"}},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Fatalf("rows %+v, want %+v", table.Rows, want)
+	}
+
+	if _, err := Parse(strings.NewReader(in), XML, ""); err == nil {
+		t.Fatal("a feed without <item> elements was read")
+	}
+	if _, err := Parse(strings.NewReader("<inventory><offer>"), XML, "offer"); err == nil {
+		t.Fatal("a cut off feed was read")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("sku,name\na1,Flat\n"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	body, err := Open(ctx, server.Client(), server.URL+"/feed.csv", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := Parse(body, tabular.CSV, "")
+	body.Close()
+	if err != nil || len(table.Rows) != 1 || table.Rows[0].Values["name"] != "Flat" {
+		t.Fatalf("read %+v, %v", table, err)
+	}
+
+	if _, err := Open(ctx, server.Client(), server.URL+"/gone.csv", "", 0); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("a missing feed opened with %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "feed.csv")
+	if err := os.WriteFile(path, []byte("sku,name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body, err = Open(ctx, nil, "", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	// the limit is checked while reading, a server may not send a length
+	for _, size := range []int64{int64(len("sku,name\na1,Flat\n")), 10} {
+		body, err = Open(ctx, server.Client(), server.URL+"/feed.csv", "", size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(body, tabular.CSV, "")
+		body.Close()
+		if tooLarge := size == 10; errors.Is(err, ErrTooLarge) != tooLarge {
+			t.Fatalf("reading the feed with a %d byte limit: %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/feed"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/tabular"
+
+	"github.com/gorilla/mux"
+)
+
+// maxFeedItemErrors is how many item errors a run keeps. A broken mapping
+// fails every item, and the first errors already tell why.
+const maxFeedItemErrors = 100
+
+// feedTimeout bounds fetching a feed, a partner's slow server should not
+// hold the worker until the next run.
+const feedTimeout = 5 * time.Minute
+
+// feedRunsShown is how many runs of each feed the feeds page lists.
+const feedRunsShown = 10
+
+func (s *server) findFeed(name string) (config.Feed, bool) {
+	for _, f := range s.feeds {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return config.Feed{}, false
+}
+
+// feedExternalId ties a listing to its item in a feed.
+func feedExternalId(f config.Feed, key string) string {
+	return f.Name + ":" + key
+}
+
+// runFeed imports the feed once and stores the run. A feed that cannot be
+// read is only recorded in its history: failing the worker would fail the
+// readiness check and take the site out of rotation for a partner's outage.
+func (s *server) runFeed(ctx context.Context, f config.Feed) error {
+	log := logger.Default().With("feed", f.Name)
+	if !s.feedLocks.lock(f.Name) {
+		log.Info("feed import skipped, the feed is being imported already")
+		return nil
+	}
+	defer s.feedLocks.unlock(f.Name)
+
+	run := s.syncFeed(ctx, f)
+
+	// the history is written even when the run was cut short by a shutdown
+	if _, err := s.feedRuns.Insert(context.Background(), run); err != nil {
+		return fmt.Errorf("storing the run of feed %s: %w", f.Name, err)
+	}
+
+	if run.Error != "" {
+		log.Warn("feed import failed", "error", run.Error)
+		return nil
+	}
+	log.Info("feed imported", "items", run.Items, "created", run.Created, "updated", run.Updated,
+		"expired", run.Expired, "failed", run.Failed, "duration", run.DateFinished.Sub(run.DateStarted))
+	return nil
+}
+
+// syncFeed makes the listings of a feed match its items: new items are
+// created, changed ones updated and the listings whose item is gone expired.
+// What went wrong is recorded in the run.
+func (s *server) syncFeed(ctx context.Context, f config.Feed) (run models.FeedRun) {
+	run = models.FeedRun{Feed: f.Name, DateStarted: time.Now()}
+	defer func() {
+		run.DateFinished = time.Now()
+	}()
+
+	table, err := s.readFeed(ctx, f)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	listings, err := s.listings.List(ctx)
+	if err != nil {
+		run.Error = "loading the listings: " + err.Error()
+		return run
+	}
+	existing := make(map[string]models.Listing)
+	for _, listing := range listings {
+		if strings.HasPrefix(listing.ExternalId, f.Name+":") {
+			existing[listing.ExternalId] = listing
+		}
+	}
+
+	unit := "line"
+	if f.Format == feed.XML {
+		unit = "item"
+	}
+	fail := func(row tabular.Row, key, reason string) {
+		run.Failed++
+		if len(run.ItemErrors) < maxFeedItemErrors {
+			run.ItemErrors = append(run.ItemErrors, fmt.Sprintf("%s %d (%s): %s", unit, row.Line, key, reason))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range table.Rows {
+		if ctx.Err() != nil {
+			run.Error = "stopped: " + ctx.Err().Error()
+			break
+		}
+
+		key := strings.TrimSpace(row.Values[f.Key])
+		if key == "" {
+			fail(row, key, f.Key+" is empty")
+			continue
+		}
+		externalId := feedExternalId(f, key)
+		if seen[externalId] {
+			fail(row, key, "an earlier item has the same "+f.Key)
+			continue
+		}
+		// seen before it is checked, an invalid item is still in the feed
+		// and its listing is not expired
+		seen[externalId] = true
+		run.Items++
+
+		before, found := existing[externalId]
+		listing := before
+		if !found {
+			listing = models.Listing{ExternalId: externalId}
+		}
+		for _, field := range config.FeedFields {
+			column, ok := f.Mapping[field]
+			if !ok {
+				continue
+			}
+			value := row.Values[column]
+			if field != "description" {
+				value = strings.TrimSpace(value)
+			}
+			switch field {
+			case "url":
+				listing.Url = value
+			case "title":
+				listing.Title = value
+			case "description":
+				listing.Description = value
+			case "category":
+				listing.Category = value
+			}
+		}
+		listing.Status = models.ListingActive
+
+		if found && listing == before {
+			run.Unchanged++
+			continue
+		}
+
+		errs, err := s.validateListing(ctx, listing)
+		if err != nil {
+			fail(row, key, bulkItemError(nil, err).Error())
+			continue
+		}
+		if errs != nil {
+			fail(row, key, strings.Join(importErrors(errs, listingTransfer), " "))
+			continue
+		}
+
+		if found {
+			err = s.listings.Update(ctx, listing)
+		} else {
+			_, err = s.listings.Create(ctx, listing)
+		}
+		if err != nil {
+			fail(row, key, bulkItemError(nil, err).Error())
+			continue
+		}
+		if found {
+			run.Updated++
+		} else {
+			run.Created++
+		}
+	}
+
+	if run.Failed > len(run.ItemErrors) {
+		run.ItemErrors = append(run.ItemErrors, fmt.Sprintf("%d more items failed", run.Failed-len(run.ItemErrors)))
+	}
+
+	// a run cut short has not seen every item, so nothing can be expired
+	if run.Error != "" {
+		return run
+	}
+
+	var gone []string
+	for externalId, listing := range existing {
+		if !seen[externalId] && listing.Status != models.ListingExpired {
+			gone = append(gone, externalId)
+		}
+	}
+	sort.Strings(gone)
+	for _, externalId := range gone {
+		listing := existing[externalId]
+		listing.Status = models.ListingExpired
+		if err := s.listings.Update(ctx, listing); err != nil {
+			run.Failed++
+			run.ItemErrors = append(run.ItemErrors, fmt.Sprintf("expiring %s: %s", listing.Url, bulkItemError(nil, err)))
+			continue
+		}
+		run.Expired++
+	}
+
+	return run
+}
+
+// readFeed fetches and parses a feed. An empty feed is an error: it is far
+// more likely a broken export than a partner with nothing left, and reading
+// it would expire every listing of the feed.
+func (s *server) readFeed(ctx context.Context, f config.Feed) (tabular.Table, error) {
+	body, err := feed.Open(ctx, s.feedClient, f.URL, f.Path, f.MaxSize)
+	if err != nil {
+		return tabular.Table{}, err
+	}
+	defer body.Close()
+
+	table, err := feed.Parse(body, f.Format, f.Item)
+	if err != nil {
+		return tabular.Table{}, fmt.Errorf("reading the feed: %w", err)
+	}
+	if len(table.Rows) == 0 {
+		return tabular.Table{}, errors.New("the feed has no items, nothing was changed")
+	}
+
+	seen := make(map[string]bool)
+	for _, column := range table.Columns {
+		seen[column] = true
+	}
+	if !seen[f.Key] {
+		return tabular.Table{}, fmt.Errorf("the feed has no %s column, the key of its items", f.Key)
+	}
+	return table, nil
+}
+
+type feedView struct {
+	Feed config.Feed
+	Runs []models.FeedRun
+}
+
+// feedLocks keeps a feed from being imported twice at once, by its worker
+// and by an admin who runs it now.
+type feedLocks struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newFeedLocks() *feedLocks {
+	return &feedLocks{running: make(map[string]bool)}
+}
+
+// lock reports false when the feed is already being imported.
+func (l *feedLocks) lock(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[name] {
+		return false
+	}
+	l.running[name] = true
+	return true
+}
+
+func (l *feedLocks) unlock(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.running, name)
+}
+
+// Feeds lists the feeds with their last runs.
+func (s *server) Feeds(w http.ResponseWriter, r *http.Request) {
+	s.renderFeeds(w, r, http.StatusOK, "")
+}
+
+func (s *server) renderFeeds(w http.ResponseWriter, r *http.Request, status int, message string) {
+	var feeds []feedView
+	for _, f := range s.feeds {
+		runs, err := s.feedRuns.List(r.Context(), f.Name, feedRunsShown)
+		if err != nil {
+			repositoryError(w, r, err)
+			return
+		}
+		feeds = append(feeds, feedView{Feed: f, Runs: runs})
+	}
+
+	data := TemplateData{
+		Page:    models.Page{Title: "Feeds"},
+		Message: message,
+		Misc:    feeds,
+	}
+	if len(feeds) == 0 {
+		data.Message = "No feeds are configured, add them under feeds in the configuration file."
+	}
+	w.WriteHeader(status)
+	renderPage(w, r, "feeds.html", data)
+}
+
+// FeedRunAction imports a feed now instead of waiting for its interval.
+func (s *server) FeedRunAction(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.findFeed(mux.Vars(r)["name"])
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	if !s.feedLocks.lock(f.Name) {
+		s.renderFeeds(w, r, http.StatusConflict, "The feed "+f.Name+" is being imported already, wait for that run to finish.")
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "feed.run", "feed", f.Name, nil, nil)
+
+	id := s.tasks.Start("feed.run", []string{f.Name}, func(ctx context.Context, name string) (string, error) {
+		defer s.feedLocks.unlock(f.Name)
+
+		run := s.syncFeed(ctx, f)
+		if _, err := s.feedRuns.Insert(context.Background(), run); err != nil {
+			return "", err
+		}
+		if run.Error != "" {
+			return "", bulkReason(run.Error)
+		}
+		return fmt.Sprintf("%d created, %d updated, %d unchanged, %d expired, %d failed", run.Created, run.Updated, run.Unchanged, run.Expired, run.Failed), nil
+	}, nil)
+
+	http.Redirect(w, r, "/bulk/"+id, http.StatusFound)
+}
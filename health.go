@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/annbelievable/go_listing/migrations"
+)
+
+// healthCheckTimeout bounds every readiness check so a hanging database
+// cannot hold the probe.
+const healthCheckTimeout = 2 * time.Second
+
+type healthCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks,omitempty"`
+}
+
+// Healthz tells the orchestrator whether the process is alive. It does not
+// look at dependencies, a database outage should not restart the server.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, healthReport{Status: "ok"})
+}
+
+// Readyz tells load balancers whether to send traffic. It fails as soon as
+// shutdown begins and while the database, the schema or a worker is unhealthy.
+func (s *server) Readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if atomic.LoadInt32(&draining) == 1 {
+		writeJSON(w, http.StatusServiceUnavailable, healthReport{Status: "draining"})
+		return
+	}
+
+	report := healthReport{Status: "ready"}
+	// in-memory repositories have no database to check
+	if s.db != nil {
+		report.Checks = append(report.Checks,
+			runHealthCheck(r.Context(), "database", s.checkDatabase),
+			runHealthCheck(r.Context(), "migrations", s.checkMigrations),
+		)
+	}
+	report.Checks = append(report.Checks, s.checkWorkers()...)
+
+	status := http.StatusOK
+	for _, check := range report.Checks {
+		if check.Status != "ok" {
+			report.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, status, report)
+}
+
+func runHealthCheck(ctx context.Context, name string, check func(ctx context.Context) (string, error)) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check(ctx)
+	result := healthCheck{
+		Name:      name,
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+	if err != nil {
+		result.Status = "failing"
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (s *server) checkDatabase(ctx context.Context) (string, error) {
+	return "", s.db.PingContext(ctx)
+}
+
+func (s *server) checkMigrations(ctx context.Context) (string, error) {
+	migrator, err := migrations.New(s.db)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("version %d, expected %d", version, migrations.Latest())
+	if version < migrations.Latest() {
+		return detail, migrations.ErrOutdated
+	}
+
+	return detail, nil
+}
+
+// checkWorkers reports a worker as failing when it stopped, when its last run
+// failed or when it missed two runs in a row.
+func (s *server) checkWorkers() []healthCheck {
+	var checks []healthCheck
+	for _, status := range s.workers.Status() {
+		check := healthCheck{Name: "worker:" + status.Name, Status: "ok"}
+
+		switch {
+		case !status.Running:
+			check.Error = "not running"
+		case status.LastError != "":
+			check.Error = status.LastError
+		case status.Runs == 0:
+			check.Detail = "first run pending"
+		case time.Since(status.LastRun) > 2*status.Interval+time.Minute:
+			check.Error = "missed its schedule, last run " + status.LastRun.Format(time.RFC3339)
+		default:
+			check.Detail = "last run " + status.LastRun.Format(time.RFC3339)
+		}
+
+		if check.Error != "" {
+			check.Status = "failing"
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
@@ -0,0 +1,242 @@
+// Package logger writes levelled, structured log lines as JSON or as
+// key=value text.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel accepts debug, info, warn or error in any case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("logger: unknown level %q", s)
+}
+
+// Logger writes one line per call. Loggers made by With share the output of
+// their parent.
+type Logger struct {
+	out    *output
+	level  Level
+	json   bool
+	fields []interface{}
+}
+
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a logger writing lines of at least level to w. format is json
+// or text.
+func New(w io.Writer, level Level, format string) (*Logger, error) {
+	switch format {
+	case "json", "text", "":
+	default:
+		return nil, fmt.Errorf("logger: unknown format %q", format)
+	}
+
+	return &Logger{out: &output{w: w}, level: level, json: format == "json"}, nil
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultLogger = &Logger{out: &output{w: os.Stderr}, level: LevelInfo}
+)
+
+// Default returns the logger used when none is in the context.
+func Default() *Logger {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+// With returns a logger that adds the key value pairs to every line.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	child := *l
+	child.fields = append(append([]interface{}(nil), l.fields...), kv...)
+	return &child
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.Log(LevelDebug, msg, kv...) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.Log(LevelInfo, msg, kv...) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.Log(LevelWarn, msg, kv...) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.Log(LevelError, msg, kv...) }
+
+// Log writes msg with the logger's fields and the key value pairs in kv. A
+// key without a value is logged under "!BADKEY".
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := append(append([]interface{}(nil), l.fields...), kv...)
+	if len(fields)%2 == 1 {
+		fields = append(fields[:len(fields)-1], "!BADKEY", fields[len(fields)-1])
+	}
+
+	var buf bytes.Buffer
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	if l.json {
+		writeJSON(&buf, now, level, msg, fields)
+	} else {
+		writeText(&buf, now, level, msg, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// Writer returns an io.Writer that logs every line written to it at level.
+// It lets the standard log package write through the logger.
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.Log(level, strings.TrimRight(string(p), "\n"))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func writeJSON(buf *bytes.Buffer, now string, level Level, msg string, fields []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, now)
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, msg)
+	for i := 0; i < len(fields); i += 2 {
+		buf.WriteByte(',')
+		writeJSONValue(buf, fmt.Sprint(fields[i]))
+		buf.WriteByte(':')
+		writeJSONValue(buf, value(fields[i+1]))
+	}
+	buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+func writeText(buf *bytes.Buffer, now string, level Level, msg string, fields []interface{}) {
+	buf.WriteString("time=")
+	buf.WriteString(now)
+	buf.WriteString(" level=")
+	buf.WriteString(level.String())
+	buf.WriteString(" msg=")
+	buf.WriteString(quote(msg))
+	for i := 0; i < len(fields); i += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(fmt.Sprint(fields[i]))
+		buf.WriteByte('=')
+		v := value(fields[i+1])
+		if s, ok := v.(string); ok {
+			buf.WriteString(quote(s))
+		} else {
+			buf.WriteString(quote(fmt.Sprint(v)))
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// value turns errors, durations and stringers into strings so both formats
+// show them the same way.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// quote leaves simple values bare and quotes the rest.
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/logger"
+)
+
+// setupLogging installs the configured logger as the default and sends the
+// standard log package through it.
+func setupLogging(cfg config.Log) error {
+	level, err := logger.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	l, err := logger.New(os.Stderr, level, cfg.Format)
+	if err != nil {
+		return err
+	}
+
+	logger.SetDefault(l)
+	log.SetFlags(0)
+	log.SetOutput(l.Writer(logger.LevelInfo))
+	return nil
+}
+
+// requestIdHandler gives every request an id, taken from the X-Request-ID
+// header when the client or a proxy sent a sensible one. The id is echoed in
+// the response and added to every log line of the request.
+func requestIdHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), "RequestId", id)
+		ctx = logger.NewContext(ctx, logger.Default().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestId accepts ids of up to 128 letters, digits and -_.: so a
+// client cannot inject anything into the logs or headers.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestId returns the id given to r by requestIdHandler.
+func requestId(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value("RequestId").(string)
+	return id
+}
+
+// requestLogger returns the logger of r, which carries its request id.
+func requestLogger(r *http.Request) *logger.Logger {
+	if r == nil {
+		return logger.Default()
+	}
+	return logger.FromContext(r.Context())
+}
+
+// loggingHandler writes one line per request once the response is done.
+func loggingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := logger.LevelInfo
+		if rec.status >= 500 {
+			level = logger.LevelError
+		}
+
+		requestLogger(r).Log(level, "request",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", rec.status,
+			"size", rec.size,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"ip", GetIP(r),
+		)
+	})
+}
+
+// responseRecorder remembers the status code and the number of body bytes
+// written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
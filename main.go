@@ -1,566 +1,1409 @@
-package main
-
-import (
-	"context"
-	"database/sql"
-	"html/template"
-	"log"
-	"net/http"
-	"strconv"
-	"time"
-
-	"github.com/annbelievable/go_listing/database"
-	"github.com/annbelievable/go_listing/handlers"
-	"github.com/annbelievable/go_listing/models"
-	"github.com/google/uuid"
-
-	"github.com/gorilla/mux"
-)
-
-var templates = template.Must(template.ParseGlob("./views/**/*.html"))
-var db *sql.DB
-
-type TemplateData struct {
-	models.Page // data for that page
-	Message     string
-	Errors      map[string]string
-	PageObj     models.Page
-	Pages       []models.Page
-	Misc        interface{}
-}
-
-func main() {
-	db = database.ConnectDatabase()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/", Homepage).Methods("GET")
-
-	router.Handle("/admin-register", http.HandlerFunc(AdminRegister)).Methods("GET")
-	router.Handle("/admin-register", parseFormHandler(http.HandlerFunc(AdminRegisterAction))).Methods("POST")
-	router.Handle("/admin-login", http.HandlerFunc(AdminLogin)).Methods("GET")
-	router.Handle("/admin-login", parseFormHandler(http.HandlerFunc(AdminLoginAction))).Methods("POST")
-	router.Handle("/admin-homepage", http.HandlerFunc(AdminHomepage)).Methods("GET")
-	router.HandleFunc("/admin-logout", AdminLogout).Methods("POST")
-
-	router.HandleFunc("/datamanager", DataManager).Methods("GET")
-	// create page
-	router.HandleFunc("/page", CreatePage).Methods("GET")
-	router.Handle("/page", parseFormHandler(http.HandlerFunc(CreatePageAction))).Methods("POST")
-	// get all pages
-	router.HandleFunc("/pages", Pages).Methods("GET")
-	// update page
-	router.HandleFunc("/update-page/{id:[0-9]+}", UpdatePage).Methods("GET")
-	router.Handle("/update-page/{id:[0-9]+}", parseFormHandler(http.HandlerFunc(UpdatePageAction))).Methods("POST")
-	// delete page
-	// router.HandleFunc("/pages", Test).Methods("GET")
-	// get page by url
-	// router.HandleFunc("/page", Test).Methods("GET")
-
-	router.HandleFunc("/test", Test).Methods("GET")
-	router.HandleFunc("/bad-request", BadRequest).Methods("GET")
-	router.HandleFunc("/access-denied", AccessDenied).Methods("GET")
-	router.HandleFunc("/500", InternalServerError).Methods("GET")
-	router.NotFoundHandler = notFound()
-
-	router.Use(recoverHandler)
-	router.Use(loggingHandler)
-	router.Use(sessionHandler)
-	// router.Use(getPageDataHandler)
-
-	log.Println("Starting server")
-	log.Fatal(http.ListenAndServe(":8080", router))
-}
-
-// actions
-func AdminRegisterAction(w http.ResponseWriter, r *http.Request) {
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
-	exist := database.AdminEmailExist(db, email)
-
-	if exist {
-		ctx := r.Context()
-		ctx = context.WithValue(r.Context(), "Message", "Email already registered.")
-		AdminRegister(w, r.WithContext(ctx))
-		return
-	}
-
-	hashedPwd, err := handlers.HashAndSalt(password)
-
-	if err != nil {
-		LogError(err)
-		InternalServerError(w, r)
-		return
-	}
-
-	err = database.InsertAdmin(db, email, hashedPwd)
-
-	if err != nil {
-		LogError(err)
-		InternalServerError(w, r)
-		return
-	}
-
-	http.Redirect(w, r, "/admin-login", http.StatusFound)
-}
-
-func AdminLoginAction(w http.ResponseWriter, r *http.Request) {
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
-	admin, err := database.SelectAdmin(db, email)
-
-	if err != nil {
-		LogError(err)
-		InternalServerError(w, r)
-		return
-	}
-
-	match := handlers.ComparePasswords(admin.Password, password)
-
-	if !match {
-		ctx := r.Context()
-		ctx = context.WithValue(r.Context(), "Message", "Login failed.")
-		AdminLogin(w, r.WithContext(ctx))
-		return
-	}
-
-	sessionId := uuid.NewString()
-	expiryDate := time.Now().Add(30 * time.Minute)
-
-	database.DeleteAdminSessionByAdminId(db, admin.Id)
-	err = database.InsertAdminSession(db, sessionId, admin.Id, expiryDate)
-	if err != nil {
-		LogError(err)
-		InternalServerError(w, r)
-		return
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_id",
-		Value:   sessionId,
-		Expires: expiryDate,
-	})
-
-	http.Redirect(w, r, "/admin-homepage", http.StatusFound)
-}
-
-func AdminLogout(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie("session_id")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
-
-	sessionId := c.Value
-	session, err := database.SelectAdminSession(db, sessionId)
-
-	if err != nil {
-		LogError(err)
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
-
-	if len(session.SessionId) == 0 && session.ExpiryDate.Before(time.Now()) {
-		database.DeleteAdminSession(db, sessionId)
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_id",
-		Value:   "",
-		Expires: time.Now(),
-	})
-
-	http.Redirect(w, r, "/", http.StatusFound)
-}
-
-func Homepage(w http.ResponseWriter, r *http.Request) {
-	page := models.Page{
-		Title:   "Home",
-		Content: "This is My listing. Please enjoy browsing.",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	ctxMsg := r.Context().Value("Message")
-	if ctxMsg != nil {
-		data.Message = ctxMsg.(string)
-	}
-	render(w, data)
-}
-
-func AdminRegister(w http.ResponseWriter, r *http.Request) {
-	ctxVal := r.Context().Value("LoggedIn")
-	if ctxVal != nil {
-		loggedIn := ctxVal.(bool)
-		if loggedIn {
-			http.Redirect(w, r, "/admin-homepage", http.StatusFound)
-		}
-	}
-
-	page := models.Page{
-		Title:   "Admin Registration",
-		Content: "",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	ctxMsg := r.Context().Value("Message")
-	if ctxMsg != nil {
-		data.Message = ctxMsg.(string)
-	}
-	renderPage(w, "admin_register.html", data)
-}
-
-func AdminLogin(w http.ResponseWriter, r *http.Request) {
-	ctxVal := r.Context().Value("LoggedIn")
-	if ctxVal != nil {
-		loggedIn := ctxVal.(bool)
-		if loggedIn {
-			http.Redirect(w, r, "/admin-homepage", http.StatusFound)
-		}
-	}
-
-	page := models.Page{
-		Title:   "Admin Login",
-		Content: "",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	ctxMsg := r.Context().Value("Message")
-	if ctxMsg != nil {
-		data.Message = ctxMsg.(string)
-	}
-	renderPage(w, "admin_login.html", data)
-}
-
-func AdminHomepage(w http.ResponseWriter, r *http.Request) {
-	ctxVal := r.Context().Value("LoggedIn")
-	if ctxVal != nil {
-		loggedIn := ctxVal.(bool)
-		if !loggedIn {
-			http.Redirect(w, r, "/admin-login", http.StatusFound)
-		}
-	}
-
-	page := models.Page{
-		Title:   "Admin Homepage",
-		Content: "",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	ctxMsg := r.Context().Value("Message")
-	if ctxMsg != nil {
-		data.Message = ctxMsg.(string)
-	}
-	render(w, data)
-}
-
-// Data manager
-func DataManager(w http.ResponseWriter, r *http.Request) {
-	page := models.Page{
-		Title:   "Data Manager",
-		Content: "",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	renderPage(w, "data_manager.html", data)
-}
-
-// Page listing
-func Pages(w http.ResponseWriter, r *http.Request) {
-	pages, err := database.GetPages(db)
-	if err != nil {
-		LogError(err)
-		InternalServerError(w, r)
-		return
-	}
-	page := models.Page{
-		Title:   "Pages",
-		Content: "",
-	}
-	data := TemplateData{
-		Page:  page,
-		Pages: pages,
-	}
-	renderPage(w, "pages.html", data)
-}
-
-func CreatePage(w http.ResponseWriter, r *http.Request) {
-	renderPage(w, "create_page.html", nil)
-}
-
-func CreatePageAction(w http.ResponseWriter, r *http.Request) {
-	var page models.Page
-	page.Url = r.Form.Get("url")
-	page.Title = r.Form.Get("title")
-	page.Teaser = r.Form.Get("teaser")
-	page.Content = r.Form.Get("content")
-
-	// TODO: validation
-
-	err := database.InsertPage(db, page)
-
-	// TODO: need to pass the error to the page
-	if err != nil {
-		CreatePage(w, r)
-		return
-	}
-
-	http.Redirect(w, r, "/pages", http.StatusFound)
-}
-
-func UpdatePage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idInt, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-
-	id := uint64(idInt)
-	page, err := database.GetPageById(db, id)
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-
-	data := TemplateData{
-		PageObj: page,
-	}
-
-	renderPage(w, "update_page.html", data)
-}
-
-func UpdatePageAction(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idInt, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Redirect(w, r, "/pages", http.StatusNotFound)
-		return
-	}
-
-	var page models.Page
-	page.Id = uint64(idInt)
-	_, err = database.GetPageById(db, page.Id)
-	if err != nil {
-		http.Redirect(w, r, "/pages", http.StatusNotFound)
-		return
-	}
-
-	page.Url = r.Form.Get("url")
-	page.Title = r.Form.Get("title")
-	page.Teaser = r.Form.Get("teaser")
-	page.Content = r.Form.Get("content")
-
-	err = database.UpdatePage(db, page)
-
-	// TODO: need to pass the error to the page
-	if err != nil {
-		UpdatePage(w, r)
-		return
-	}
-
-	http.Redirect(w, r, "/pages", http.StatusFound)
-}
-
-// func InsertPage(db *sql.DB, page models.Page) error {
-// func GetPageByUrl(db *sql.DB, url string) (models.Page, error) {
-// func GetPages(db *sql.DB) ([]models.Page, error) {
-// func UpdatePage(db *sql.DB, page models.Page) error {
-// func DeletePage(db *sql.DB, id uint64) {
-
-// simple views
-
-// 500
-func InternalServerError(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	page := models.Page{
-		Title:   "500: Internal Server Error",
-		Content: "An error occurred, please contact admin about it.",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	render(w, data)
-}
-
-// 400
-func BadRequest(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusBadRequest)
-	data := models.Page{
-		Title:   "400: Bad Request",
-		Content: "Please try again.",
-	}
-	render(w, data)
-}
-
-// 401
-func AccessDenied(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusUnauthorized)
-	page := models.Page{
-		Title:   "401: Access Denied",
-		Content: "You're not allowed to access this content.",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	render(w, data)
-}
-
-// 404
-func notFound() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[INFO] NOT FOUND - %s %s %q\n", GetIP(r), r.Method, r.URL.String())
-		w.WriteHeader(http.StatusNotFound)
-		page := models.Page{
-			Title:   "404: Not Found",
-			Content: "The content youre looking for is not found.",
-		}
-		data := TemplateData{
-			Page: page,
-		}
-		render(w, data)
-	})
-}
-
-// MIDDLEWARE
-
-func loggingHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		t1 := time.Now()
-		next.ServeHTTP(w, r)
-		t2 := time.Now()
-		log.Printf("[INFO] %s %s %q %v\n", GetIP(r), r.Method, r.URL.String(), t2.Sub(t1))
-	})
-}
-
-func recoverHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				LogError(err.(error))
-				http.Error(w, "Something went wrong.", 500)
-			}
-		}()
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func parseFormHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		err := r.ParseForm()
-
-		if err != nil {
-			LogError(err)
-			InternalServerError(w, r)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func sessionHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		c, err := r.Cookie("session_id")
-
-		if err != nil {
-			ctx = context.WithValue(r.Context(), "LoggedIn", false)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-
-		sessionId := c.Value
-		session, err := database.SelectAdminSession(db, sessionId)
-
-		if err != nil || len(session.SessionId) == 0 {
-			if len(session.SessionId) > 0 {
-				LogError(err)
-			}
-			ctx = context.WithValue(r.Context(), "LoggedIn", false)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-
-		database.DeleteAdminSessionByAdminId(db, session.AdminUser)
-		newSessionId := uuid.NewString()
-		expiryDate := time.Now().Add(30 * time.Minute)
-		err = database.InsertAdminSession(db, newSessionId, session.AdminUser, expiryDate)
-
-		if err != nil {
-			LogError(err)
-			ctx = context.WithValue(r.Context(), "LoggedIn", false)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:    "session_id",
-			Value:   newSessionId,
-			Expires: expiryDate,
-		})
-
-		ctx = context.WithValue(r.Context(), "LoggedIn", true)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-// func getPageDataHandler(next http.Handler) http.Handler {
-// 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-// 		//use the url and get the page's data
-// 		data := database.GetPageByUrl(db, r.URL)
-// 		render(w, data)
-// 		// ctx := r.Context()
-// 		// ctx = context.WithValue(r.Context(), "LoggedIn", true)
-// 		// next.ServeHTTP(w, r.WithContext(ctx))
-// 	})
-// }
-
-// UTIL FUNC
-
-func GetIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		return forwarded
-	}
-	return r.RemoteAddr
-}
-
-// this is for testing purpose only
-func Test(w http.ResponseWriter, r *http.Request) {
-	page := models.Page{
-		Title:   "Test",
-		Content: "This is a test page.",
-	}
-	data := TemplateData{
-		Page: page,
-	}
-	render(w, data)
-}
-
-// general page rendering
-// potentially can pass in title, teaser, content, general message
-func render(w http.ResponseWriter, data interface{}) {
-	err := templates.ExecuteTemplate(w, "layout.html", data)
-	checkError(w, err)
-}
-
-func renderPage(w http.ResponseWriter, fileName string, data interface{}) {
-	err := templates.ExecuteTemplate(w, fileName, data)
-	checkError(w, err)
-}
-
-func checkError(w http.ResponseWriter, err error) {
-	if err != nil {
-		LogError(err)
-		http.Error(w, "Something went wrong.", 500)
-	}
-}
-
-func LogError(err error) {
-	log.Printf("[ERROR] %+v\n", err)
-}
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/annbelievable/go_listing/apitoken"
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/diff"
+	"github.com/annbelievable/go_listing/handlers"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/media"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/session"
+	"github.com/annbelievable/go_listing/tracing"
+	"github.com/annbelievable/go_listing/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// templateGlob matches the page and layout templates, relative to the working
+// directory.
+const templateGlob = "./views/**/*.html"
+
+var templates *template.Template
+
+type TemplateData struct {
+	models.Page // data for that page
+	Message     string
+	Errors      map[string]string
+	PageObj     models.Page
+	Pages       []models.Page
+	Misc        interface{}
+	// Form holds the submitted values for forms that are not a page.
+	Form url.Values
+	// RequestId is shown on error pages so a report can be matched to the logs.
+	RequestId string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// serve runs the web site until the listener fails.
+func serve(args []string) int {
+	fs := config.NewFlagSet("serve", os.Stderr)
+	fs.Usage = func() { commandUsage("serve") }
+	cfg, rest, err := config.LoadFlags(fs, args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "serve takes no arguments, got %q\n", rest[0])
+		return exitUsage
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if err := setupTracing(cfg.Tracing); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	templates, err = template.ParseGlob(templateGlob)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	db := database.ConnectDatabase(cfg.Database)
+	checkSchema(db)
+	registerDatabaseMetrics(db)
+
+	repos := repository.NewPostgres(db)
+	sessions, err := newSessionManager(cfg.Session, repos.Sessions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	s := newServer(repos, sessions)
+	s.sso = newSSOSettings(cfg.SSO)
+	s.passwordLogin = cfg.SSO.PasswordLogin
+	s.db = db
+	s.trashRetention = cfg.Pages.TrashRetention
+	s.feeds = cfg.Feeds
+	s.media = media.NewStore(cfg.Media.Dir)
+	s.workers = s.newWorkers()
+	s.workers.Start(context.Background())
+
+	srv := newHTTPServer(cfg.Server, s.newHandler())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	logger.Default().Info("starting server", "addr", cfg.Server.Addr)
+
+	select {
+	case err := <-errc:
+		logger.Default().Error("server failed", "error", err)
+		s.shutdown(srv, cfg.Server, 0)
+		return exitFailure
+	case sig := <-stop:
+		// a second signal kills the process without waiting
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		logger.Default().Info("shutting down", "signal", sig)
+	}
+
+	if err := s.shutdown(srv, cfg.Server, cfg.Server.ShutdownDelay); err != nil {
+		logger.Default().Error("shutdown incomplete", "error", err)
+		return exitFailure
+	}
+
+	logger.Default().Info("server stopped")
+	return exitOK
+}
+
+// newHandler wraps the router in the middleware that has to see every
+// request, including the ones no route matches.
+func (s *server) newHandler() http.Handler {
+	router := s.newRouter()
+	return requestIdHandler(tracingHandler(router, loggingHandler(metricsHandler(router))))
+}
+
+// newRouter registers every route of the site.
+func (s *server) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	// the plain permalinks of an imported site, /?p=12, end up here
+	router.Handle("/", s.redirectHandler(http.HandlerFunc(Homepage))).Methods("GET")
+
+	router.Handle("/admin-register", http.HandlerFunc(s.AdminRegister)).Methods("GET")
+	router.Handle("/admin-register", parseFormHandler(http.HandlerFunc(s.AdminRegisterAction))).Methods("POST")
+	router.Handle("/admin-login", http.HandlerFunc(s.AdminLogin)).Methods("GET")
+	router.Handle("/admin-login", parseFormHandler(http.HandlerFunc(s.AdminLoginAction))).Methods("POST")
+	router.HandleFunc("/admin-login/sso", s.AdminSSOLogin).Methods("GET")
+	router.HandleFunc("/admin-login/sso/callback", s.AdminSSOCallback).Methods("GET")
+	router.Handle("/admin-homepage", http.HandlerFunc(AdminHomepage)).Methods("GET")
+	router.HandleFunc("/admin-logout", s.AdminLogout).Methods("POST")
+	router.HandleFunc("/admin-sessions", s.AdminSessions).Methods("GET")
+	router.Handle("/admin-sessions/revoke", parseFormHandler(http.HandlerFunc(s.AdminSessionRevokeAction))).Methods("POST")
+	router.HandleFunc("/admin-sessions/revoke-others", s.AdminSessionRevokeOthersAction).Methods("POST")
+	router.Handle("/admin-sessions/forget", parseFormHandler(http.HandlerFunc(s.AdminSessionForgetAction))).Methods("POST")
+	router.Handle("/api-tokens", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.ApiTokens))).Methods("GET")
+	router.Handle("/api-tokens", s.requireRole(models.RoleAdmin, parseFormHandler(http.HandlerFunc(s.ApiTokenCreateAction)))).Methods("POST")
+	router.Handle("/api-tokens/revoke", s.requireRole(models.RoleAdmin, parseFormHandler(http.HandlerFunc(s.ApiTokenRevokeAction)))).Methods("POST")
+	router.Handle("/audit-log", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.AuditLog))).Methods("GET")
+	router.Handle("/audit-log.csv", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.AuditLogCSV))).Methods("GET")
+
+	// json api, authenticated by session or bearer token
+	router.Handle("/api/pages", requireScope(apitoken.ScopePagesRead, http.HandlerFunc(s.ApiPages))).Methods("GET")
+	router.Handle("/api/pages", requireScope(apitoken.ScopePagesWrite, http.HandlerFunc(s.ApiCreatePage))).Methods("POST")
+	router.Handle("/api/listings", requireScope(apitoken.ScopeListingsRead, http.HandlerFunc(s.ApiListings))).Methods("GET")
+	router.Handle("/api/listings", requireScope(apitoken.ScopeListingsWrite, http.HandlerFunc(s.ApiCreateListing))).Methods("POST")
+
+	router.HandleFunc("/datamanager", DataManager).Methods("GET")
+	// create page
+	router.Handle("/page", requireAdmin(http.HandlerFunc(CreatePage))).Methods("GET")
+	router.Handle("/page", requireAdmin(parseFormHandler(http.HandlerFunc(s.CreatePageAction)))).Methods("POST")
+	// get all pages
+	router.Handle("/pages", requireAdmin(http.HandlerFunc(s.Pages))).Methods("GET")
+	router.Handle("/pages/bulk", requireAdmin(parseFormHandler(http.HandlerFunc(s.PagesBulkAction)))).Methods("POST")
+	// update page
+	router.Handle("/update-page/{id:[0-9]+}", requireAdmin(http.HandlerFunc(s.UpdatePage))).Methods("GET")
+	router.Handle("/update-page/{id:[0-9]+}", requireAdmin(parseFormHandler(http.HandlerFunc(s.UpdatePageAction)))).Methods("POST")
+	// delete page, to the trash
+	router.Handle("/delete-page/{id:[0-9]+}", requireAdmin(http.HandlerFunc(s.DeletePage))).Methods("GET")
+	router.Handle("/delete-page/{id:[0-9]+}", requireAdmin(http.HandlerFunc(s.DeletePageAction))).Methods("POST")
+	router.Handle("/trash", requireAdmin(http.HandlerFunc(s.Trash))).Methods("GET")
+	router.Handle("/trash/{id:[0-9]+}/restore", requireAdmin(http.HandlerFunc(s.TrashRestoreAction))).Methods("POST")
+	router.Handle("/trash/{id:[0-9]+}/purge", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.TrashPurge))).Methods("GET")
+	router.Handle("/trash/{id:[0-9]+}/purge", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.TrashPurgeAction))).Methods("POST")
+	// listings
+	router.Handle("/listings", requireAdmin(http.HandlerFunc(s.Listings))).Methods("GET")
+	router.Handle("/listings/bulk", requireAdmin(parseFormHandler(http.HandlerFunc(s.ListingsBulkAction)))).Methods("POST")
+	router.Handle("/bulk/{id:[0-9a-f]+}", requireAdmin(http.HandlerFunc(s.BulkTask))).Methods("GET")
+	// export and import of pages and listings
+	router.Handle("/export/{kind:pages|listings}", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.Export))).Methods("GET")
+	router.Handle("/import", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.Import))).Methods("GET")
+	router.Handle("/import", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.ImportUpload))).Methods("POST")
+	router.Handle("/import/{id:[0-9a-f]+}", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.ImportMapping))).Methods("GET")
+	router.Handle("/import/{id:[0-9a-f]+}", s.requireRole(models.RoleAdmin, parseFormHandler(http.HandlerFunc(s.ImportAction)))).Methods("POST")
+	// scheduled listing feeds
+	router.Handle("/feeds", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.Feeds))).Methods("GET")
+	router.Handle("/feeds/{name}/run", s.requireRole(models.RoleAdmin, http.HandlerFunc(s.FeedRunAction))).Methods("POST")
+	// get page by url
+	// router.HandleFunc("/page", Test).Methods("GET")
+
+	router.HandleFunc("/healthz", Healthz).Methods("GET")
+	router.HandleFunc("/readyz", s.Readyz).Methods("GET")
+	router.HandleFunc("/metrics", Metrics).Methods("GET")
+
+	router.HandleFunc("/test", Test).Methods("GET")
+	router.HandleFunc("/bad-request", BadRequest).Methods("GET")
+	router.HandleFunc("/access-denied", AccessDenied).Methods("GET")
+	router.HandleFunc("/500", InternalServerError).Methods("GET")
+	router.PathPrefix(mediaPrefix).HandlerFunc(s.Media).Methods("GET")
+
+	router.NotFoundHandler = s.redirectHandler(notFound())
+
+	router.Use(recoverHandler)
+	router.Use(s.sessionHandler)
+	// router.Use(getPageDataHandler)
+
+	return router
+}
+
+// actions
+func (s *server) AdminRegisterAction(w http.ResponseWriter, r *http.Request) {
+	if !s.passwordLogin {
+		AccessDenied(w, r)
+		return
+	}
+
+	email := strings.TrimSpace(r.Form.Get("email"))
+	password := r.Form.Get("password")
+	errs, err := s.validateAdmin(r.Context(), email, password)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	if errs != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		renderAdminRegister(w, r, TemplateData{Errors: errs, Form: r.Form})
+		return
+	}
+
+	hashedPwd, err := handlers.HashAndSalt(password)
+
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	id, err := s.admins.Create(r.Context(), models.AdminUser{Email: email, Password: hashedPwd})
+
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	s.recordAudit(r, auditActor{Id: id, Email: email}, "admin.register", "admin_user", idString(id), nil, map[string]string{"email": email})
+
+	http.Redirect(w, r, "/admin-login", http.StatusFound)
+}
+
+func (s *server) AdminLoginAction(w http.ResponseWriter, r *http.Request) {
+	if !s.passwordLogin {
+		AccessDenied(w, r)
+		return
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+	admin, err := s.admins.GetByEmail(r.Context(), email)
+
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	match := err == nil && handlers.ComparePasswords(admin.Password, password)
+
+	if !match {
+		loginAttempts.Inc("password", "failure")
+		if admin.Id == 0 {
+			s.recordAudit(r, auditActor{Email: email}, "admin.login_failed", "admin_user", "", nil, nil)
+		} else {
+			s.recordAudit(r, auditActor{Id: admin.Id, Email: email}, "admin.login_failed", "admin_user", idString(admin.Id), nil, nil)
+		}
+		ctx := r.Context()
+		ctx = context.WithValue(r.Context(), "Message", "Login failed.")
+		s.AdminLogin(w, r.WithContext(ctx))
+		return
+	}
+
+	_, err = s.sessions.Rotate(w, r, admin.Id)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	s.recordAudit(r, auditActor{Id: admin.Id, Email: email}, "admin.login", "admin_user", idString(admin.Id), nil, nil)
+	loginAttempts.Inc("password", "success")
+
+	if r.Form.Get("remember") == "on" {
+		err = s.sessions.Remember(w, r, admin.Id)
+		if err != nil && err != session.ErrNotSupported {
+			LogError(r, err)
+		}
+	}
+
+	http.Redirect(w, r, "/admin-homepage", http.StatusFound)
+}
+
+func (s *server) AdminLogout(w http.ResponseWriter, r *http.Request) {
+	if current, ok := r.Context().Value("Session").(models.AdminUserSession); ok {
+		s.recordAudit(r, s.currentActor(r), "admin.logout", "admin_user", idString(current.AdminUser), nil, nil)
+	}
+
+	err := s.sessions.Destroy(w, r)
+	if err != nil {
+		LogError(r, err)
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *server) AdminSessionRevokeAction(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	err := s.sessions.Revoke(r.Context(), current.AdminUser, r.Form.Get("session"))
+	if err == session.ErrNotSupported {
+		s.AdminSessions(w, r)
+		return
+	}
+	if err != nil && err != session.ErrNotFound {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	if err == nil {
+		s.recordAudit(r, s.currentActor(r), "session.revoke", "admin_user_session", r.Form.Get("session"), nil, nil)
+	}
+
+	http.Redirect(w, r, "/admin-sessions", http.StatusFound)
+}
+
+func (s *server) AdminSessionRevokeOthersAction(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	err := s.sessions.RevokeOthers(r, current)
+	if err == session.ErrNotSupported {
+		s.AdminSessions(w, r)
+		return
+	}
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "session.revoke_others", "admin_user", idString(current.AdminUser), nil, nil)
+
+	http.Redirect(w, r, "/admin-sessions", http.StatusFound)
+}
+
+func (s *server) AdminSessionForgetAction(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	err := s.sessions.Forget(r.Context(), current.AdminUser, r.Form.Get("selector"))
+	if err != nil && err != session.ErrNotFound {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/admin-sessions", http.StatusFound)
+}
+
+func (s *server) ApiTokenCreateAction(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	scopes := apitoken.ValidScopes(r.Form["scopes"])
+	if name == "" || len(scopes) == 0 {
+		ctx := context.WithValue(r.Context(), "Message", "A token needs a name and at least one scope.")
+		s.ApiTokens(w, r.WithContext(ctx))
+		return
+	}
+
+	value, hash, err := apitoken.Generate()
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	token := models.ApiToken{
+		AdminUser: current.AdminUser,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    strings.Join(scopes, " "),
+	}
+
+	if days, err := strconv.Atoi(r.Form.Get("expires_in_days")); err == nil && days > 0 {
+		token.ExpiryDate = sql.NullTime{Time: time.Now().AddDate(0, 0, days), Valid: true}
+	}
+
+	token.Id, err = s.tokens.Create(r.Context(), token)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "api_token.create", "api_token", idString(token.Id), nil, map[string]interface{}{
+		"name":        token.Name,
+		"scopes":      token.Scopes,
+		"expiry_date": token.ExpiryDate,
+	})
+
+	ctx := context.WithValue(r.Context(), "NewToken", value)
+	s.ApiTokens(w, r.WithContext(ctx))
+}
+
+// any admin can revoke any token
+func (s *server) ApiTokenRevokeAction(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("Session").(models.AdminUserSession); !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		BadRequest(w, r)
+		return
+	}
+
+	err = s.tokens.Delete(r.Context(), id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	if err == nil {
+		s.recordAudit(r, s.currentActor(r), "api_token.revoke", "api_token", idString(id), nil, nil)
+	}
+
+	http.Redirect(w, r, "/api-tokens", http.StatusFound)
+}
+
+func Homepage(w http.ResponseWriter, r *http.Request) {
+	page := models.Page{
+		Title:   "Home",
+		Content: "This is My listing. Please enjoy browsing.",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+	ctxMsg := r.Context().Value("Message")
+	if ctxMsg != nil {
+		data.Message = ctxMsg.(string)
+	}
+	render(w, r, data)
+}
+
+func (s *server) AdminRegister(w http.ResponseWriter, r *http.Request) {
+	ctxVal := r.Context().Value("LoggedIn")
+	if ctxVal != nil {
+		loggedIn := ctxVal.(bool)
+		if loggedIn {
+			http.Redirect(w, r, "/admin-homepage", http.StatusFound)
+			return
+		}
+	}
+
+	if !s.passwordLogin {
+		AccessDenied(w, r)
+		return
+	}
+
+	var data TemplateData
+	ctxMsg := r.Context().Value("Message")
+	if ctxMsg != nil {
+		data.Message = ctxMsg.(string)
+	}
+	renderAdminRegister(w, r, data)
+}
+
+func renderAdminRegister(w http.ResponseWriter, r *http.Request, data TemplateData) {
+	data.Page = models.Page{
+		Title:   "Admin Registration",
+		Content: "",
+	}
+	renderPage(w, r, "admin_register.html", data)
+}
+
+func (s *server) AdminLogin(w http.ResponseWriter, r *http.Request) {
+	ctxVal := r.Context().Value("LoggedIn")
+	if ctxVal != nil {
+		loggedIn := ctxVal.(bool)
+		if loggedIn {
+			http.Redirect(w, r, "/admin-homepage", http.StatusFound)
+			return
+		}
+	}
+
+	page := models.Page{
+		Title:   "Admin Login",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+		Misc: loginOptions{
+			PasswordLogin: s.passwordLogin,
+			SSO:           s.ssoEnabled(),
+		},
+	}
+	ctxMsg := r.Context().Value("Message")
+	if ctxMsg != nil {
+		data.Message = ctxMsg.(string)
+	}
+	renderPage(w, r, "admin_login.html", data)
+}
+
+func AdminHomepage(w http.ResponseWriter, r *http.Request) {
+	ctxVal := r.Context().Value("LoggedIn")
+	if ctxVal != nil {
+		loggedIn := ctxVal.(bool)
+		if !loggedIn {
+			http.Redirect(w, r, "/admin-login", http.StatusFound)
+			return
+		}
+	}
+
+	page := models.Page{
+		Title:   "Admin Homepage",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+	ctxMsg := r.Context().Value("Message")
+	if ctxMsg != nil {
+		data.Message = ctxMsg.(string)
+	}
+	render(w, r, data)
+}
+
+type loginOptions struct {
+	PasswordLogin bool
+	SSO           bool
+}
+
+type sessionsData struct {
+	Sessions   []sessionRow
+	Remembered []models.AdminRememberToken
+}
+
+type sessionRow struct {
+	Handle      string
+	UserAgent   string
+	IpAddress   string
+	DateCreated time.Time
+	LastSeen    time.Time
+	Current     bool
+}
+
+// Sessions of the logged in admin
+func (s *server) AdminSessions(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	page := models.Page{
+		Title:   "Your Sessions",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+
+	list, err := s.sessions.List(r.Context(), current.AdminUser)
+	if err == session.ErrNotSupported {
+		data.Message = "Listing and revoking sessions is not supported by this session store."
+		renderPage(w, r, "admin_sessions.html", data)
+		return
+	}
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	remembered, err := s.sessions.ListRemember(r.Context(), current.AdminUser)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	var rows []sessionRow
+	for _, s := range list {
+		rows = append(rows, sessionRow{
+			Handle:      session.Handle(s),
+			UserAgent:   s.UserAgent,
+			IpAddress:   s.IpAddress,
+			DateCreated: s.DateCreated,
+			LastSeen:    s.LastSeen,
+			Current:     s.SessionId == current.SessionId,
+		})
+	}
+	data.Misc = sessionsData{
+		Sessions:   rows,
+		Remembered: remembered,
+	}
+
+	renderPage(w, r, "admin_sessions.html", data)
+}
+
+type apiTokensData struct {
+	NewToken     string
+	Scopes       []string
+	CurrentAdmin uint64
+	Tokens       []models.ApiToken
+}
+
+// Personal API tokens
+func (s *server) ApiTokens(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("Session").(models.AdminUserSession)
+	if !ok {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return
+	}
+
+	tokens, err := s.tokens.List(r.Context())
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	page := models.Page{
+		Title:   "API Tokens",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+	ctxMsg := r.Context().Value("Message")
+	if ctxMsg != nil {
+		data.Message = ctxMsg.(string)
+	}
+
+	misc := apiTokensData{
+		Scopes:       apitoken.Scopes,
+		CurrentAdmin: current.AdminUser,
+		Tokens:       tokens,
+	}
+	if newToken, ok := r.Context().Value("NewToken").(string); ok {
+		misc.NewToken = newToken
+	}
+	data.Misc = misc
+
+	renderPage(w, r, "api_tokens.html", data)
+}
+
+// Data manager
+func DataManager(w http.ResponseWriter, r *http.Request) {
+	page := models.Page{
+		Title:   "Data Manager",
+		Content: "",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+	renderPage(w, r, "data_manager.html", data)
+}
+
+// Page listing
+// pageSortColumns are the sortable columns of the pages list, in the order
+// they are shown.
+var pageSortColumns = []struct {
+	Sort  string
+	Label string
+}{
+	{repository.PageSortTitle, "title"},
+	{repository.PageSortUrl, "url"},
+	{repository.PageSortUpdated, "updated"},
+	{repository.PageSortStatus, "status"},
+}
+
+// pageListView is the Misc of pages.html.
+type pageListView struct {
+	Search   string
+	Status   string
+	Sort     string
+	Dir      string
+	Statuses []string
+	Columns  []pageListColumn
+	// Next and Prev link to the neighbouring windows, empty at either end.
+	Next string
+	Prev string
+	// Exports download the whole filtered list.
+	Exports []exportLink
+}
+
+type pageListColumn struct {
+	Label string
+	Href  string
+	// Dir is the direction the list is sorted in by this column, empty when
+	// it is sorted by another one.
+	Dir string
+}
+
+// pageListQuery reads the list state from the query string. Values that do
+// not fit are dropped rather than rejected, they come from edited links.
+func pageListQuery(r *http.Request) repository.PageQuery {
+	values := r.URL.Query()
+	q := repository.PageQuery{
+		Search: strings.TrimSpace(values.Get("q")),
+		Status: values.Get("status"),
+		Sort:   values.Get("sort"),
+		Desc:   values.Get("dir") == "desc",
+	}
+	if q.Status != models.PagePublished && q.Status != models.PageDraft {
+		q.Status = ""
+	}
+	q = q.Normalize()
+
+	if after := values.Get("after"); after != "" {
+		q.After, _ = database.ParsePageCursor(after, q.Sort)
+	} else if before := values.Get("before"); before != "" {
+		q.Before, _ = database.ParsePageCursor(before, q.Sort)
+	}
+
+	return q
+}
+
+// pageListHref links to the list with q's filters and sort, plus extra.
+func pageListHref(q repository.PageQuery, extra url.Values) string {
+	values := pageListValues(q, extra)
+	if len(values) == 0 {
+		return "/pages"
+	}
+	return "/pages?" + values.Encode()
+}
+
+func pageListValues(q repository.PageQuery, extra url.Values) url.Values {
+	values := url.Values{}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if q.Status != "" {
+		values.Set("status", q.Status)
+	}
+	if q.Sort != repository.PageSortUrl {
+		values.Set("sort", q.Sort)
+	}
+	if q.Desc {
+		values.Set("dir", "desc")
+	}
+	for key, value := range extra {
+		values[key] = value
+	}
+	return values
+}
+
+func newPageListView(q repository.PageQuery, list repository.PageList) pageListView {
+	view := pageListView{
+		Search:   q.Search,
+		Status:   q.Status,
+		Sort:     q.Sort,
+		Dir:      "asc",
+		Statuses: []string{models.PagePublished, models.PageDraft},
+	}
+	if q.Desc {
+		view.Dir = "desc"
+	}
+
+	for _, column := range pageSortColumns {
+		// a column sorts ascending first and flips when it already sorts
+		sorted := q
+		sorted.Sort = column.Sort
+		sorted.Desc = false
+		col := pageListColumn{Label: column.Label}
+		if column.Sort == q.Sort {
+			col.Dir = view.Dir
+			sorted.Desc = !q.Desc
+		}
+		col.Href = pageListHref(sorted, nil)
+		view.Columns = append(view.Columns, col)
+	}
+
+	view.Exports = exportLinks(pageTransfer, pageListValues(q, nil))
+
+	if list.Next != nil {
+		view.Next = pageListHref(q, url.Values{"after": {list.Next.String()}})
+	}
+	if list.Prev != nil {
+		view.Prev = pageListHref(q, url.Values{"before": {list.Prev.String()}})
+	}
+
+	return view
+}
+
+// Pages lists the pages a window at a time, filtered and sorted as the query
+// string says.
+func (s *server) Pages(w http.ResponseWriter, r *http.Request) {
+	s.renderPages(w, r, "")
+}
+
+func (s *server) renderPages(w http.ResponseWriter, r *http.Request, message string) {
+	q := pageListQuery(r)
+	list, err := s.pages.Find(r.Context(), q)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	page := models.Page{
+		Title:   "Pages",
+		Content: "",
+	}
+	data := TemplateData{
+		Page:    page,
+		Message: message,
+		Pages:   list.Pages,
+		Misc:    newPageListView(q, list),
+	}
+	renderPage(w, r, "pages.html", data)
+}
+
+func CreatePage(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, r, "create_page.html", TemplateData{})
+}
+
+// pageFormError re-renders the page form with the error of a failed save, or
+// hands errors the form cannot show to repositoryError.
+func pageFormError(w http.ResponseWriter, r *http.Request, fileName string, page models.Page, err error) {
+	if !errors.Is(err, repository.ErrUniqueViolation) {
+		repositoryError(w, r, err)
+		return
+	}
+
+	// another save took the url after the page was validated
+	pageForm(w, r, fileName, http.StatusConflict, page, validate.Errors{"Url": "A page with this url already exists."})
+}
+
+// pageForm renders a page form again with the submitted page and a message
+// for every invalid field.
+func pageForm(w http.ResponseWriter, r *http.Request, fileName string, status int, page models.Page, errs validate.Errors) {
+	data := TemplateData{
+		PageObj: page,
+		Errors:  errs,
+	}
+	w.WriteHeader(status)
+	renderPage(w, r, fileName, data)
+}
+
+func (s *server) CreatePageAction(w http.ResponseWriter, r *http.Request) {
+	var page models.Page
+	page.Url = r.Form.Get("url")
+	page.Title = r.Form.Get("title")
+	page.Teaser = r.Form.Get("teaser")
+	page.Content = r.Form.Get("content")
+	page.Status = r.Form.Get("status")
+	if page.Status == "" {
+		page.Status = models.PagePublished
+	}
+
+	errs, err := s.validatePage(r.Context(), page)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+	if errs != nil {
+		pageForm(w, r, "create_page.html", http.StatusUnprocessableEntity, page, errs)
+		return
+	}
+
+	id, err := s.pages.Create(r.Context(), page)
+	if err != nil {
+		pageFormError(w, r, "create_page.html", page, err)
+		return
+	}
+
+	page.Id = id
+	s.recordAudit(r, s.currentActor(r), "page.create", "page", idString(id), nil, page)
+
+	http.Redirect(w, r, "/pages", http.StatusFound)
+}
+
+func (s *server) UpdatePage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idInt, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := uint64(idInt)
+	page, err := s.pages.Get(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		PageObj: page,
+	}
+
+	renderPage(w, r, "update_page.html", data)
+}
+
+func (s *server) UpdatePageAction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idInt, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Redirect(w, r, "/pages", http.StatusNotFound)
+		return
+	}
+
+	// the version the editor started from, a save in the meantime bumped it
+	version, err := strconv.Atoi(r.Form.Get("version"))
+	if err != nil {
+		BadRequest(w, r)
+		return
+	}
+
+	var page models.Page
+	page.Id = uint64(idInt)
+	page.Version = version
+	before, err := s.pages.Get(r.Context(), page.Id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	page.Url = r.Form.Get("url")
+	page.Title = r.Form.Get("title")
+	page.Teaser = r.Form.Get("teaser")
+	page.Content = r.Form.Get("content")
+	page.Status = r.Form.Get("status")
+
+	errs, err := s.validatePage(r.Context(), page)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+	if errs != nil {
+		pageForm(w, r, "update_page.html", http.StatusUnprocessableEntity, page, errs)
+		return
+	}
+
+	err = s.pages.Update(r.Context(), page)
+	if errors.Is(err, repository.ErrConflict) {
+		s.pageConflict(w, r, page)
+		return
+	}
+	if err != nil {
+		pageFormError(w, r, "update_page.html", page, err)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "page.update", "page", idString(page.Id), before, page)
+
+	http.Redirect(w, r, "/pages", http.StatusFound)
+}
+
+// fieldDiff is the diff of one page field on the conflict screen.
+type fieldDiff struct {
+	Name  string
+	Lines []diff.Line
+}
+
+// pageConflict shows what changed between the stored page and the editor's
+// save that lost the race. The form keeps the editor's values at the current
+// version, so sending it again overwrites the other save knowingly.
+func (s *server) pageConflict(w http.ResponseWriter, r *http.Request, page models.Page) {
+	current, err := s.pages.Get(r.Context(), page.Id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	fields := []struct {
+		name            string
+		current, edited string
+	}{
+		{"Url", current.Url, page.Url},
+		{"Title", current.Title, page.Title},
+		{"Teaser", current.Teaser, page.Teaser},
+		{"Content", current.Content, page.Content},
+	}
+	var diffs []fieldDiff
+	for _, field := range fields {
+		lines := diff.Lines(field.current, field.edited)
+		if diff.Changed(lines) {
+			diffs = append(diffs, fieldDiff{Name: field.name, Lines: lines})
+		}
+	}
+
+	page.Version = current.Version
+	data := TemplateData{
+		Page:    models.Page{Title: "Edit conflict"},
+		Message: "Someone else saved this page while you were editing it. Lines marked - are in the saved page, lines marked + are your changes.",
+		PageObj: page,
+		Misc:    diffs,
+	}
+	w.WriteHeader(http.StatusConflict)
+	renderPage(w, r, "page_conflict.html", data)
+}
+
+// func InsertPage(db *sql.DB, page models.Page) error {
+// func GetPageByUrl(db *sql.DB, url string) (models.Page, error) {
+// func GetPages(db *sql.DB) ([]models.Page, error) {
+// func UpdatePage(db *sql.DB, page models.Page) error {
+
+// simple views
+
+// 500
+func InternalServerError(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusInternalServerError)
+	page := models.Page{
+		Title:   "500: Internal Server Error",
+		Content: "An error occurred, please contact admin about it.",
+	}
+	data := TemplateData{
+		Page:      page,
+		RequestId: requestId(r),
+	}
+	render(w, r, data)
+}
+
+// 400
+func BadRequest(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusBadRequest)
+	page := models.Page{
+		Title:   "400: Bad Request",
+		Content: "Please try again.",
+	}
+	data := TemplateData{
+		Page:      page,
+		RequestId: requestId(r),
+	}
+	render(w, r, data)
+}
+
+// 401
+func AccessDenied(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusUnauthorized)
+	page := models.Page{
+		Title:   "401: Access Denied",
+		Content: "You're not allowed to access this content.",
+	}
+	data := TemplateData{
+		Page:      page,
+		RequestId: requestId(r),
+	}
+	render(w, r, data)
+}
+
+// 503
+func ServiceUnavailable(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	page := models.Page{
+		Title:   "503: Service Unavailable",
+		Content: "The site is busy, please try again in a moment.",
+	}
+	data := TemplateData{
+		Page:      page,
+		RequestId: requestId(r),
+	}
+	render(w, r, data)
+}
+
+// repositoryError answers a failed repository call: missing rows are a 404 and
+// timeouts a 503, anything else is logged as a 500.
+func repositoryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		notFound().ServeHTTP(w, r)
+	case errors.Is(err, repository.ErrTimeout):
+		LogError(r, err)
+		ServiceUnavailable(w, r)
+	default:
+		LogError(r, err)
+		InternalServerError(w, r)
+	}
+}
+
+// Media serves the files of the media store.
+func (s *server) Media(w http.ResponseWriter, r *http.Request) {
+	if s.media == nil {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+	http.StripPrefix(strings.TrimSuffix(mediaPrefix, "/"), s.media).ServeHTTP(w, r)
+}
+
+// 404
+func notFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		page := models.Page{
+			Title:   "404: Not Found",
+			Content: "The content youre looking for is not found.",
+		}
+		data := TemplateData{
+			Page:      page,
+			RequestId: requestId(r),
+		}
+		render(w, r, data)
+	})
+}
+
+// MIDDLEWARE
+
+func recoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				requestLogger(r).Error(fmt.Sprintf("panic: %v", err), "stack", string(debug.Stack()))
+				http.Error(w, "Something went wrong. Request ID: "+requestId(r), 500)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin sends requests without an admin session to the login page.
+// API tokens do not count, they only open the /api routes.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("Session").(models.AdminUserSession); !ok {
+			http.Redirect(w, r, "/admin-login", http.StatusFound)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole lets through admins that have the role. RoleAdmin has every
+// role, editors may only work on the content.
+func (s *server) requireRole(role string, next http.Handler) http.Handler {
+	return requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.checkRole(w, r, role) {
+			next.ServeHTTP(w, r)
+		}
+	}))
+}
+
+// checkRole reports whether the logged in admin has the role, and answers
+// the request when not. The request must have passed requireAdmin.
+func (s *server) checkRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	current := r.Context().Value("Session").(models.AdminUserSession)
+	admin, err := s.admins.Get(r.Context(), current.AdminUser)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Redirect(w, r, "/admin-login", http.StatusFound)
+		return false
+	}
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return false
+	}
+
+	if admin.Role != role && admin.Role != models.RoleAdmin {
+		AccessDenied(w, r)
+		return false
+	}
+	return true
+}
+
+func parseFormHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+
+		if err != nil {
+			LogError(r, err)
+			InternalServerError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionHandler authenticates the request either by a bearer API token or by
+// the session cookie. A request that sends a bad token is rejected instead of
+// falling back to the cookie.
+func (s *server) sessionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if bearer := bearerToken(r); bearer != "" {
+			token, err := s.authenticateToken(r, bearer)
+			if err != nil {
+				if !errors.Is(err, repository.ErrNotFound) {
+					LogError(r, err)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Invalid or expired token.", http.StatusUnauthorized)
+				return
+			}
+
+			ctx = context.WithValue(r.Context(), "LoggedIn", true)
+			ctx = context.WithValue(ctx, "ApiToken", token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		adminSession, err := s.sessions.Load(r)
+		if err == session.ErrNotFound {
+			adminSession, err = s.sessions.Resume(w, r)
+		}
+
+		if err != nil {
+			if err != session.ErrNotFound {
+				LogError(r, err)
+			}
+			ctx = context.WithValue(r.Context(), "LoggedIn", false)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		err = s.sessions.Touch(w, r, adminSession)
+		if err != nil {
+			LogError(r, err)
+		}
+
+		ctx = context.WithValue(r.Context(), "LoggedIn", true)
+		ctx = context.WithValue(ctx, "Session", adminSession)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// func getPageDataHandler(next http.Handler) http.Handler {
+// 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// 		//use the url and get the page's data
+// 		data := database.GetPageByUrl(r.Context(), db, r.URL)
+// 		render(w, r, data)
+// 		// ctx := r.Context()
+// 		// ctx = context.WithValue(r.Context(), "LoggedIn", true)
+// 		// next.ServeHTTP(w, r.WithContext(ctx))
+// 	})
+// }
+
+// UTIL FUNC
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// authenticateToken looks the token up by its hash and records its use.
+// Unknown and expired tokens both return repository.ErrNotFound.
+func (s *server) authenticateToken(r *http.Request, value string) (models.ApiToken, error) {
+	token, err := s.tokens.GetByHash(r.Context(), apitoken.Hash(value))
+	if err != nil {
+		return token, err
+	}
+
+	if token.ExpiryDate.Valid && token.ExpiryDate.Time.Before(time.Now()) {
+		return models.ApiToken{}, repository.ErrNotFound
+	}
+
+	err = s.tokens.Touch(r.Context(), token.Id)
+	if err != nil {
+		LogError(r, err)
+	}
+
+	return token, nil
+}
+
+// newSessionManager builds the session manager for the configured store. The
+// cookie store has no remember-me support since its tokens could not be revoked.
+func newSessionManager(cfg config.Session, repo repository.Sessions) (*session.Manager, error) {
+	var store session.Store
+	var remember session.RememberStore
+
+	switch cfg.Store {
+	case "memory":
+		memoryStore := session.NewMemoryStore()
+		store, remember = memoryStore, memoryStore
+	case "cookie":
+		cookieStore, err := session.NewCookieStore([]byte(cfg.Secret))
+		if err != nil {
+			return nil, err
+		}
+		store = cookieStore
+	default:
+		store, remember = repo, repo
+	}
+
+	manager := session.NewManager(store, cfg.Lifetime)
+	manager.RememberStore = remember
+	manager.RememberLifetime = cfg.RememberLifetime
+	manager.ClientIP = GetIP
+
+	manager.Cookie.Name = cfg.Cookie.Name
+	manager.Cookie.RememberName = cfg.Cookie.Name + "_remember"
+	manager.Cookie.Domain = cfg.Cookie.Domain
+	manager.Cookie.Secure = cfg.Cookie.Secure
+
+	sameSite, err := cfg.Cookie.SameSiteMode()
+	if err != nil {
+		return nil, err
+	}
+	manager.Cookie.SameSite = sameSite
+
+	if err := manager.Cookie.Validate(); err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+func idString(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+func GetIP(r *http.Request) string {
+	forwarded := r.Header.Get("X-FORWARDED-FOR")
+	if forwarded != "" {
+		return forwarded
+	}
+	return r.RemoteAddr
+}
+
+// this is for testing purpose only
+func Test(w http.ResponseWriter, r *http.Request) {
+	page := models.Page{
+		Title:   "Test",
+		Content: "This is a test page.",
+	}
+	data := TemplateData{
+		Page: page,
+	}
+	render(w, r, data)
+}
+
+// general page rendering
+// potentially can pass in title, teaser, content, general message
+func render(w http.ResponseWriter, r *http.Request, data interface{}) {
+	renderPage(w, r, "layout.html", data)
+}
+
+func renderPage(w http.ResponseWriter, r *http.Request, fileName string, data interface{}) {
+	_, span := tracing.Start(r.Context(), "render "+fileName, tracing.KindInternal)
+	span.SetAttributes("template.name", fileName)
+	err := templates.ExecuteTemplate(w, fileName, data)
+	span.RecordError(err)
+	span.End()
+	checkError(w, r, err)
+}
+
+func checkError(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		LogError(r, err)
+		http.Error(w, "Something went wrong. Request ID: "+requestId(r), 500)
+	}
+}
+
+// LogError logs err with the request id of r. r may be nil outside of a
+// request.
+func LogError(r *http.Request, err error) {
+	requestLogger(r).Error(err.Error())
+}
@@ -0,0 +1,115 @@
+// Package media stores files, such as the attachments of an imported site,
+// in a directory and serves them.
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrName is returned for a name that cannot be stored.
+var ErrName = errors.New("media: invalid name")
+
+// unsafeChars are replaced in the segments of a name.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Store keeps media files under a directory. Names are slash separated paths
+// relative to it, such as 2021/05/photo.jpg.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// CleanName turns a path from elsewhere into a name the store accepts: every
+// segment keeps only letters, digits, dots, dashes and underscores, and
+// cannot start with a dot. It returns "" when nothing is left.
+func CleanName(name string) string {
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		segment = strings.TrimLeft(unsafeChars.ReplaceAllString(segment, "-"), ".-")
+		segment = strings.TrimRight(segment, "-")
+		if segment == "" {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *Store) path(name string) (string, error) {
+	if name == "" || CleanName(name) != name {
+		return "", fmt.Errorf("%w: %q", ErrName, name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+// Exists tells whether a file is stored under name.
+func (s *Store) Exists(name string) (bool, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Save stores what r reads under name, replacing the file stored there. The
+// file only appears once it is complete.
+func (s *Store) Save(name string, r io.Reader) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// ServeHTTP serves the file named by the request path, which has to have
+// the prefix the store is mounted under removed. Directories are not listed.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	p, err := s.path(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, p)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/annbelievable/go_listing/metrics"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/session"
+
+	"github.com/gorilla/mux"
+)
+
+var registry = metrics.NewRegistry()
+
+var (
+	httpRequests = registry.NewCounterVec("go_listing_http_requests_total",
+		"HTTP requests by route template, method and status class.", "route", "method", "code")
+	httpDuration = registry.NewHistogramVec("go_listing_http_request_duration_seconds",
+		"HTTP request latency by route template and method.", metrics.DefaultBuckets, "route", "method")
+	httpInFlight = registry.NewGaugeVec("go_listing_http_requests_in_flight",
+		"HTTP requests being served.")
+	loginAttempts = registry.NewCounterVec("go_listing_logins_total",
+		"Admin login attempts by method and result.", "method", "result")
+	activeSessions = registry.NewGaugeVec("go_listing_active_sessions",
+		"Live admin sessions, refreshed every minute.")
+	publishedPages = registry.NewGaugeVec("go_listing_published_pages",
+		"Pages visible on the site, refreshed every minute.")
+	activeListings = registry.NewGaugeVec("go_listing_active_listings",
+		"Active listings, refreshed every minute.")
+)
+
+// registerDatabaseMetrics exposes the statistics of the connection pool.
+func registerDatabaseMetrics(db *sql.DB) {
+	dbStats := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return fn(db.Stats())
+		}
+	}
+
+	registry.NewGaugeFunc("go_listing_db_max_open_connections", "Maximum number of open database connections.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	registry.NewGaugeFunc("go_listing_db_open_connections", "Open database connections, in use and idle.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	registry.NewGaugeFunc("go_listing_db_in_use_connections", "Database connections in use.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	registry.NewGaugeFunc("go_listing_db_idle_connections", "Idle database connections.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	registry.NewCounterFunc("go_listing_db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	registry.NewCounterFunc("go_listing_db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		dbStats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	registry.NewCounterFunc("go_listing_db_max_idle_closed_total", "Connections closed because of max_idle_conns.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	registry.NewCounterFunc("go_listing_db_max_idle_time_closed_total", "Connections closed because of conn_max_idle_time.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	registry.NewCounterFunc("go_listing_db_max_lifetime_closed_total", "Connections closed because of conn_max_lifetime.",
+		dbStats(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// Metrics writes every metric in the Prometheus text format.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := registry.WriteTo(w); err != nil {
+		LogError(r, err)
+	}
+}
+
+// metricsHandler counts and times every request. It wraps the router from the
+// outside so requests that match no route are counted too; those are grouped
+// under one label instead of their raw URL.
+func metricsHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(router, r)
+
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		router.ServeHTTP(rec, r)
+
+		httpDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+		httpRequests.Inc(route, r.Method, strconv.Itoa(rec.status/100)+"xx")
+	})
+}
+
+// refreshGauges updates the gauges that need a database query.
+func (s *server) refreshGauges(ctx context.Context) error {
+	count, err := s.sessions.Count(ctx)
+	if err == nil {
+		activeSessions.Set(float64(count))
+	} else if err != session.ErrNotSupported {
+		return err
+	}
+
+	count, err = s.pages.Count(ctx, models.PagePublished)
+	if err != nil {
+		return err
+	}
+	publishedPages.Set(float64(count))
+
+	count, err = s.listings.Count(ctx, models.ListingActive)
+	if err != nil {
+		return err
+	}
+	activeListings.Set(float64(count))
+
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit request latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics written by WriteTo.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in the order it was registered.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// vec keeps one value per combination of label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	keys   []string
+	values map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{name: name, help: help, kind: kind, labels: labels, values: make(map[string][]string)}
+}
+
+// key returns the map key of the label values, remembering new ones. The
+// caller holds mu.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	if _, ok := v.values[key]; !ok {
+		v.values[key] = append([]string(nil), values...)
+		v.keys = append(v.keys, key)
+		sort.Strings(v.keys)
+	}
+	return key
+}
+
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// labelPairs formats the labels of key, plus an extra pair when name is set.
+func (v *vec) labelPairs(key, extraName, extraValue string) string {
+	values := v.values[key]
+	if len(values) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range v.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", label, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// CounterVec is a counter split by labels.
+type CounterVec struct {
+	vec
+	counts map[string]float64
+}
+
+// NewCounterVec registers a counter. Without labels it is a plain counter.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels), counts: make(map[string]float64)}
+	if len(labels) == 0 {
+		c.Add(0)
+	}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(n float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.key(values)] += n
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, key := range c.keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(key, "", ""), formatFloat(c.counts[key]))
+	}
+}
+
+// GaugeVec is a gauge split by labels.
+type GaugeVec struct {
+	vec
+	gauges map[string]float64
+}
+
+// NewGaugeVec registers a gauge. Without labels it is a plain gauge.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, "gauge", labels), gauges: make(map[string]float64)}
+	if len(labels) == 0 {
+		g.Set(0)
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(n float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gauges[g.key(values)] = n
+}
+
+func (g *GaugeVec) Add(n float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gauges[g.key(values)] += n
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.header(w)
+	for _, key := range g.keys {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(key, "", ""), formatFloat(g.gauges[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations into buckets, split by labels.
+type HistogramVec struct {
+	vec
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds, which
+// must be sorted.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec:        newVec(name, help, "histogram", labels),
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.key(values)
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys {
+		hist := h.histograms[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatFloat(bound)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(key, "", ""), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(key, "", ""), hist.count)
+	}
+}
+
+// funcMetric reads its value when the metrics are written.
+type funcMetric struct {
+	name string
+	help string
+	kind string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape. fn must never return a smaller value than before.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS api_token;
+DROP TABLE IF EXISTS admin_remember_token;
+DROP TABLE IF EXISTS page;
+DROP TABLE IF EXISTS admin_user_session;
+DROP TABLE IF EXISTS admin_user;
\ No newline at end of file
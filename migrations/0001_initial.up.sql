@@ -0,0 +1,66 @@
+CREATE TABLE IF NOT EXISTS admin_user (
+id SERIAL PRIMARY KEY NOT NULL,
+email CHAR(255) NOT NULL,
+password CHAR(255) NOT NULL,
+role VARCHAR(32) NOT NULL DEFAULT 'admin',
+dateupdated TIMESTAMP NOT NULL,
+datecreated TIMESTAMP NOT NULL);
+
+ALTER TABLE admin_user ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'admin';
+
+CREATE TABLE IF NOT EXISTS admin_user_session (
+session_id VARCHAR(36) PRIMARY KEY NOT NULL,
+admin_user INTEGER REFERENCES admin_user,
+expiry_date TIMESTAMP NOT NULL,
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+ip_address VARCHAR(64) NOT NULL DEFAULT '',
+datecreated TIMESTAMP NOT NULL,
+last_seen TIMESTAMP NOT NULL);
+
+ALTER TABLE admin_user_session DROP CONSTRAINT IF EXISTS admin_user_session_admin_user_key;
+ALTER TABLE admin_user_session ADD COLUMN IF NOT EXISTS user_agent VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE admin_user_session ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE admin_user_session ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS admin_user_session_admin_user_idx ON admin_user_session(admin_user);
+
+CREATE TABLE IF NOT EXISTS page (
+id SERIAL PRIMARY KEY NOT NULL,
+title VARCHAR(255) NOT NULL,
+url VARCHAR(255) NOT NULL UNIQUE,
+teaser VARCHAR(255),
+content TEXT,
+dateupdated TIMESTAMP NOT NULL,
+datecreated TIMESTAMP NOT NULL);
+
+CREATE TABLE IF NOT EXISTS admin_remember_token (
+selector VARCHAR(24) PRIMARY KEY NOT NULL,
+token_hash VARCHAR(64) NOT NULL,
+admin_user INTEGER NOT NULL REFERENCES admin_user,
+expiry_date TIMESTAMP NOT NULL,
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+datecreated TIMESTAMP NOT NULL);
+
+CREATE TABLE IF NOT EXISTS api_token (
+id SERIAL PRIMARY KEY NOT NULL,
+admin_user INTEGER NOT NULL REFERENCES admin_user,
+name VARCHAR(255) NOT NULL,
+token_hash VARCHAR(64) NOT NULL UNIQUE,
+scopes VARCHAR(255) NOT NULL,
+expiry_date TIMESTAMP,
+last_used TIMESTAMP,
+datecreated TIMESTAMP NOT NULL);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+id BIGSERIAL PRIMARY KEY NOT NULL,
+actor_id INTEGER,
+actor_email VARCHAR(255) NOT NULL DEFAULT '',
+action VARCHAR(64) NOT NULL,
+entity_type VARCHAR(64) NOT NULL,
+entity_id VARCHAR(64) NOT NULL DEFAULT '',
+before_value TEXT NOT NULL DEFAULT '',
+after_value TEXT NOT NULL DEFAULT '',
+ip_address VARCHAR(64) NOT NULL DEFAULT '',
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+datecreated TIMESTAMP NOT NULL);
+
+CREATE INDEX IF NOT EXISTS audit_log_datecreated_idx ON audit_log(datecreated);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS listing;
\ No newline at end of file
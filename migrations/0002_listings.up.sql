@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS listing (
+id SERIAL PRIMARY KEY NOT NULL,
+external_id VARCHAR(255) NOT NULL DEFAULT '',
+title VARCHAR(255) NOT NULL,
+url VARCHAR(255) NOT NULL UNIQUE,
+description TEXT NOT NULL DEFAULT '',
+category VARCHAR(255) NOT NULL DEFAULT '',
+status VARCHAR(16) NOT NULL DEFAULT 'active',
+dateupdated TIMESTAMP NOT NULL,
+datecreated TIMESTAMP NOT NULL);
+
+-- listings created on the site have no external id, only imported ones must be unique
+CREATE UNIQUE INDEX IF NOT EXISTS listing_external_id_idx ON listing(external_id) WHERE external_id <> '';
+CREATE INDEX IF NOT EXISTS listing_status_idx ON listing(status);
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- the trash is emptied, its urls could clash once they are unique again
+DELETE FROM page WHERE datedeleted IS NOT NULL;
+DROP INDEX IF EXISTS page_datedeleted_idx;
+DROP INDEX IF EXISTS page_url_live_key;
+ALTER TABLE page ADD CONSTRAINT page_url_key UNIQUE (url);
+ALTER TABLE page DROP COLUMN IF EXISTS datedeleted;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- live pages keep unique urls, a trashed page may share its url with a new one
+ALTER TABLE page ADD COLUMN IF NOT EXISTS datedeleted TIMESTAMP NULL;
+ALTER TABLE page DROP CONSTRAINT IF EXISTS page_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS page_url_live_key ON page (url) WHERE datedeleted IS NULL;
+CREATE INDEX IF NOT EXISTS page_datedeleted_idx ON page (datedeleted) WHERE datedeleted IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS page_status_idx;
+ALTER TABLE page DROP COLUMN IF EXISTS status;
\ No newline at end of file
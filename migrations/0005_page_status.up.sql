@@ -0,0 +1,2 @@
+ALTER TABLE page ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published';
+CREATE INDEX IF NOT EXISTS page_status_idx ON page (status);
\ No newline at end of file
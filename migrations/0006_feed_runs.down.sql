@@ -0,0 +1 @@
+DROP TABLE IF EXISTS feed_run;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS feed_run (
+id BIGSERIAL PRIMARY KEY NOT NULL,
+feed VARCHAR(64) NOT NULL,
+items INTEGER NOT NULL DEFAULT 0,
+created INTEGER NOT NULL DEFAULT 0,
+updated INTEGER NOT NULL DEFAULT 0,
+unchanged INTEGER NOT NULL DEFAULT 0,
+expired INTEGER NOT NULL DEFAULT 0,
+failed INTEGER NOT NULL DEFAULT 0,
+-- error is why the whole run failed, item_errors holds one failed item per line
+error TEXT NOT NULL DEFAULT '',
+item_errors TEXT NOT NULL DEFAULT '',
+datestarted TIMESTAMP NOT NULL,
+datefinished TIMESTAMP NOT NULL);
+
+CREATE INDEX IF NOT EXISTS feed_run_feed_idx ON feed_run(feed, datestarted);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS redirect;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS redirect (
+id SERIAL PRIMARY KEY NOT NULL,
+-- path is matched against the request path, with the query for the ?p= style
+path VARCHAR(255) NOT NULL UNIQUE,
+target VARCHAR(255) NOT NULL,
+dateupdated TIMESTAMP NOT NULL);
\ No newline at end of file
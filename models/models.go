@@ -1,25 +1,130 @@
-package models
-
-import "time"
-
-type Page struct {
-	Id      uint64
-	Url     string
-	Title   string
-	Teaser  string
-	Content string
-	// Message string
-	// Errors  map[string]string
-}
-
-type AdminUser struct {
-	Id       uint64
-	Email    string
-	Password string
-}
-
-type AdminUserSession struct {
-	SessionId  string
-	AdminUser  uint64
-	ExpiryDate time.Time
-}
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	PagePublished = "published"
+	PageDraft     = "draft"
+)
+
+type Page struct {
+	Id      uint64
+	Url     string
+	Title   string
+	Teaser  string
+	Content string
+	Status  string
+	// Version counts the saves, an update must name the version it edited.
+	Version     int
+	DateUpdated time.Time
+	// DateDeleted is when the page went to the trash, zero for live pages.
+	DateDeleted time.Time
+	// Message string
+	// Errors  map[string]string
+}
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+)
+
+type AdminUser struct {
+	Id       uint64
+	Email    string
+	Password string
+	Role     string
+}
+
+type AdminUserSession struct {
+	SessionId   string
+	AdminUser   uint64
+	ExpiryDate  time.Time
+	UserAgent   string
+	IpAddress   string
+	DateCreated time.Time
+	LastSeen    time.Time
+}
+
+type AdminRememberToken struct {
+	Selector    string
+	TokenHash   string
+	AdminUser   uint64
+	ExpiryDate  time.Time
+	UserAgent   string
+	DateCreated time.Time
+}
+
+type ApiToken struct {
+	Id          uint64
+	AdminUser   uint64
+	AdminEmail  string
+	Name        string
+	TokenHash   string
+	Scopes      string
+	ExpiryDate  sql.NullTime
+	LastUsed    sql.NullTime
+	DateCreated time.Time
+}
+
+type AuditLog struct {
+	Id          uint64
+	ActorId     sql.NullInt64
+	ActorEmail  string
+	Action      string
+	EntityType  string
+	EntityId    string
+	Before      string
+	After       string
+	IpAddress   string
+	UserAgent   string
+	DateCreated time.Time
+}
+
+const (
+	ListingActive  = "active"
+	ListingExpired = "expired"
+)
+
+type Listing struct {
+	Id uint64
+	// ExternalId identifies an imported listing in its source, it is empty for
+	// listings created on the site.
+	ExternalId  string
+	Title       string
+	Url         string
+	Description string
+	Category    string
+	Status      string
+	DateUpdated time.Time
+	DateCreated time.Time
+}
+
+// FeedRun is the outcome of one import of a listing feed.
+type FeedRun struct {
+	Id        uint64
+	Feed      string
+	Items     int
+	Created   int
+	Updated   int
+	Unchanged int
+	Expired   int
+	Failed    int
+	// Error is why the run failed as a whole, ItemErrors why single items
+	// were not imported.
+	Error        string
+	ItemErrors   []string
+	DateStarted  time.Time
+	DateFinished time.Time
+}
+
+// Redirect sends requests for a path that moved, like the permalinks of an
+// imported site, to where the content is now.
+type Redirect struct {
+	Id          uint64
+	Path        string
+	Target      string
+	DateUpdated time.Time
+}
@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/annbelievable/go_listing/oidc/oidctest"
+)
+
+type countingTransport struct {
+	path  string
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == t.path {
+		atomic.AddInt32(&t.count, 1)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func fakeToken(kid string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"` + kid + `"}`))
+	return header + ".e30.AA"
+}
+
+func TestKeyRefetchInterval(t *testing.T) {
+	provider := oidctest.NewProvider("client", "secret")
+	defer provider.Close()
+
+	transport := &countingTransport{path: "/jwks"}
+	p, err := Discover(context.Background(), Config{
+		Issuer:     provider.Issuer(),
+		ClientID:   "client",
+		HTTPClient: &http.Client{Transport: transport},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kid := range []string{"fake-1", "fake-2", "fake-3", "fake-4"} {
+		if _, err := p.Verify(context.Background(), fakeToken(kid), ""); err == nil {
+			t.Fatalf("a token signed with %s was accepted", kid)
+		}
+	}
+	if transport.count != 1 {
+		t.Fatalf("fetched the key set %d times for made up key ids, want 1", transport.count)
+	}
+
+	// a rotated key is picked up once the interval has passed
+	p.mu.Lock()
+	p.keysFetch = time.Now().Add(-jwksRefetchInterval)
+	p.mu.Unlock()
+	if _, err := p.Verify(context.Background(), fakeToken("fake-5"), ""); err == nil {
+		t.Fatal("a token signed with fake-5 was accepted")
+	}
+	if transport.count != 2 {
+		t.Fatalf("fetched the key set %d times, want 2", transport.count)
+	}
+}
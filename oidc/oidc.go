@@ -0,0 +1,259 @@
+// Package oidc implements the parts of OpenID Connect needed to log admins in:
+// discovery, the authorization code flow with PKCE and ID token verification
+// against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes requested in addition to openid.
+	Scopes []string
+	// GroupsClaim names the ID token claim holding the user's groups.
+	GroupsClaim string
+	HTTPClient  *http.Client
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Provider is a discovered OpenID provider.
+type Provider struct {
+	config   Config
+	metadata metadata
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	keysFetch time.Time
+}
+
+// Claims are the ID token claims the admin login cares about.
+type Claims struct {
+	Subject string
+	Email   string
+	// EmailVerified is only true when the provider says so, an email it did
+	// not verify must not be matched to a local account.
+	EmailVerified bool
+	Groups        []string
+}
+
+// Discover fetches the provider metadata from the issuer's well-known URL.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	var m metadata
+	if err := getJSON(ctx, config.HTTPClient, wellKnown, &m); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+
+	if m.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch, expected %q got %q", config.Issuer, m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JwksURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	return &Provider{config: config, metadata: m}, nil
+}
+
+// NewPKCE returns a code verifier and its S256 challenge.
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns n random bytes encoded as base64url, for state and nonce values.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL is where the browser is sent to log in.
+func (p *Provider) AuthCodeURL(state, nonce, challenge string) string {
+	scopes := append([]string{"openid"}, p.config.Scopes...)
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", challenge)
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.metadata.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("code_verifier", verifier)
+	v.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.metadata.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token endpoint returned %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+
+	return token.IDToken, nil
+}
+
+// Verify checks the ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	var claims Claims
+
+	payload, err := p.verifySignature(ctx, rawIDToken)
+	if err != nil {
+		return claims, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return claims, fmt.Errorf("oidc: id token payload: %w", err)
+	}
+
+	if iss, _ := raw["iss"].(string); iss != p.metadata.Issuer {
+		return claims, fmt.Errorf("oidc: unexpected issuer %q", iss)
+	}
+
+	if !audienceContains(raw["aud"], p.config.ClientID) {
+		return claims, errors.New("oidc: id token was not issued for this client")
+	}
+
+	exp, _ := raw["exp"].(float64)
+	if time.Now().After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return claims, errors.New("oidc: id token has expired")
+	}
+
+	if got, _ := raw["nonce"].(string); got != nonce {
+		return claims, errors.New("oidc: nonce mismatch")
+	}
+
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Email, _ = raw["email"].(string)
+	// a provider that leaves the claim out has not verified the email
+	claims.EmailVerified, _ = raw["email_verified"].(bool)
+
+	switch groups := raw[p.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				claims.Groups = append(claims.Groups, s)
+			}
+		}
+	case string:
+		claims.Groups = []string{groups}
+	}
+
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/annbelievable/go_listing/repository"
+)
+
+// redirectPaths are the stored paths a request can match, most exact first:
+// with its query, as is, then with or without the trailing slash.
+func redirectPaths(u *url.URL) []string {
+	p := u.EscapedPath()
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, p+"?"+u.RawQuery)
+	}
+	// the front page is never redirected as a whole
+	if p == "/" {
+		return paths
+	}
+	paths = append(paths, p)
+	if strings.HasSuffix(p, "/") {
+		paths = append(paths, strings.TrimSuffix(p, "/"))
+	} else {
+		paths = append(paths, p+"/")
+	}
+	return paths
+}
+
+// redirectHandler answers requests for a path that moved with a permanent
+// redirect, and passes the others on to next.
+func (s *server) redirectHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, p := range redirectPaths(r.URL) {
+			redirect, err := s.redirects.Get(r.Context(), p)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				// the page is still missing, only the redirect failed
+				LogError(r, err)
+				break
+			}
+			if redirect.Target != r.URL.EscapedPath() {
+				http.Redirect(w, r, redirect.Target, http.StatusMovedPermanently)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,718 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/session"
+)
+
+// NewMemory returns empty repositories that live in process memory. They
+// enforce the same unique constraints as the database.
+func NewMemory() Repositories {
+	m := &memory{
+		lastIds:   make(map[string]uint64),
+		pages:     make(map[uint64]models.Page),
+		admins:    make(map[uint64]models.AdminUser),
+		listings:  make(map[uint64]models.Listing),
+		tokens:    make(map[uint64]models.ApiToken),
+		redirects: make(map[string]models.Redirect),
+	}
+
+	return Repositories{
+		Pages:     memoryPages{m},
+		Admins:    memoryAdmins{m},
+		Sessions:  session.NewMemoryStore(),
+		Listings:  memoryListings{m},
+		Tokens:    memoryTokens{m},
+		Audit:     memoryAudit{m},
+		FeedRuns:  memoryFeedRuns{m},
+		Redirects: memoryRedirects{m},
+	}
+}
+
+// memory holds the rows of every repository under one lock, tokens are read
+// together with their admin. Every table counts its ids from 1 like a SERIAL
+// column does.
+type memory struct {
+	mu       sync.Mutex
+	lastIds  map[string]uint64
+	pages    map[uint64]models.Page
+	admins   map[uint64]models.AdminUser
+	listings map[uint64]models.Listing
+	tokens   map[uint64]models.ApiToken
+	audit    []models.AuditLog
+	feedRuns []models.FeedRun
+	// redirects are keyed by their path
+	redirects map[string]models.Redirect
+}
+
+// now is the time as a TIMESTAMP column keeps it, in microseconds.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func (m *memory) nextId(table string) uint64 {
+	m.lastIds[table]++
+	return m.lastIds[table]
+}
+
+type memoryPages struct {
+	*memory
+}
+
+func (p memoryPages) Create(ctx context.Context, page models.Page) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.urlTaken(page.Url, 0) {
+		return 0, ErrUniqueViolation
+	}
+
+	if page.Status == "" {
+		page.Status = models.PagePublished
+	}
+	page.Id = p.nextId("page")
+	page.Version = 1
+	page.DateUpdated = now()
+	p.pages[page.Id] = page
+	return page.Id, nil
+}
+
+// urlTaken reports whether a live page other than except has the url.
+func (p memoryPages) urlTaken(url string, except uint64) bool {
+	for _, page := range p.pages {
+		if page.Url == url && page.Id != except && page.DateDeleted.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p memoryPages) Get(ctx context.Context, id uint64) (models.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	page, ok := p.pages[id]
+	if !ok || !page.DateDeleted.IsZero() {
+		return models.Page{}, ErrNotFound
+	}
+	return page, nil
+}
+
+func (p memoryPages) GetByUrl(ctx context.Context, url string) (models.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, page := range p.pages {
+		if page.Url == url && page.DateDeleted.IsZero() {
+			return page, nil
+		}
+	}
+	return models.Page{}, ErrNotFound
+}
+
+func (p memoryPages) List(ctx context.Context) ([]models.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var pages []models.Page
+	for _, page := range p.pages {
+		if page.DateDeleted.IsZero() {
+			pages = append(pages, page)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Url < pages[j].Url
+	})
+
+	return pages, nil
+}
+
+func (p memoryPages) Find(ctx context.Context, q PageQuery) (PageList, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	q = q.Normalize()
+	search := strings.ToLower(q.Search)
+	desc := q.Desc
+	cursor := q.After
+	if q.Before != nil {
+		cursor = q.Before
+		desc = !desc
+	}
+
+	// less orders by the sort value, then by id, in the direction read
+	less := func(a, b PageCursor) bool {
+		if a.Value != b.Value {
+			if desc {
+				return a.Value > b.Value
+			}
+			return a.Value < b.Value
+		}
+		if desc {
+			return a.Id > b.Id
+		}
+		return a.Id < b.Id
+	}
+
+	var pages []models.Page
+	for _, page := range p.pages {
+		switch {
+		case !page.DateDeleted.IsZero():
+			continue
+		case search != "" && !strings.Contains(strings.ToLower(page.Title), search) && !strings.Contains(strings.ToLower(page.Url), search):
+			continue
+		case q.Status != "" && page.Status != q.Status:
+			continue
+		case cursor != nil && !less(*cursor, pageCursor(page, q.Sort)):
+			continue
+		}
+
+		page.Content = ""
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return less(pageCursor(pages[i], q.Sort), pageCursor(pages[j], q.Sort))
+	})
+	if len(pages) > q.Limit+1 {
+		pages = pages[:q.Limit+1]
+	}
+
+	return database.NewPageList(pages, q), nil
+}
+
+func pageCursor(page models.Page, sort string) PageCursor {
+	return PageCursor{Value: database.PageSortValue(page, sort), Id: page.Id}
+}
+
+func (p memoryPages) Update(ctx context.Context, page models.Page) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.pages[page.Id]
+	if !ok || !existing.DateDeleted.IsZero() {
+		return ErrNotFound
+	}
+	if existing.Version != page.Version {
+		return ErrConflict
+	}
+	if p.urlTaken(page.Url, page.Id) {
+		return ErrUniqueViolation
+	}
+
+	page.Version++
+	page.DateUpdated = now()
+	p.pages[page.Id] = page
+	return nil
+}
+
+func (p memoryPages) Count(ctx context.Context, status string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	for _, page := range p.pages {
+		if page.DateDeleted.IsZero() && (status == "" || page.Status == status) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (p memoryPages) Trash(ctx context.Context, id uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	page, ok := p.pages[id]
+	if !ok || !page.DateDeleted.IsZero() {
+		return ErrNotFound
+	}
+
+	page.DateDeleted = time.Now()
+	p.pages[id] = page
+	return nil
+}
+
+func (p memoryPages) ListTrash(ctx context.Context) ([]models.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var pages []models.Page
+	for _, page := range p.pages {
+		if !page.DateDeleted.IsZero() {
+			page.Content = ""
+			pages = append(pages, page)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if !pages[i].DateDeleted.Equal(pages[j].DateDeleted) {
+			return pages[i].DateDeleted.After(pages[j].DateDeleted)
+		}
+		return pages[i].Id > pages[j].Id
+	})
+
+	return pages, nil
+}
+
+func (p memoryPages) Restore(ctx context.Context, id uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	page, ok := p.pages[id]
+	if !ok || page.DateDeleted.IsZero() {
+		return ErrNotFound
+	}
+	if p.urlTaken(page.Url, id) {
+		return ErrUniqueViolation
+	}
+
+	page.DateDeleted = time.Time{}
+	page.DateUpdated = now()
+	p.pages[id] = page
+	return nil
+}
+
+func (p memoryPages) Purge(ctx context.Context, id uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	page, ok := p.pages[id]
+	if !ok || page.DateDeleted.IsZero() {
+		return ErrNotFound
+	}
+
+	delete(p.pages, id)
+	return nil
+}
+
+func (p memoryPages) PurgeTrashed(ctx context.Context, before time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	purged := 0
+	for id, page := range p.pages {
+		if !page.DateDeleted.IsZero() && page.DateDeleted.Before(before) {
+			delete(p.pages, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+type memoryAdmins struct {
+	*memory
+}
+
+func (a memoryAdmins) Create(ctx context.Context, admin models.AdminUser) (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if admin.Role == "" {
+		admin.Role = models.RoleAdmin
+	}
+
+	admin.Id = a.nextId("admin_user")
+	a.admins[admin.Id] = admin
+	return admin.Id, nil
+}
+
+func (a memoryAdmins) Get(ctx context.Context, id uint64) (models.AdminUser, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	admin, ok := a.admins[id]
+	if !ok {
+		return models.AdminUser{}, ErrNotFound
+	}
+
+	// like the database, reading by id leaves out the password
+	admin.Password = ""
+	return admin, nil
+}
+
+func (a memoryAdmins) GetByEmail(ctx context.Context, email string) (models.AdminUser, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, admin := range a.admins {
+		if admin.Email == email {
+			return admin, nil
+		}
+	}
+	return models.AdminUser{}, ErrNotFound
+}
+
+func (a memoryAdmins) UpdateRole(ctx context.Context, id uint64, role string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	admin, ok := a.admins[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	admin.Role = role
+	a.admins[id] = admin
+	return nil
+}
+
+func (a memoryAdmins) UpdatePassword(ctx context.Context, id uint64, password string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	admin, ok := a.admins[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	admin.Password = password
+	a.admins[id] = admin
+	return nil
+}
+
+type memoryListings struct {
+	*memory
+}
+
+// conflicts reports whether listing shares its url or external id with
+// another listing.
+func (l memoryListings) conflicts(listing models.Listing) bool {
+	for _, existing := range l.listings {
+		if existing.Id == listing.Id {
+			continue
+		}
+		if existing.Url == listing.Url {
+			return true
+		}
+		if listing.ExternalId != "" && existing.ExternalId == listing.ExternalId {
+			return true
+		}
+	}
+	return false
+}
+
+func (l memoryListings) Create(ctx context.Context, listing models.Listing) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	listing.Id = 0
+	if l.conflicts(listing) {
+		return 0, ErrUniqueViolation
+	}
+
+	if listing.Status == "" {
+		listing.Status = models.ListingActive
+	}
+	listing.Id = l.nextId("listing")
+	listing.DateCreated = time.Now()
+	listing.DateUpdated = listing.DateCreated
+	l.listings[listing.Id] = listing
+	return listing.Id, nil
+}
+
+func (l memoryListings) Get(ctx context.Context, id uint64) (models.Listing, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	listing, ok := l.listings[id]
+	if !ok {
+		return models.Listing{}, ErrNotFound
+	}
+	return listing, nil
+}
+
+func (l memoryListings) GetByExternalId(ctx context.Context, externalId string) (models.Listing, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if externalId == "" {
+		return models.Listing{}, ErrNotFound
+	}
+	for _, listing := range l.listings {
+		if listing.ExternalId == externalId {
+			return listing, nil
+		}
+	}
+	return models.Listing{}, ErrNotFound
+}
+
+func (l memoryListings) GetByUrl(ctx context.Context, url string) (models.Listing, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, listing := range l.listings {
+		if listing.Url == url {
+			return listing, nil
+		}
+	}
+	return models.Listing{}, ErrNotFound
+}
+
+func (l memoryListings) List(ctx context.Context) ([]models.Listing, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var listings []models.Listing
+	for _, listing := range l.listings {
+		listings = append(listings, listing)
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].Url < listings[j].Url
+	})
+
+	return listings, nil
+}
+
+func (l memoryListings) Update(ctx context.Context, listing models.Listing) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	existing, ok := l.listings[listing.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if l.conflicts(listing) {
+		return ErrUniqueViolation
+	}
+
+	listing.DateCreated = existing.DateCreated
+	listing.DateUpdated = time.Now()
+	l.listings[listing.Id] = listing
+	return nil
+}
+
+func (l memoryListings) Delete(ctx context.Context, id uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.listings[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(l.listings, id)
+	return nil
+}
+
+func (l memoryListings) Count(ctx context.Context, status string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := 0
+	for _, listing := range l.listings {
+		if status == "" || listing.Status == status {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memoryTokens struct {
+	*memory
+}
+
+func (t memoryTokens) Create(ctx context.Context, token models.ApiToken) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, existing := range t.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return 0, ErrUniqueViolation
+		}
+	}
+
+	token.Id = t.nextId("api_token")
+	token.AdminEmail = ""
+	token.DateCreated = time.Now()
+	t.tokens[token.Id] = token
+	return token.Id, nil
+}
+
+// withAdmin fills in the email of the token's admin, as the join does in the
+// database.
+func (t memoryTokens) withAdmin(token models.ApiToken) models.ApiToken {
+	token.AdminEmail = t.admins[token.AdminUser].Email
+	return token
+}
+
+func (t memoryTokens) GetByHash(ctx context.Context, hash string) (models.ApiToken, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, token := range t.tokens {
+		if token.TokenHash == hash {
+			return t.withAdmin(token), nil
+		}
+	}
+	return models.ApiToken{}, ErrNotFound
+}
+
+func (t memoryTokens) List(ctx context.Context) ([]models.ApiToken, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var tokens []models.ApiToken
+	for _, token := range t.tokens {
+		tokens = append(tokens, t.withAdmin(token))
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Id > tokens[j].Id
+	})
+
+	return tokens, nil
+}
+
+func (t memoryTokens) Touch(ctx context.Context, id uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	token, ok := t.tokens[id]
+	if !ok {
+		return nil
+	}
+
+	token.LastUsed.Time = time.Now()
+	token.LastUsed.Valid = true
+	t.tokens[id] = token
+	return nil
+}
+
+func (t memoryTokens) Delete(ctx context.Context, id uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.tokens[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(t.tokens, id)
+	return nil
+}
+
+type memoryAudit struct {
+	*memory
+}
+
+func (a memoryAudit) Insert(ctx context.Context, entry models.AuditLog) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry.Id = a.nextId("audit_log")
+	entry.DateCreated = time.Now()
+	a.audit = append(a.audit, entry)
+	return nil
+}
+
+func (a memoryAudit) List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	actor := strings.ToLower(filter.Actor)
+	var entries []models.AuditLog
+	for i := len(a.audit) - 1; i >= 0; i-- {
+		entry := a.audit[i]
+		switch {
+		case actor != "" && !strings.Contains(strings.ToLower(entry.ActorEmail), actor):
+			continue
+		case filter.EntityType != "" && entry.EntityType != filter.EntityType:
+			continue
+		case !filter.From.IsZero() && entry.DateCreated.Before(filter.From):
+			continue
+		case !filter.To.IsZero() && !entry.DateCreated.Before(filter.To):
+			continue
+		}
+
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+func (a memoryAudit) EntityTypes(ctx context.Context) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var types []string
+	for _, entry := range a.audit {
+		if !seen[entry.EntityType] {
+			seen[entry.EntityType] = true
+			types = append(types, entry.EntityType)
+		}
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+type memoryFeedRuns struct {
+	*memory
+}
+
+func (f memoryFeedRuns) Insert(ctx context.Context, run models.FeedRun) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	run.Id = f.nextId("feed_run")
+	run.ItemErrors = append([]string(nil), run.ItemErrors...)
+	f.feedRuns = append(f.feedRuns, run)
+	return run.Id, nil
+}
+
+func (f memoryFeedRuns) List(ctx context.Context, feed string, limit int) ([]models.FeedRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var runs []models.FeedRun
+	for _, run := range f.feedRuns {
+		if feed == "" || run.Feed == feed {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if !runs[i].DateStarted.Equal(runs[j].DateStarted) {
+			return runs[i].DateStarted.After(runs[j].DateStarted)
+		}
+		return runs[i].Id > runs[j].Id
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+type memoryRedirects struct {
+	*memory
+}
+
+func (r memoryRedirects) Get(ctx context.Context, path string) (models.Redirect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redirect, ok := r.redirects[path]
+	if !ok {
+		return models.Redirect{}, ErrNotFound
+	}
+	return redirect, nil
+}
+
+func (r memoryRedirects) Save(ctx context.Context, redirect models.Redirect) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redirect.Id = r.redirects[redirect.Path].Id
+	if redirect.Id == 0 {
+		redirect.Id = r.nextId("redirect")
+	}
+	redirect.DateUpdated = now()
+	r.redirects[redirect.Path] = redirect
+	return nil
+}
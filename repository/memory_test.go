@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/repository/repositorytest"
+)
+
+func TestMemory(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repositories {
+		return repository.NewMemory()
+	})
+}
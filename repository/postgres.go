@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/session"
+)
+
+// NewPostgres returns the repositories backed by the database package.
+func NewPostgres(db *sql.DB) Repositories {
+	return Repositories{
+		Pages:     postgresPages{db: db},
+		Admins:    postgresAdmins{db: db},
+		Sessions:  session.NewPostgresStore(db),
+		Listings:  postgresListings{db: db},
+		Tokens:    postgresTokens{db: db},
+		Audit:     postgresAudit{db: db},
+		FeedRuns:  postgresFeedRuns{db: db},
+		Redirects: postgresRedirects{db: db},
+	}
+}
+
+type postgresPages struct {
+	db *sql.DB
+}
+
+func (p postgresPages) Create(ctx context.Context, page models.Page) (uint64, error) {
+	return database.InsertPage(ctx, p.db, page)
+}
+
+func (p postgresPages) Get(ctx context.Context, id uint64) (models.Page, error) {
+	return database.GetPageById(ctx, p.db, id)
+}
+
+func (p postgresPages) GetByUrl(ctx context.Context, url string) (models.Page, error) {
+	return database.GetPageByUrl(ctx, p.db, url)
+}
+
+func (p postgresPages) List(ctx context.Context) ([]models.Page, error) {
+	return database.GetPages(ctx, p.db)
+}
+
+func (p postgresPages) Update(ctx context.Context, page models.Page) error {
+	return database.InTx(ctx, p.db, func(tx *sql.Tx) error {
+		version, err := database.LockPageVersion(ctx, tx, page.Id)
+		if err != nil {
+			return err
+		}
+		if version != page.Version {
+			return ErrConflict
+		}
+
+		return database.UpdatePage(ctx, tx, page)
+	})
+}
+
+func (p postgresPages) Find(ctx context.Context, q PageQuery) (PageList, error) {
+	return database.FindPages(ctx, p.db, q)
+}
+
+func (p postgresPages) Count(ctx context.Context, status string) (int, error) {
+	return database.CountPages(ctx, p.db, status)
+}
+
+func (p postgresPages) Trash(ctx context.Context, id uint64) error {
+	return database.TrashPage(ctx, p.db, id)
+}
+
+func (p postgresPages) ListTrash(ctx context.Context) ([]models.Page, error) {
+	return database.GetTrashedPages(ctx, p.db)
+}
+
+func (p postgresPages) Restore(ctx context.Context, id uint64) error {
+	return database.RestorePage(ctx, p.db, id)
+}
+
+func (p postgresPages) Purge(ctx context.Context, id uint64) error {
+	return database.PurgePage(ctx, p.db, id)
+}
+
+func (p postgresPages) PurgeTrashed(ctx context.Context, before time.Time) (int, error) {
+	n, err := database.PurgeTrashedPages(ctx, p.db, before)
+	return int(n), err
+}
+
+type postgresAdmins struct {
+	db *sql.DB
+}
+
+func (a postgresAdmins) Create(ctx context.Context, admin models.AdminUser) (uint64, error) {
+	return database.InsertAdmin(ctx, a.db, admin)
+}
+
+func (a postgresAdmins) Get(ctx context.Context, id uint64) (models.AdminUser, error) {
+	return database.SelectAdminById(ctx, a.db, id)
+}
+
+func (a postgresAdmins) GetByEmail(ctx context.Context, email string) (models.AdminUser, error) {
+	return database.SelectAdmin(ctx, a.db, email)
+}
+
+func (a postgresAdmins) UpdateRole(ctx context.Context, id uint64, role string) error {
+	return database.UpdateAdminRole(ctx, a.db, id, role)
+}
+
+func (a postgresAdmins) UpdatePassword(ctx context.Context, id uint64, password string) error {
+	return database.UpdateAdminPassword(ctx, a.db, id, password)
+}
+
+type postgresListings struct {
+	db *sql.DB
+}
+
+func (l postgresListings) Create(ctx context.Context, listing models.Listing) (uint64, error) {
+	return database.InsertListing(ctx, l.db, listing)
+}
+
+func (l postgresListings) Get(ctx context.Context, id uint64) (models.Listing, error) {
+	return database.GetListingById(ctx, l.db, id)
+}
+
+func (l postgresListings) GetByExternalId(ctx context.Context, externalId string) (models.Listing, error) {
+	return database.GetListingByExternalId(ctx, l.db, externalId)
+}
+
+func (l postgresListings) GetByUrl(ctx context.Context, url string) (models.Listing, error) {
+	return database.GetListingByUrl(ctx, l.db, url)
+}
+
+func (l postgresListings) List(ctx context.Context) ([]models.Listing, error) {
+	return database.GetListings(ctx, l.db)
+}
+
+func (l postgresListings) Update(ctx context.Context, listing models.Listing) error {
+	return database.UpdateListing(ctx, l.db, listing)
+}
+
+func (l postgresListings) Delete(ctx context.Context, id uint64) error {
+	return database.DeleteListing(ctx, l.db, id)
+}
+
+func (l postgresListings) Count(ctx context.Context, status string) (int, error) {
+	return database.CountListings(ctx, l.db, status)
+}
+
+type postgresTokens struct {
+	db *sql.DB
+}
+
+func (t postgresTokens) Create(ctx context.Context, token models.ApiToken) (uint64, error) {
+	return database.InsertApiToken(ctx, t.db, token)
+}
+
+func (t postgresTokens) GetByHash(ctx context.Context, hash string) (models.ApiToken, error) {
+	return database.SelectApiTokenByHash(ctx, t.db, hash)
+}
+
+func (t postgresTokens) List(ctx context.Context) ([]models.ApiToken, error) {
+	return database.SelectApiTokens(ctx, t.db)
+}
+
+func (t postgresTokens) Touch(ctx context.Context, id uint64) error {
+	return database.UpdateApiTokenLastUsed(ctx, t.db, id)
+}
+
+func (t postgresTokens) Delete(ctx context.Context, id uint64) error {
+	return database.DeleteApiToken(ctx, t.db, id)
+}
+
+type postgresAudit struct {
+	db *sql.DB
+}
+
+func (a postgresAudit) Insert(ctx context.Context, entry models.AuditLog) error {
+	return database.InsertAuditLog(ctx, a.db, entry)
+}
+
+func (a postgresAudit) List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error) {
+	return database.SelectAuditLogs(ctx, a.db, filter)
+}
+
+func (a postgresAudit) EntityTypes(ctx context.Context) ([]string, error) {
+	return database.SelectAuditEntityTypes(ctx, a.db)
+}
+
+type postgresFeedRuns struct {
+	db *sql.DB
+}
+
+func (f postgresFeedRuns) Insert(ctx context.Context, run models.FeedRun) (uint64, error) {
+	return database.InsertFeedRun(ctx, f.db, run)
+}
+
+func (f postgresFeedRuns) List(ctx context.Context, feed string, limit int) ([]models.FeedRun, error) {
+	return database.GetFeedRuns(ctx, f.db, feed, limit)
+}
+
+type postgresRedirects struct {
+	db *sql.DB
+}
+
+func (r postgresRedirects) Get(ctx context.Context, path string) (models.Redirect, error) {
+	return database.GetRedirect(ctx, r.db, path)
+}
+
+func (r postgresRedirects) Save(ctx context.Context, redirect models.Redirect) error {
+	return database.SaveRedirect(ctx, r.db, redirect)
+}
@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/repository/repositorytest"
+)
+
+func TestPostgres(t *testing.T) {
+	db := repositorytest.OpenPostgres(t)
+	if db == nil {
+		t.Skip(repositorytest.EnvDatabaseURL + " is not set")
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repository.Repositories {
+		repositorytest.Reset(t, db)
+		return repository.NewPostgres(db)
+	})
+}
@@ -0,0 +1,152 @@
+// Package repository defines the storage the handlers depend on. Every
+// repository has a PostgreSQL implementation for the site and an in-memory one
+// for tests and development; both pass the suite in repositorytest.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/session"
+)
+
+// Errors returned by every implementation, check them with errors.Is.
+var (
+	ErrNotFound        = database.ErrNotFound
+	ErrUniqueViolation = database.ErrUniqueViolation
+	ErrTimeout         = database.ErrTimeout
+	ErrConflict        = database.ErrConflict
+)
+
+// AuditFilter narrows AuditLogs.List. Zero values match everything.
+type AuditFilter = database.AuditFilter
+
+// PageQuery selects a window of the page list for Pages.Find, PageList is
+// the window and PageCursor marks a row to page from.
+type (
+	PageQuery  = database.PageQuery
+	PageList   = database.PageList
+	PageCursor = database.PageCursor
+)
+
+// Columns a page list can be sorted by.
+const (
+	PageSortTitle   = database.PageSortTitle
+	PageSortUrl     = database.PageSortUrl
+	PageSortUpdated = database.PageSortUpdated
+	PageSortStatus  = database.PageSortStatus
+)
+
+// Pages stores the content pages. Deleted pages go to the trash, where only
+// the trash methods see them. Urls are unique among the live pages.
+type Pages interface {
+	Create(ctx context.Context, page models.Page) (uint64, error)
+	Get(ctx context.Context, id uint64) (models.Page, error)
+	GetByUrl(ctx context.Context, url string) (models.Page, error)
+	// List returns every page ordered by url.
+	List(ctx context.Context) ([]models.Page, error)
+	// Find returns the window of the list q selects, without the content.
+	Find(ctx context.Context, q PageQuery) (PageList, error)
+	// Update saves the page and bumps its version. It returns ErrConflict
+	// when page.Version is not the stored version any more.
+	Update(ctx context.Context, page models.Page) error
+	// Count counts the pages with the status, or all of them when status
+	// is empty.
+	Count(ctx context.Context, status string) (int, error)
+
+	// Trash moves a live page to the trash.
+	Trash(ctx context.Context, id uint64) error
+	// ListTrash returns the trashed pages without their content, most
+	// recently deleted first.
+	ListTrash(ctx context.Context) ([]models.Page, error)
+	// Restore makes a trashed page live again. It returns
+	// ErrUniqueViolation when a live page has its url.
+	Restore(ctx context.Context, id uint64) error
+	// Purge deletes a trashed page for good.
+	Purge(ctx context.Context, id uint64) error
+	// PurgeTrashed deletes the pages trashed before the given time and
+	// returns how many there were.
+	PurgeTrashed(ctx context.Context, before time.Time) (int, error)
+}
+
+// Admins stores the admin users. Password is the bcrypt hash.
+type Admins interface {
+	Create(ctx context.Context, admin models.AdminUser) (uint64, error)
+	Get(ctx context.Context, id uint64) (models.AdminUser, error)
+	GetByEmail(ctx context.Context, email string) (models.AdminUser, error)
+	UpdateRole(ctx context.Context, id uint64, role string) error
+	UpdatePassword(ctx context.Context, id uint64, password string) error
+}
+
+// Sessions stores admin sessions and remember-me tokens for session.Manager.
+type Sessions interface {
+	session.Store
+	session.RememberStore
+	session.Purger
+	session.Counter
+}
+
+// Listings stores the listings. Urls are unique, and so are external ids
+// that are not empty.
+type Listings interface {
+	Create(ctx context.Context, listing models.Listing) (uint64, error)
+	Get(ctx context.Context, id uint64) (models.Listing, error)
+	GetByExternalId(ctx context.Context, externalId string) (models.Listing, error)
+	GetByUrl(ctx context.Context, url string) (models.Listing, error)
+	// List returns every listing ordered by url.
+	List(ctx context.Context) ([]models.Listing, error)
+	Update(ctx context.Context, listing models.Listing) error
+	Delete(ctx context.Context, id uint64) error
+	// Count counts the listings with the status, or all of them when status
+	// is empty.
+	Count(ctx context.Context, status string) (int, error)
+}
+
+// Tokens stores personal API tokens. The admin email is filled in on read.
+type Tokens interface {
+	Create(ctx context.Context, token models.ApiToken) (uint64, error)
+	GetByHash(ctx context.Context, hash string) (models.ApiToken, error)
+	// List returns every token, newest first.
+	List(ctx context.Context) ([]models.ApiToken, error)
+	// Touch records that the token was just used.
+	Touch(ctx context.Context, id uint64) error
+	Delete(ctx context.Context, id uint64) error
+}
+
+// AuditLogs stores the audit trail.
+type AuditLogs interface {
+	Insert(ctx context.Context, entry models.AuditLog) error
+	// List returns the matching entries, newest first.
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error)
+	EntityTypes(ctx context.Context) ([]string, error)
+}
+
+// FeedRuns stores the history of the listing feed imports.
+type FeedRuns interface {
+	Insert(ctx context.Context, run models.FeedRun) (uint64, error)
+	// List returns the last runs of the feed, or of every feed when feed is
+	// empty, newest first.
+	List(ctx context.Context, feed string, limit int) ([]models.FeedRun, error)
+}
+
+// Redirects stores the paths that moved.
+type Redirects interface {
+	Get(ctx context.Context, path string) (models.Redirect, error)
+	// Save creates the redirect from its path, or points the existing one at
+	// the new target.
+	Save(ctx context.Context, redirect models.Redirect) error
+}
+
+// Repositories is everything the site stores.
+type Repositories struct {
+	Pages     Pages
+	Admins    Admins
+	Sessions  Sessions
+	Listings  Listings
+	Tokens    Tokens
+	Audit     AuditLogs
+	FeedRuns  FeedRuns
+	Redirects Redirects
+}
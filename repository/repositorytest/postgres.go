@@ -0,0 +1,55 @@
+package repositorytest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/annbelievable/go_listing/migrations"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// EnvDatabaseURL names the variable holding a throwaway PostgreSQL database
+// for tests. Every table in it is emptied, never point it at a database you
+// care about.
+const EnvDatabaseURL = "TEST_DATABASE_URL"
+
+// OpenPostgres connects to the database in EnvDatabaseURL and migrates it to
+// the latest version. It returns nil when the variable is not set. The pool is
+// closed when the test ends.
+func OpenPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(EnvDatabaseURL)
+	if dsn == "" {
+		return nil
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// Reset empties every table and restarts the id sequences.
+func Reset(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	_, err := db.Exec("TRUNCATE redirect, feed_run, listing, page, audit_log, api_token, admin_remember_token, admin_user_session, admin_user RESTART IDENTITY CASCADE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
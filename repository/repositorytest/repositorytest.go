@@ -0,0 +1,706 @@
+// Package repositorytest is the conformance suite every implementation of
+// the repository interfaces has to pass, so the in-memory repositories used
+// by tests behave like the PostgreSQL ones used by the site.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/session"
+)
+
+// Run runs the suite. newRepos is called for every test and must return
+// empty repositories.
+func Run(t *testing.T, newRepos func(t *testing.T) repository.Repositories) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repos repository.Repositories)
+	}{
+		{"Pages", testPages},
+		{"PageUniqueUrl", testPageUniqueUrl},
+		{"PageVersion", testPageVersion},
+		{"PageFind", testPageFind},
+		{"PageTrash", testPageTrash},
+		{"Admins", testAdmins},
+		{"Sessions", testSessions},
+		{"RememberTokens", testRememberTokens},
+		{"Listings", testListings},
+		{"ListingUniqueKeys", testListingUniqueKeys},
+		{"Tokens", testTokens},
+		{"Audit", testAudit},
+		{"FeedRuns", testFeedRuns},
+		{"Redirects", testRedirects},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newRepos(t))
+		})
+	}
+}
+
+func expectErr(t *testing.T, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createAdmin(t *testing.T, repos repository.Repositories, email string) uint64 {
+	t.Helper()
+	id, err := repos.Admins.Create(context.Background(), models.AdminUser{Email: email, Password: "hash"})
+	must(t, err)
+	return id
+}
+
+func testPages(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	pages := repos.Pages
+
+	_, err := pages.Get(ctx, 1)
+	expectErr(t, err, repository.ErrNotFound)
+
+	id, err := pages.Create(ctx, models.Page{Url: "/b", Title: "B", Teaser: "teaser", Content: "content"})
+	must(t, err)
+	_, err = pages.Create(ctx, models.Page{Url: "/a", Title: "A"})
+	must(t, err)
+
+	page, err := pages.Get(ctx, id)
+	must(t, err)
+	if page.DateUpdated.IsZero() {
+		t.Fatal("DateUpdated is not set")
+	}
+	want := models.Page{Id: id, Url: "/b", Title: "B", Teaser: "teaser", Content: "content", Status: models.PagePublished, Version: 1, DateUpdated: page.DateUpdated}
+	if page != want {
+		t.Fatalf("got %+v, want %+v", page, want)
+	}
+
+	page, err = pages.GetByUrl(ctx, "/b")
+	must(t, err)
+	if page.Id != id {
+		t.Fatalf("GetByUrl returned page %d, want %d", page.Id, id)
+	}
+	_, err = pages.GetByUrl(ctx, "/missing")
+	expectErr(t, err, repository.ErrNotFound)
+
+	list, err := pages.List(ctx)
+	must(t, err)
+	if len(list) != 2 || list[0].Url != "/a" || list[1].Url != "/b" {
+		t.Fatalf("List is not ordered by url: %+v", list)
+	}
+
+	page.Title = "B2"
+	must(t, pages.Update(ctx, page))
+	page, err = pages.Get(ctx, id)
+	must(t, err)
+	if page.Title != "B2" {
+		t.Fatalf("title after update is %q", page.Title)
+	}
+	expectErr(t, pages.Update(ctx, models.Page{Id: id + 100, Url: "/c"}), repository.ErrNotFound)
+
+	count, err := pages.Count(ctx, "")
+	must(t, err)
+	if count != 2 {
+		t.Fatalf("Count is %d, want 2", count)
+	}
+
+	must(t, pages.Trash(ctx, id))
+	_, err = pages.Get(ctx, id)
+	expectErr(t, err, repository.ErrNotFound)
+	expectErr(t, pages.Trash(ctx, id), repository.ErrNotFound)
+}
+
+func testPageFind(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	pages := repos.Pages
+
+	for _, page := range []models.Page{
+		{Url: "/e", Title: "echo", Content: "content"},
+		{Url: "/d", Title: "Delta", Status: models.PageDraft},
+		{Url: "/c", Title: "charlie"},
+		{Url: "/b", Title: "Bravo 100%", Status: models.PageDraft},
+		{Url: "/a", Title: "alpha"},
+	} {
+		_, err := pages.Create(ctx, page)
+		must(t, err)
+	}
+	trashed, err := pages.Create(ctx, models.Page{Url: "/f", Title: "foxtrot"})
+	must(t, err)
+	must(t, pages.Trash(ctx, trashed))
+
+	urls := func(list repository.PageList) string {
+		var urls []string
+		for _, page := range list.Pages {
+			if page.Content != "" {
+				t.Fatalf("Find returned the content of %s", page.Url)
+			}
+			urls = append(urls, page.Url)
+		}
+		return strings.Join(urls, " ")
+	}
+	expectList := func(q repository.PageQuery, want string, next, prev bool) repository.PageList {
+		t.Helper()
+		list, err := pages.Find(ctx, q)
+		must(t, err)
+		if got := urls(list); got != want {
+			t.Fatalf("Find(%+v) returned %q, want %q", q, got, want)
+		}
+		if (list.Next != nil) != next || (list.Prev != nil) != prev {
+			t.Fatalf("Find(%+v) has next %v and prev %v, want %v and %v", q, list.Next, list.Prev, next, prev)
+		}
+		return list
+	}
+
+	expectList(repository.PageQuery{}, "/a /b /c /d /e", false, false)
+	expectList(repository.PageQuery{Sort: "title", Desc: true}, "/e /d /c /b /a", false, false)
+	expectList(repository.PageQuery{Sort: "status"}, "/d /b /e /c /a", false, false)
+	expectList(repository.PageQuery{Search: "A"}, "/a /b /c /d", false, false)
+	expectList(repository.PageQuery{Search: "0%"}, "/b", false, false)
+	expectList(repository.PageQuery{Status: models.PageDraft}, "/b /d", false, false)
+
+	// walk forwards and back two at a time
+	first := expectList(repository.PageQuery{Limit: 2}, "/a /b", true, false)
+	second := expectList(repository.PageQuery{Limit: 2, After: first.Next}, "/c /d", true, true)
+	third := expectList(repository.PageQuery{Limit: 2, After: second.Next}, "/e", false, true)
+	second = expectList(repository.PageQuery{Limit: 2, Before: third.Prev}, "/c /d", true, true)
+	expectList(repository.PageQuery{Limit: 2, Before: second.Prev}, "/a /b", true, false)
+
+	first = expectList(repository.PageQuery{Sort: "updated", Desc: true, Limit: 3}, "/a /b /c", true, false)
+	expectList(repository.PageQuery{Sort: "updated", Desc: true, Limit: 3, After: first.Next}, "/d /e", false, true)
+
+	count, err := pages.Count(ctx, models.PageDraft)
+	must(t, err)
+	if count != 2 {
+		t.Fatalf("Count of drafts is %d, want 2", count)
+	}
+}
+
+func testPageTrash(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	pages := repos.Pages
+
+	id, err := pages.Create(ctx, models.Page{Url: "/a", Title: "A", Content: "content"})
+	must(t, err)
+	must(t, pages.Trash(ctx, id))
+
+	// a trashed page is gone for everything but the trash
+	_, err = pages.GetByUrl(ctx, "/a")
+	expectErr(t, err, repository.ErrNotFound)
+	expectErr(t, pages.Update(ctx, models.Page{Id: id, Url: "/a", Title: "A", Version: 1}), repository.ErrNotFound)
+	list, err := pages.List(ctx)
+	must(t, err)
+	count, err := pages.Count(ctx, "")
+	must(t, err)
+	if len(list) != 0 || count != 0 {
+		t.Fatalf("List and Count include the trashed page: %+v, %d", list, count)
+	}
+
+	trash, err := pages.ListTrash(ctx)
+	must(t, err)
+	if len(trash) != 1 || trash[0].Id != id || trash[0].Url != "/a" || trash[0].DateDeleted.IsZero() || trash[0].Content != "" {
+		t.Fatalf("ListTrash returned %+v", trash)
+	}
+
+	// its url is free, which blocks restoring it while taken
+	newId, err := pages.Create(ctx, models.Page{Url: "/a", Title: "New A"})
+	must(t, err)
+	expectErr(t, pages.Restore(ctx, id), repository.ErrUniqueViolation)
+	must(t, pages.Trash(ctx, newId))
+	must(t, pages.Restore(ctx, id))
+	expectErr(t, pages.Restore(ctx, id), repository.ErrNotFound)
+
+	page, err := pages.GetByUrl(ctx, "/a")
+	must(t, err)
+	if page.Id != id || page.Content != "content" {
+		t.Fatalf("restored page is %+v", page)
+	}
+
+	expectErr(t, pages.Purge(ctx, id), repository.ErrNotFound)
+	must(t, pages.Purge(ctx, newId))
+	expectErr(t, pages.Purge(ctx, newId), repository.ErrNotFound)
+
+	must(t, pages.Trash(ctx, id))
+	purged, err := pages.PurgeTrashed(ctx, time.Now().Add(-time.Hour))
+	must(t, err)
+	if purged != 0 {
+		t.Fatalf("purged %d pages trashed within the retention", purged)
+	}
+	purged, err = pages.PurgeTrashed(ctx, time.Now().Add(time.Second))
+	must(t, err)
+	trash, err = pages.ListTrash(ctx)
+	must(t, err)
+	if purged != 1 || len(trash) != 0 {
+		t.Fatalf("purged %d pages, %d left in the trash", purged, len(trash))
+	}
+}
+
+func testPageUniqueUrl(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	pages := repos.Pages
+
+	_, err := pages.Create(ctx, models.Page{Url: "/a", Title: "A"})
+	must(t, err)
+	_, err = pages.Create(ctx, models.Page{Url: "/a", Title: "Again"})
+	expectErr(t, err, repository.ErrUniqueViolation)
+
+	id, err := pages.Create(ctx, models.Page{Url: "/b", Title: "B"})
+	must(t, err)
+	expectErr(t, pages.Update(ctx, models.Page{Id: id, Url: "/a", Title: "B", Version: 1}), repository.ErrUniqueViolation)
+
+	// keeping its own url is not a conflict
+	must(t, pages.Update(ctx, models.Page{Id: id, Url: "/b", Title: "B2", Version: 1}))
+}
+
+func testPageVersion(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	pages := repos.Pages
+
+	id, err := pages.Create(ctx, models.Page{Url: "/a", Title: "A"})
+	must(t, err)
+	first, err := pages.Get(ctx, id)
+	must(t, err)
+	second := first
+
+	first.Title = "First"
+	must(t, pages.Update(ctx, first))
+
+	// the second editor still holds version 1
+	second.Title = "Second"
+	expectErr(t, pages.Update(ctx, second), repository.ErrConflict)
+
+	page, err := pages.Get(ctx, id)
+	must(t, err)
+	if page.Title != "First" || page.Version != 2 {
+		t.Fatalf("after the conflict the page is %+v, want the first save at version 2", page)
+	}
+
+	second.Version = page.Version
+	must(t, pages.Update(ctx, second))
+	page, err = pages.Get(ctx, id)
+	must(t, err)
+	if page.Title != "Second" || page.Version != 3 {
+		t.Fatalf("after saving again the page is %+v, want the second save at version 3", page)
+	}
+}
+
+func testAdmins(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	admins := repos.Admins
+
+	_, err := admins.GetByEmail(ctx, "nobody@example.com")
+	expectErr(t, err, repository.ErrNotFound)
+
+	id, err := admins.Create(ctx, models.AdminUser{Email: "admin@example.com", Password: "hash"})
+	must(t, err)
+	editorId, err := admins.Create(ctx, models.AdminUser{Email: "editor@example.com", Password: "hash", Role: models.RoleEditor})
+	must(t, err)
+	if id == editorId {
+		t.Fatal("two admins got the same id")
+	}
+
+	admin, err := admins.GetByEmail(ctx, "admin@example.com")
+	must(t, err)
+	want := models.AdminUser{Id: id, Email: "admin@example.com", Password: "hash", Role: models.RoleAdmin}
+	if admin != want {
+		t.Fatalf("got %+v, want %+v", admin, want)
+	}
+
+	admin, err = admins.Get(ctx, editorId)
+	must(t, err)
+	if admin.Email != "editor@example.com" || admin.Role != models.RoleEditor || admin.Password != "" {
+		t.Fatalf("Get returned %+v", admin)
+	}
+
+	must(t, admins.UpdateRole(ctx, id, models.RoleEditor))
+	must(t, admins.UpdatePassword(ctx, id, "new hash"))
+	admin, err = admins.GetByEmail(ctx, "admin@example.com")
+	must(t, err)
+	if admin.Role != models.RoleEditor || admin.Password != "new hash" {
+		t.Fatalf("update was not stored: %+v", admin)
+	}
+
+	_, err = admins.Get(ctx, id+100)
+	expectErr(t, err, repository.ErrNotFound)
+	expectErr(t, admins.UpdateRole(ctx, id+100, models.RoleAdmin), repository.ErrNotFound)
+	expectErr(t, admins.UpdatePassword(ctx, id+100, "hash"), repository.ErrNotFound)
+}
+
+func newSession(id string, adminId uint64, lastSeen time.Time, expires time.Time) models.AdminUserSession {
+	return models.AdminUserSession{
+		SessionId:   id,
+		AdminUser:   adminId,
+		ExpiryDate:  expires,
+		UserAgent:   "test",
+		IpAddress:   "127.0.0.1",
+		DateCreated: lastSeen,
+		LastSeen:    lastSeen,
+	}
+}
+
+func testSessions(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	store := repos.Sessions
+	adminId := createAdmin(t, repos, "admin@example.com")
+	otherId := createAdmin(t, repos, "other@example.com")
+	now := time.Now()
+
+	_, err := store.Load(ctx, "00000000-0000-0000-0000-000000000000")
+	expectErr(t, err, session.ErrNotFound)
+
+	old := newSession("00000000-0000-0000-0000-000000000001", adminId, now.Add(-time.Hour), now.Add(time.Hour))
+	recent := newSession("00000000-0000-0000-0000-000000000002", adminId, now, now.Add(time.Hour))
+	other := newSession("00000000-0000-0000-0000-000000000003", otherId, now, now.Add(time.Hour))
+	expired := newSession("00000000-0000-0000-0000-000000000004", adminId, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	for _, s := range []models.AdminUserSession{old, recent, other, expired} {
+		token, err := store.Save(ctx, s)
+		must(t, err)
+		if token != s.SessionId {
+			t.Fatalf("Save returned token %q, want the session id", token)
+		}
+	}
+
+	loaded, err := store.Load(ctx, recent.SessionId)
+	must(t, err)
+	if loaded.AdminUser != adminId || loaded.UserAgent != "test" || loaded.IpAddress != "127.0.0.1" {
+		t.Fatalf("Load returned %+v", loaded)
+	}
+
+	list, err := store.List(ctx, adminId)
+	must(t, err)
+	if len(list) != 2 || list[0].SessionId != recent.SessionId || list[1].SessionId != old.SessionId {
+		t.Fatalf("List should return the live sessions, most recently seen first: %+v", list)
+	}
+
+	count, err := store.Count(ctx)
+	must(t, err)
+	if count != 3 {
+		t.Fatalf("Count is %d, want 3", count)
+	}
+
+	must(t, store.Purge(ctx))
+	_, err = store.Load(ctx, expired.SessionId)
+	expectErr(t, err, session.ErrNotFound)
+
+	must(t, store.Delete(ctx, old.SessionId))
+	_, err = store.Load(ctx, old.SessionId)
+	expectErr(t, err, session.ErrNotFound)
+	must(t, store.Delete(ctx, old.SessionId))
+}
+
+func testRememberTokens(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	store := repos.Sessions
+	adminId := createAdmin(t, repos, "admin@example.com")
+	now := time.Now()
+
+	_, err := store.LoadRemember(ctx, "missing")
+	expectErr(t, err, session.ErrNotFound)
+
+	tokens := []models.AdminRememberToken{
+		{Selector: "older", TokenHash: "hash1", AdminUser: adminId, ExpiryDate: now.Add(time.Hour), DateCreated: now.Add(-time.Hour)},
+		{Selector: "newer", TokenHash: "hash2", AdminUser: adminId, ExpiryDate: now.Add(time.Hour), DateCreated: now},
+		{Selector: "expired", TokenHash: "hash3", AdminUser: adminId, ExpiryDate: now.Add(-time.Hour), DateCreated: now.Add(-2 * time.Hour)},
+	}
+	for _, token := range tokens {
+		must(t, store.SaveRemember(ctx, token))
+	}
+
+	token, err := store.LoadRemember(ctx, "newer")
+	must(t, err)
+	if token.TokenHash != "hash2" || token.AdminUser != adminId {
+		t.Fatalf("LoadRemember returned %+v", token)
+	}
+
+	list, err := store.ListRemember(ctx, adminId)
+	must(t, err)
+	if len(list) != 2 || list[0].Selector != "newer" || list[1].Selector != "older" {
+		t.Fatalf("ListRemember should return the live tokens, newest first: %+v", list)
+	}
+
+	must(t, store.Purge(ctx))
+	_, err = store.LoadRemember(ctx, "expired")
+	expectErr(t, err, session.ErrNotFound)
+
+	must(t, store.DeleteRemember(ctx, "older"))
+	_, err = store.LoadRemember(ctx, "older")
+	expectErr(t, err, session.ErrNotFound)
+}
+
+func testListings(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	listings := repos.Listings
+
+	_, err := listings.Get(ctx, 1)
+	expectErr(t, err, repository.ErrNotFound)
+
+	id, err := listings.Create(ctx, models.Listing{
+		ExternalId:  "feed-1",
+		Title:       "Flat",
+		Url:         "/listings/flat",
+		Description: "Two rooms",
+		Category:    "housing",
+	})
+	must(t, err)
+	_, err = listings.Create(ctx, models.Listing{Title: "Bike", Url: "/listings/bike", Status: models.ListingExpired})
+	must(t, err)
+
+	listing, err := listings.Get(ctx, id)
+	must(t, err)
+	if listing.ExternalId != "feed-1" || listing.Title != "Flat" || listing.Description != "Two rooms" ||
+		listing.Category != "housing" || listing.Status != models.ListingActive {
+		t.Fatalf("Get returned %+v", listing)
+	}
+	if listing.DateCreated.IsZero() || listing.DateUpdated.IsZero() {
+		t.Fatalf("dates were not set: %+v", listing)
+	}
+
+	listing, err = listings.GetByExternalId(ctx, "feed-1")
+	must(t, err)
+	if listing.Id != id {
+		t.Fatalf("GetByExternalId returned listing %d, want %d", listing.Id, id)
+	}
+	_, err = listings.GetByExternalId(ctx, "")
+	expectErr(t, err, repository.ErrNotFound)
+
+	listing, err = listings.GetByUrl(ctx, "/listings/flat")
+	must(t, err)
+	if listing.Id != id {
+		t.Fatalf("GetByUrl returned listing %d, want %d", listing.Id, id)
+	}
+	_, err = listings.GetByUrl(ctx, "/listings/none")
+	expectErr(t, err, repository.ErrNotFound)
+
+	list, err := listings.List(ctx)
+	must(t, err)
+	if len(list) != 2 || list[0].Url != "/listings/bike" || list[1].Url != "/listings/flat" {
+		t.Fatalf("List is not ordered by url: %+v", list)
+	}
+
+	for status, want := range map[string]int{"": 2, models.ListingActive: 1, models.ListingExpired: 1} {
+		count, err := listings.Count(ctx, status)
+		must(t, err)
+		if count != want {
+			t.Fatalf("Count(%q) is %d, want %d", status, count, want)
+		}
+	}
+
+	listing.Status = models.ListingExpired
+	listing.Title = "Flat, taken"
+	must(t, listings.Update(ctx, listing))
+	listing, err = listings.Get(ctx, id)
+	must(t, err)
+	if listing.Status != models.ListingExpired || listing.Title != "Flat, taken" {
+		t.Fatalf("update was not stored: %+v", listing)
+	}
+	expectErr(t, listings.Update(ctx, models.Listing{Id: id + 100, Url: "/x"}), repository.ErrNotFound)
+
+	must(t, listings.Delete(ctx, id))
+	_, err = listings.Get(ctx, id)
+	expectErr(t, err, repository.ErrNotFound)
+	expectErr(t, listings.Delete(ctx, id), repository.ErrNotFound)
+}
+
+func testListingUniqueKeys(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	listings := repos.Listings
+
+	_, err := listings.Create(ctx, models.Listing{ExternalId: "a", Title: "A", Url: "/a"})
+	must(t, err)
+	_, err = listings.Create(ctx, models.Listing{ExternalId: "b", Title: "A", Url: "/a"})
+	expectErr(t, err, repository.ErrUniqueViolation)
+	_, err = listings.Create(ctx, models.Listing{ExternalId: "a", Title: "A", Url: "/a2"})
+	expectErr(t, err, repository.ErrUniqueViolation)
+
+	// listings created on the site share the empty external id
+	_, err = listings.Create(ctx, models.Listing{Title: "C", Url: "/c"})
+	must(t, err)
+	id, err := listings.Create(ctx, models.Listing{Title: "D", Url: "/d"})
+	must(t, err)
+
+	expectErr(t, listings.Update(ctx, models.Listing{Id: id, ExternalId: "a", Title: "D", Url: "/d", Status: models.ListingActive}), repository.ErrUniqueViolation)
+}
+
+func testTokens(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	tokens := repos.Tokens
+	adminId := createAdmin(t, repos, "admin@example.com")
+
+	_, err := tokens.GetByHash(ctx, "missing")
+	expectErr(t, err, repository.ErrNotFound)
+
+	firstId, err := tokens.Create(ctx, models.ApiToken{AdminUser: adminId, Name: "first", TokenHash: "hash1", Scopes: "pages:read"})
+	must(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = tokens.Create(ctx, models.ApiToken{AdminUser: adminId, Name: "second", TokenHash: "hash2", Scopes: "pages:write"})
+	must(t, err)
+	_, err = tokens.Create(ctx, models.ApiToken{AdminUser: adminId, Name: "again", TokenHash: "hash1"})
+	expectErr(t, err, repository.ErrUniqueViolation)
+
+	token, err := tokens.GetByHash(ctx, "hash1")
+	must(t, err)
+	if token.Id != firstId || token.Name != "first" || token.AdminEmail != "admin@example.com" || token.Scopes != "pages:read" || token.LastUsed.Valid {
+		t.Fatalf("GetByHash returned %+v", token)
+	}
+
+	list, err := tokens.List(ctx)
+	must(t, err)
+	if len(list) != 2 || list[0].Name != "second" || list[1].Name != "first" {
+		t.Fatalf("List should return the newest token first: %+v", list)
+	}
+
+	must(t, tokens.Touch(ctx, token.Id))
+	token, err = tokens.GetByHash(ctx, "hash1")
+	must(t, err)
+	if !token.LastUsed.Valid {
+		t.Fatal("Touch did not record the use")
+	}
+
+	must(t, tokens.Delete(ctx, token.Id))
+	_, err = tokens.GetByHash(ctx, "hash1")
+	expectErr(t, err, repository.ErrNotFound)
+	expectErr(t, tokens.Delete(ctx, token.Id), repository.ErrNotFound)
+}
+
+func testAudit(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	audit := repos.Audit
+
+	entries := []models.AuditLog{
+		{ActorEmail: "Admin@Example.com", Action: "page.create", EntityType: "page", EntityId: "1"},
+		{ActorEmail: "editor@example.com", Action: "page.update", EntityType: "page", EntityId: "1"},
+		{ActorEmail: "admin@example.com", Action: "admin.login", EntityType: "admin_user"},
+	}
+	for _, entry := range entries {
+		must(t, audit.Insert(ctx, entry))
+	}
+
+	list, err := audit.List(ctx, repository.AuditFilter{})
+	must(t, err)
+	if len(list) != 3 || list[0].Action != "admin.login" || list[2].Action != "page.create" {
+		t.Fatalf("List should return the newest entry first: %+v", list)
+	}
+	if list[0].DateCreated.IsZero() {
+		t.Fatal("the date was not set")
+	}
+
+	list, err = audit.List(ctx, repository.AuditFilter{Actor: "admin@"})
+	must(t, err)
+	if len(list) != 2 {
+		t.Fatalf("the actor filter should match case-insensitively, got %+v", list)
+	}
+
+	for _, wildcard := range []string{"_", "%"} {
+		list, err = audit.List(ctx, repository.AuditFilter{Actor: wildcard})
+		must(t, err)
+		if len(list) != 0 {
+			t.Fatalf("the actor filter %q should match itself only, got %+v", wildcard, list)
+		}
+	}
+
+	list, err = audit.List(ctx, repository.AuditFilter{EntityType: "page", Limit: 1})
+	must(t, err)
+	if len(list) != 1 || list[0].Action != "page.update" {
+		t.Fatalf("entity type filter with limit returned %+v", list)
+	}
+
+	list, err = audit.List(ctx, repository.AuditFilter{From: time.Now().Add(time.Hour)})
+	must(t, err)
+	if len(list) != 0 {
+		t.Fatalf("the from filter returned %+v", list)
+	}
+
+	types, err := audit.EntityTypes(ctx)
+	must(t, err)
+	if len(types) != 2 || types[0] != "admin_user" || types[1] != "page" {
+		t.Fatalf("EntityTypes returned %v", types)
+	}
+}
+
+func testFeedRuns(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	runs := repos.FeedRuns
+
+	list, err := runs.List(ctx, "", 10)
+	must(t, err)
+	if len(list) != 0 {
+		t.Fatalf("List of no runs returned %+v", list)
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, feed := range []string{"partner", "other", "partner"} {
+		_, err := runs.Insert(ctx, models.FeedRun{
+			Feed:         feed,
+			Items:        3,
+			Created:      1,
+			Updated:      i,
+			Failed:       1,
+			ItemErrors:   []string{"line 2 (a): title: This field is required.", "line 3 (b): status: Choose one of active, expired."},
+			DateStarted:  start.Add(time.Duration(i) * time.Minute),
+			DateFinished: start.Add(time.Duration(i)*time.Minute + time.Second),
+		})
+		must(t, err)
+	}
+	_, err = runs.Insert(ctx, models.FeedRun{Feed: "partner", Error: "fetching: 500 Internal Server Error", DateStarted: start.Add(-time.Minute), DateFinished: start})
+	must(t, err)
+
+	list, err = runs.List(ctx, "partner", 2)
+	must(t, err)
+	if len(list) != 2 || list[0].Updated != 2 || list[1].Updated != 0 {
+		t.Fatalf("List is not the newest runs of the feed: %+v", list)
+	}
+	run := list[0]
+	if run.Feed != "partner" || run.Items != 3 || run.Created != 1 || run.Failed != 1 || !run.DateStarted.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("run was not stored: %+v", run)
+	}
+	if len(run.ItemErrors) != 2 || run.ItemErrors[1] != "line 3 (b): status: Choose one of active, expired." {
+		t.Fatalf("item errors were not stored: %q", run.ItemErrors)
+	}
+
+	list, err = runs.List(ctx, "", 10)
+	must(t, err)
+	if len(list) != 4 || list[3].Error != "fetching: 500 Internal Server Error" {
+		t.Fatalf("List of every feed returned %+v", list)
+	}
+}
+
+func testRedirects(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	redirects := repos.Redirects
+
+	if _, err := redirects.Get(ctx, "/2021/05/hello/"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Get of a missing redirect returned %v, want ErrNotFound", err)
+	}
+
+	must(t, redirects.Save(ctx, models.Redirect{Path: "/2021/05/hello/", Target: "/hello"}))
+	must(t, redirects.Save(ctx, models.Redirect{Path: "/?p=12", Target: "/hello"}))
+	first, err := redirects.Get(ctx, "/2021/05/hello/")
+	must(t, err)
+	if first.Id == 0 || first.Target != "/hello" || first.DateUpdated.IsZero() {
+		t.Fatalf("redirect was not stored: %+v", first)
+	}
+
+	// saving the same path again moves the redirect instead of adding one
+	must(t, redirects.Save(ctx, models.Redirect{Path: "/2021/05/hello/", Target: "/hello-world"}))
+	moved, err := redirects.Get(ctx, "/2021/05/hello/")
+	must(t, err)
+	if moved.Id != first.Id || moved.Target != "/hello-world" {
+		t.Fatalf("Save of an existing path returned %+v, was %+v", moved, first)
+	}
+	if other, err := redirects.Get(ctx, "/?p=12"); err != nil || other.Target != "/hello" {
+		t.Fatalf("Get with a query returned %+v, %v", other, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/media"
+	"github.com/annbelievable/go_listing/oidc"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/session"
+	"github.com/annbelievable/go_listing/worker"
+)
+
+// draining is set to 1 once shutdown has begun.
+var draining int32
+
+// server holds what the handlers depend on. serve builds it over PostgreSQL,
+// tests over repository.NewMemory.
+type server struct {
+	pages     repository.Pages
+	admins    repository.Admins
+	listings  repository.Listings
+	tokens    repository.Tokens
+	audit     repository.AuditLogs
+	feedRuns  repository.FeedRuns
+	redirects repository.Redirects
+	sessions  *session.Manager
+	workers   *worker.Group
+	// tasks runs the bulk actions too large to wait for.
+	tasks *worker.Tasks
+	// imports keeps uploaded files between the steps of an import.
+	imports *importUploads
+	// feeds are the listing feeds imported on a schedule.
+	feeds []config.Feed
+	// feedClient fetches the feeds that have a url.
+	feedClient *http.Client
+	feedLocks  *feedLocks
+	// media stores the files served under /media/, nil serves none.
+	media *media.Store
+	// trashRetention is how long deleted pages are kept, 0 keeps them.
+	trashRetention time.Duration
+	// db is the pool behind the repositories, nil when they live in memory.
+	db *sql.DB
+	// sso configures admin login through an OpenID provider.
+	sso ssoSettings
+	// passwordLogin allows logging in and registering with a password.
+	passwordLogin bool
+	ssoMu         sync.Mutex
+	provider      *oidc.Provider
+}
+
+func newServer(repos repository.Repositories, sessions *session.Manager) *server {
+	return &server{
+		pages:      repos.Pages,
+		admins:     repos.Admins,
+		listings:   repos.Listings,
+		tokens:     repos.Tokens,
+		audit:      repos.Audit,
+		feedRuns:   repos.FeedRuns,
+		redirects:  repos.Redirects,
+		sessions:   sessions,
+		workers:    worker.NewGroup(),
+		tasks:      worker.NewTasks(),
+		imports:    newImportUploads(),
+		feedClient: &http.Client{Timeout: feedTimeout},
+		feedLocks:  newFeedLocks(),
+
+		passwordLogin: true,
+	}
+}
+
+func newHTTPServer(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// newWorkers registers the background jobs of the site.
+func (s *server) newWorkers() *worker.Group {
+	group := worker.NewGroup()
+	group.Add("session-purge", 15*time.Minute, func(ctx context.Context) error {
+		return s.sessions.Purge(ctx)
+	})
+	group.Add("metrics-gauges", time.Minute, s.refreshGauges)
+	if s.trashRetention > 0 {
+		group.Add("trash-purge", time.Hour, s.purgeTrash)
+	}
+	for _, f := range s.feeds {
+		f := f
+		group.Add("feed-"+f.Name, f.Interval, func(ctx context.Context) error {
+			return s.runFeed(ctx, f)
+		})
+	}
+	return group
+}
+
+// shutdown marks the server as not ready, waits for delay so load balancers
+// notice, then drains in-flight requests, stops the bulk actions and the
+// workers, closes the database and exports the last spans. Everything has to
+// finish within cfg.ShutdownTimeout.
+func (s *server) shutdown(srv *http.Server, cfg config.Server, delay time.Duration) error {
+	atomic.StoreInt32(&draining, 1)
+
+	if delay > 0 {
+		logger.Default().Info("not ready, waiting before closing the listener", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var failed error
+	if err := srv.Shutdown(ctx); err != nil {
+		failed = fmt.Errorf("draining requests: %w", err)
+	}
+
+	if err := s.tasks.Stop(ctx); err != nil && failed == nil {
+		failed = fmt.Errorf("stopping bulk actions: %w", err)
+	}
+
+	if err := s.workers.Stop(ctx); err != nil && failed == nil {
+		failed = fmt.Errorf("stopping workers: %w", err)
+	}
+
+	if s.db != nil {
+		if err := s.db.Close(); err != nil && failed == nil {
+			failed = fmt.Errorf("closing database: %w", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil && failed == nil {
+		failed = fmt.Errorf("exporting spans: %w", err)
+	}
+
+	return failed
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+)
+
+// MemoryStore keeps sessions in process memory. Sessions are lost on restart
+// and are not shared between instances, so it is meant for development.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]models.AdminUserSession
+	remember map[string]models.AdminRememberToken
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]models.AdminUserSession),
+		remember: make(map[string]models.AdminRememberToken),
+	}
+}
+
+func (s *MemoryStore) Load(ctx context.Context, token string) (models.AdminUserSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return models.AdminUserSession{}, ErrNotFound
+	}
+
+	if session.ExpiryDate.Before(time.Now()) {
+		delete(s.sessions, token)
+		return models.AdminUserSession{}, ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, session models.AdminUserSession) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if existing.ExpiryDate.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+
+	s.sessions[session.SessionId] = session
+	return session.SessionId, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, token)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, adminId uint64) ([]models.AdminUserSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var sessions []models.AdminUserSession
+	for _, session := range s.sessions {
+		if session.AdminUser == adminId && session.ExpiryDate.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// Purge removes expired sessions and remember-me tokens.
+func (s *MemoryStore) Purge(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.ExpiryDate.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+	for selector, token := range s.remember {
+		if token.ExpiryDate.Before(now) {
+			delete(s.remember, selector)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, session := range s.sessions {
+		if session.ExpiryDate.After(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *MemoryStore) LoadRemember(ctx context.Context, selector string) (models.AdminRememberToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.remember[selector]
+	if !ok {
+		return token, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *MemoryStore) SaveRemember(ctx context.Context, token models.AdminRememberToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remember[token.Selector] = token
+	return nil
+}
+
+func (s *MemoryStore) DeleteRemember(ctx context.Context, selector string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.remember, selector)
+	return nil
+}
+
+func (s *MemoryStore) ListRemember(ctx context.Context, adminId uint64) ([]models.AdminRememberToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var tokens []models.AdminRememberToken
+	for _, token := range s.remember {
+		if token.AdminUser == adminId && token.ExpiryDate.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].DateCreated.After(tokens[j].DateCreated)
+	})
+
+	return tokens, nil
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookiePolicy holds the attributes applied to every cookie the Manager sets.
+type CookiePolicy struct {
+	Name         string
+	RememberName string
+	Path         string
+	Domain       string
+	Secure       bool
+	HttpOnly     bool
+	SameSite     http.SameSite
+}
+
+// DefaultCookiePolicy is safe for plain http development. Production should
+// turn on Secure, ideally together with the __Host- prefix.
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{
+		Name:         "session_id",
+		RememberName: "remember_token",
+		Path:         "/",
+		HttpOnly:     true,
+		SameSite:     http.SameSiteLaxMode,
+	}
+}
+
+// Validate checks the rules browsers enforce on prefixed cookie names, a cookie
+// breaking them is silently dropped by the browser.
+func (p CookiePolicy) Validate() error {
+	if p.Name == "" || p.RememberName == "" {
+		return errors.New("session: cookie names must not be empty")
+	}
+
+	for _, name := range []string{p.Name, p.RememberName} {
+		if strings.HasPrefix(name, "__Host-") {
+			if !p.Secure || p.Path != "/" || p.Domain != "" {
+				return errors.New("session: " + name + " requires Secure, Path=/ and no Domain")
+			}
+		}
+		if strings.HasPrefix(name, "__Secure-") && !p.Secure {
+			return errors.New("session: " + name + " requires Secure")
+		}
+	}
+
+	if p.SameSite == http.SameSiteNoneMode && !p.Secure {
+		return errors.New("session: SameSite=None requires Secure")
+	}
+
+	return nil
+}
+
+// NewCookie builds a cookie carrying the policy's attributes. It is exported
+// for short lived cookies other packages need, such as login flow state.
+func (p CookiePolicy) NewCookie(name, value string, expiryDate time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     p.Path,
+		Domain:   p.Domain,
+		Expires:  expiryDate,
+		Secure:   p.Secure,
+		HttpOnly: p.HttpOnly,
+		SameSite: p.SameSite,
+	}
+}
+
+// Expired builds a cookie that makes the browser drop the named cookie.
+func (p CookiePolicy) Expired(name string) *http.Cookie {
+	c := p.NewCookie(name, "", time.Unix(0, 0))
+	c.MaxAge = -1
+	return c
+}
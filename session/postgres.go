@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/models"
+)
+
+// PostgresStore keeps sessions in the admin_user_session table.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Load(ctx context.Context, token string) (models.AdminUserSession, error) {
+	session, err := database.SelectAdminSession(ctx, s.db, token)
+	if errors.Is(err, database.ErrNotFound) {
+		return session, ErrNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if session.ExpiryDate.Before(time.Now()) {
+		if err := database.DeleteAdminSession(ctx, s.db, token); err != nil {
+			return models.AdminUserSession{}, err
+		}
+		return models.AdminUserSession{}, ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, session models.AdminUserSession) (string, error) {
+	err := database.UpsertAdminSession(ctx, s.db, session)
+	return session.SessionId, err
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, token string) error {
+	return database.DeleteAdminSession(ctx, s.db, token)
+}
+
+func (s *PostgresStore) List(ctx context.Context, adminId uint64) ([]models.AdminUserSession, error) {
+	return database.SelectAdminSessionsByAdminId(ctx, s.db, adminId)
+}
+
+func (s *PostgresStore) LoadRemember(ctx context.Context, selector string) (models.AdminRememberToken, error) {
+	token, err := database.SelectAdminRememberToken(ctx, s.db, selector)
+	if errors.Is(err, database.ErrNotFound) {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *PostgresStore) SaveRemember(ctx context.Context, token models.AdminRememberToken) error {
+	return database.InsertAdminRememberToken(ctx, s.db, token)
+}
+
+func (s *PostgresStore) DeleteRemember(ctx context.Context, selector string) error {
+	return database.DeleteAdminRememberToken(ctx, s.db, selector)
+}
+
+func (s *PostgresStore) ListRemember(ctx context.Context, adminId uint64) ([]models.AdminRememberToken, error) {
+	return database.SelectAdminRememberTokensByAdminId(ctx, s.db, adminId)
+}
+
+// Purge removes expired sessions and remember-me tokens. Expired rows are
+// otherwise only removed when someone presents them.
+func (s *PostgresStore) Purge(ctx context.Context) error {
+	now := time.Now()
+	return database.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := database.DeleteExpiredAdminSessions(ctx, tx, now); err != nil {
+			return err
+		}
+
+		_, err := database.DeleteExpiredAdminRememberTokens(ctx, tx, now)
+		return err
+	})
+}
+
+func (s *PostgresStore) Count(ctx context.Context) (int, error) {
+	return database.CountActiveAdminSessions(ctx, s.db)
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+)
+
+// RememberStore persists remember-me tokens. Only a hash of the token's
+// validator is stored, the selector is used to look it up.
+type RememberStore interface {
+	LoadRemember(ctx context.Context, selector string) (models.AdminRememberToken, error)
+	SaveRemember(ctx context.Context, token models.AdminRememberToken) error
+	DeleteRemember(ctx context.Context, selector string) error
+	ListRemember(ctx context.Context, adminId uint64) ([]models.AdminRememberToken, error)
+}
+
+// Remember issues a remember-me token for the admin and sets its cookie.
+func (m *Manager) Remember(w http.ResponseWriter, r *http.Request, adminId uint64) error {
+	if m.RememberStore == nil {
+		return ErrNotSupported
+	}
+
+	return m.issueRemember(w, r, adminId, time.Now().Add(m.RememberLifetime))
+}
+
+// Resume starts a new session from the remember-me cookie when the session
+// cookie is missing or expired. The remember token is replaced on use but
+// keeps its original expiry date.
+func (m *Manager) Resume(w http.ResponseWriter, r *http.Request) (models.AdminUserSession, error) {
+	if m.RememberStore == nil {
+		return models.AdminUserSession{}, ErrNotFound
+	}
+
+	token, err := m.loadRemember(r)
+	if err != nil {
+		return models.AdminUserSession{}, err
+	}
+
+	if err := m.RememberStore.DeleteRemember(r.Context(), token.Selector); err != nil {
+		return models.AdminUserSession{}, err
+	}
+
+	if err := m.issueRemember(w, r, token.AdminUser, token.ExpiryDate); err != nil {
+		return models.AdminUserSession{}, err
+	}
+
+	return m.Start(w, r, token.AdminUser)
+}
+
+// ListRemember returns the live remember-me tokens of the admin.
+func (m *Manager) ListRemember(ctx context.Context, adminId uint64) ([]models.AdminRememberToken, error) {
+	if m.RememberStore == nil {
+		return nil, nil
+	}
+
+	return m.RememberStore.ListRemember(ctx, adminId)
+}
+
+// Forget revokes the admin's remember-me token with the given selector.
+func (m *Manager) Forget(ctx context.Context, adminId uint64, selector string) error {
+	if m.RememberStore == nil {
+		return ErrNotFound
+	}
+
+	token, err := m.RememberStore.LoadRemember(ctx, selector)
+	if err != nil {
+		return err
+	}
+	if token.AdminUser != adminId {
+		return ErrNotFound
+	}
+
+	return m.RememberStore.DeleteRemember(ctx, selector)
+}
+
+func (m *Manager) issueRemember(w http.ResponseWriter, r *http.Request, adminId uint64, expiryDate time.Time) error {
+	selector, err := randomHex(12)
+	if err != nil {
+		return err
+	}
+
+	validator, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	err = m.RememberStore.SaveRemember(r.Context(), models.AdminRememberToken{
+		Selector:    selector,
+		TokenHash:   hashValidator(validator),
+		AdminUser:   adminId,
+		ExpiryDate:  expiryDate,
+		UserAgent:   truncate(r.UserAgent(), 255),
+		DateCreated: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.Cookie.NewCookie(m.Cookie.RememberName, selector+":"+validator, expiryDate))
+	return nil
+}
+
+func (m *Manager) loadRemember(r *http.Request) (models.AdminRememberToken, error) {
+	var token models.AdminRememberToken
+
+	c, err := r.Cookie(m.Cookie.RememberName)
+	if err != nil {
+		return token, ErrNotFound
+	}
+
+	parts := strings.SplitN(c.Value, ":", 2)
+	if len(parts) != 2 {
+		return token, ErrNotFound
+	}
+
+	token, err = m.RememberStore.LoadRemember(r.Context(), parts[0])
+	if err != nil {
+		return token, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token.TokenHash), []byte(hashValidator(parts[1]))) != 1 {
+		return models.AdminRememberToken{}, ErrNotFound
+	}
+
+	if token.ExpiryDate.Before(time.Now()) {
+		m.RememberStore.DeleteRemember(r.Context(), token.Selector)
+		return models.AdminRememberToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
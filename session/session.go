@@ -0,0 +1,256 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/annbelievable/go_listing/models"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by a Store when the session does not exist or has expired.
+var ErrNotFound = errors.New("session: not found")
+
+// ErrNotSupported is returned by stores that cannot list or revoke sessions.
+var ErrNotSupported = errors.New("session: not supported by this store")
+
+// Store persists admin sessions. The token returned by Save is what ends up in
+// the cookie; for server side stores it is the session id, for the cookie store
+// it is the signed session itself.
+type Store interface {
+	Load(ctx context.Context, token string) (models.AdminUserSession, error)
+	Save(ctx context.Context, session models.AdminUserSession) (string, error)
+	Delete(ctx context.Context, token string) error
+	// List returns the live sessions of an admin, most recently seen first.
+	List(ctx context.Context, adminId uint64) ([]models.AdminUserSession, error)
+}
+
+// Purger is implemented by stores that keep expired sessions until they are
+// purged.
+type Purger interface {
+	Purge(ctx context.Context) error
+}
+
+// Counter is implemented by stores that can count the live sessions.
+type Counter interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// Manager ties a Store to the session cookie. All session cookies are created
+// here so they share one CookiePolicy.
+type Manager struct {
+	Store    Store
+	Cookie   CookiePolicy
+	Lifetime time.Duration
+	// RememberStore enables remember-me tokens when set.
+	RememberStore    RememberStore
+	RememberLifetime time.Duration
+	// ClientIP extracts the address recorded with new sessions.
+	ClientIP func(r *http.Request) string
+}
+
+func NewManager(store Store, lifetime time.Duration) *Manager {
+	return &Manager{
+		Store:            store,
+		Cookie:           DefaultCookiePolicy(),
+		Lifetime:         lifetime,
+		RememberLifetime: 30 * 24 * time.Hour,
+		ClientIP: func(r *http.Request) string {
+			return r.RemoteAddr
+		},
+	}
+}
+
+// Handle is the identifier shown for a session on the sessions page. It lets
+// an admin point at a session without exposing the id that authenticates it.
+func Handle(session models.AdminUserSession) string {
+	sum := sha256.Sum256([]byte(session.SessionId))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Start creates a new session for the admin and sets the cookie.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request, adminId uint64) (models.AdminUserSession, error) {
+	now := time.Now()
+	session := models.AdminUserSession{
+		SessionId:   uuid.NewString(),
+		AdminUser:   adminId,
+		ExpiryDate:  now.Add(m.Lifetime),
+		UserAgent:   truncate(r.UserAgent(), 255),
+		IpAddress:   truncate(m.ClientIP(r), 64),
+		DateCreated: now,
+		LastSeen:    now,
+	}
+
+	token, err := m.Store.Save(r.Context(), session)
+	if err != nil {
+		return session, err
+	}
+
+	m.setCookie(w, token, session.ExpiryDate)
+	return session, nil
+}
+
+// Load returns the session belonging to the request cookie.
+func (m *Manager) Load(r *http.Request) (models.AdminUserSession, error) {
+	c, err := r.Cookie(m.Cookie.Name)
+	if err != nil {
+		return models.AdminUserSession{}, ErrNotFound
+	}
+
+	return m.Store.Load(r.Context(), c.Value)
+}
+
+// Touch slides the expiry date and last seen time forward. To avoid a write on
+// every request the session is only saved once at least a minute has passed.
+func (m *Manager) Touch(w http.ResponseWriter, r *http.Request, session models.AdminUserSession) error {
+	if time.Since(session.LastSeen) < time.Minute {
+		return nil
+	}
+
+	session.LastSeen = time.Now()
+	session.ExpiryDate = session.LastSeen.Add(m.Lifetime)
+	token, err := m.Store.Save(r.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	m.setCookie(w, token, session.ExpiryDate)
+	return nil
+}
+
+// Rotate replaces the session id while keeping the owner. Call it whenever the
+// privileges attached to the session change, e.g. on login.
+func (m *Manager) Rotate(w http.ResponseWriter, r *http.Request, adminId uint64) (models.AdminUserSession, error) {
+	if c, err := r.Cookie(m.Cookie.Name); err == nil {
+		if err := m.Store.Delete(r.Context(), c.Value); err != nil {
+			return models.AdminUserSession{}, err
+		}
+	}
+
+	return m.Start(w, r, adminId)
+}
+
+// List returns the live sessions of the admin.
+func (m *Manager) List(ctx context.Context, adminId uint64) ([]models.AdminUserSession, error) {
+	return m.Store.List(ctx, adminId)
+}
+
+// Revoke ends the admin's session identified by handle.
+func (m *Manager) Revoke(ctx context.Context, adminId uint64, handle string) error {
+	sessions, err := m.Store.List(ctx, adminId)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if Handle(session) == handle {
+			return m.Store.Delete(ctx, session.SessionId)
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RevokeOthers ends every session and remember-me token of the admin except
+// the ones belonging to the request.
+func (m *Manager) RevokeOthers(r *http.Request, current models.AdminUserSession) error {
+	sessions, err := m.Store.List(r.Context(), current.AdminUser)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.SessionId == current.SessionId {
+			continue
+		}
+		if err := m.Store.Delete(r.Context(), session.SessionId); err != nil {
+			return err
+		}
+	}
+
+	if m.RememberStore == nil {
+		return nil
+	}
+
+	var keep string
+	if token, err := m.loadRemember(r); err == nil {
+		keep = token.Selector
+	}
+
+	tokens, err := m.RememberStore.ListRemember(r.Context(), current.AdminUser)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if token.Selector == keep {
+			continue
+		}
+		if err := m.RememberStore.DeleteRemember(r.Context(), token.Selector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Destroy removes the session and remember-me token of the request and clears
+// their cookies.
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	var err error
+	if c, cerr := r.Cookie(m.Cookie.Name); cerr == nil {
+		err = m.Store.Delete(r.Context(), c.Value)
+	}
+
+	if m.RememberStore != nil {
+		if token, rerr := m.loadRemember(r); rerr == nil {
+			if rerr = m.RememberStore.DeleteRemember(r.Context(), token.Selector); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+
+	http.SetCookie(w, m.Cookie.Expired(m.Cookie.Name))
+	http.SetCookie(w, m.Cookie.Expired(m.Cookie.RememberName))
+
+	return err
+}
+
+// Purge removes expired sessions from the stores that need it.
+func (m *Manager) Purge(ctx context.Context) error {
+	if p, ok := m.Store.(Purger); ok {
+		if err := p.Purge(ctx); err != nil {
+			return err
+		}
+	}
+
+	if p, ok := m.RememberStore.(Purger); ok && interface{}(m.RememberStore) != interface{}(m.Store) {
+		return p.Purge(ctx)
+	}
+
+	return nil
+}
+
+// Count returns the number of live sessions of all admins.
+func (m *Manager) Count(ctx context.Context) (int, error) {
+	if c, ok := m.Store.(Counter); ok {
+		return c.Count(ctx)
+	}
+
+	return 0, ErrNotSupported
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, token string, expiryDate time.Time) {
+	http.SetCookie(w, m.Cookie.NewCookie(m.Cookie.Name, token, expiryDate))
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
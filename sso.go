@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/handlers"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/oidc"
+	"github.com/annbelievable/go_listing/repository"
+)
+
+const ssoStateCookie = "oidc_state"
+
+// ssoSettings configures admin login through an OpenID provider. SSO is off
+// when Config.Issuer is empty.
+type ssoSettings struct {
+	Config oidc.Config
+	// RoleMap maps provider groups to local roles. When set, users without a
+	// mapped group are refused.
+	RoleMap map[string]string
+	// AutoCreate creates a local admin the first time an unknown email logs in.
+	AutoCreate bool
+}
+
+var errSSODenied = errors.New("sso: user is not allowed to log in")
+
+func newSSOSettings(cfg config.SSO) ssoSettings {
+	return ssoSettings{
+		Config: oidc.Config{
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{"email", "profile"},
+			GroupsClaim:  cfg.GroupsClaim,
+		},
+		RoleMap:    cfg.RoleMap,
+		AutoCreate: cfg.AutoCreate,
+	}
+}
+
+func (s *server) ssoEnabled() bool {
+	return s.sso.Config.Issuer != ""
+}
+
+// ssoProvider discovers the provider on first use, so an unreachable
+// provider does not keep the site from starting.
+func (s *server) ssoProvider(ctx context.Context) (*oidc.Provider, error) {
+	s.ssoMu.Lock()
+	defer s.ssoMu.Unlock()
+
+	if s.provider != nil {
+		return s.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, s.sso.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s.provider = provider
+	return s.provider, nil
+}
+
+func (s *server) AdminSSOLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.ssoEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	provider, err := s.ssoProvider(r.Context())
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	// The provider redirects back cross-site, a Strict cookie would not be sent.
+	c := s.sessions.Cookie.NewCookie(ssoStateCookie, state+"."+nonce+"."+verifier, time.Now().Add(10*time.Minute))
+	c.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, c)
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+}
+
+func (s *server) AdminSSOCallback(w http.ResponseWriter, r *http.Request) {
+	if !s.ssoEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	c, err := r.Cookie(ssoStateCookie)
+	http.SetCookie(w, s.sessions.Cookie.Expired(ssoStateCookie))
+	if err != nil {
+		s.ssoFailed(w, r, "Login session expired, please try again.")
+		return
+	}
+
+	parts := strings.Split(c.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(r.URL.Query().Get("state"))) != 1 {
+		s.ssoFailed(w, r, "Login failed.")
+		return
+	}
+
+	if r.URL.Query().Get("error") != "" {
+		s.ssoFailed(w, r, "Login was cancelled at the identity provider.")
+		return
+	}
+
+	provider, err := s.ssoProvider(r.Context())
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), parts[2])
+	if err != nil {
+		LogError(r, err)
+		s.ssoFailed(w, r, "Login failed.")
+		return
+	}
+
+	claims, err := provider.Verify(r.Context(), rawIDToken, parts[1])
+	if err != nil {
+		LogError(r, err)
+		s.ssoFailed(w, r, "Login failed.")
+		return
+	}
+
+	admin, err := s.ssoAdmin(r, claims)
+	if err == errSSODenied {
+		s.recordAudit(r, auditActor{Email: claims.Email}, "admin.login_failed", "admin_user", "", nil, map[string]interface{}{"sso": true, "groups": claims.Groups})
+		s.ssoFailed(w, r, "Your account is not allowed to access the admin.")
+		return
+	}
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	_, err = s.sessions.Rotate(w, r, admin.Id)
+	if err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	s.recordAudit(r, auditActor{Id: admin.Id, Email: claims.Email}, "admin.login", "admin_user", idString(admin.Id), nil, map[string]bool{"sso": true})
+	loginAttempts.Inc("sso", "success")
+
+	http.Redirect(w, r, "/admin-homepage", http.StatusFound)
+}
+
+// ssoAdmin maps the verified claims to a local admin, creating it when
+// AutoCreate is on and keeping its role in sync with the provider's groups.
+func (s *server) ssoAdmin(r *http.Request, claims oidc.Claims) (models.AdminUser, error) {
+	// admins are found by email, an unverified one could be anybody's
+	if claims.Email == "" || !claims.EmailVerified {
+		return models.AdminUser{}, errSSODenied
+	}
+
+	role, ok := s.sso.mapRole(claims.Groups)
+	if !ok {
+		return models.AdminUser{}, errSSODenied
+	}
+
+	admin, err := s.admins.GetByEmail(r.Context(), claims.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		if !s.sso.AutoCreate {
+			return admin, errSSODenied
+		}
+
+		admin, err = s.createSSOAdmin(r.Context(), claims.Email, role)
+		if err == nil {
+			s.recordAudit(r, auditActor{Id: admin.Id, Email: claims.Email}, "admin.register", "admin_user", idString(admin.Id), nil, map[string]interface{}{"email": claims.Email, "sso": true})
+		}
+	}
+	if err != nil {
+		return admin, err
+	}
+
+	if role != "" && role != admin.Role {
+		err = s.admins.UpdateRole(r.Context(), admin.Id, role)
+		if err != nil {
+			return admin, err
+		}
+		s.recordAudit(r, auditActor{Id: admin.Id, Email: claims.Email}, "admin.role_change", "admin_user", idString(admin.Id), map[string]string{"role": admin.Role}, map[string]string{"role": role})
+		admin.Role = role
+	}
+
+	return admin, nil
+}
+
+// createSSOAdmin creates an admin with a random password nobody knows, so the
+// account can only log in through the provider until a password is set. An
+// empty role creates an admin.
+func (s *server) createSSOAdmin(ctx context.Context, email, role string) (models.AdminUser, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+
+	hashedPwd, err := handlers.HashAndSalt(password)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+
+	id, err := s.admins.Create(ctx, models.AdminUser{Email: email, Password: hashedPwd, Role: role})
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+
+	return s.admins.Get(ctx, id)
+}
+
+// mapRole returns the most privileged role granted by the groups. Without a
+// role map every user is accepted and keeps their current role.
+func (sso ssoSettings) mapRole(groups []string) (string, bool) {
+	if len(sso.RoleMap) == 0 {
+		return "", true
+	}
+
+	role := ""
+	for _, group := range groups {
+		mapped, ok := sso.RoleMap[group]
+		if !ok {
+			continue
+		}
+		if mapped == models.RoleAdmin || role == "" {
+			role = mapped
+		}
+	}
+
+	return role, role != ""
+}
+
+func (s *server) ssoFailed(w http.ResponseWriter, r *http.Request, message string) {
+	loginAttempts.Inc("sso", "failure")
+	ctx := context.WithValue(r.Context(), "Message", message)
+	s.AdminLogin(w, r.WithContext(ctx))
+}
@@ -0,0 +1,259 @@
+// Package tabular reads and writes rows of named text fields as CSV or JSON
+// Lines, the formats pages and listings are exported and imported in.
+package tabular
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats a table can be read and written in.
+const (
+	CSV       = "csv"
+	JSONLines = "jsonl"
+)
+
+var (
+	ErrFormat      = errors.New("tabular: unknown format")
+	ErrTooManyRows = errors.New("tabular: too many rows")
+)
+
+// Row is one record of a table. Line is where it starts in the input, for
+// error messages.
+type Row struct {
+	Line   int
+	Values map[string]string
+}
+
+// Table is what Read found: the column names in the order they first
+// appeared and the rows.
+type Table struct {
+	Columns []string
+	Rows    []Row
+}
+
+// ContentType is the media type of a format, for downloads.
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Read reads a CSV file with a header row, or JSON Lines of flat objects. It
+// stops with ErrTooManyRows after maxRows rows, 0 reads them all.
+func Read(r io.Reader, format string, maxRows int) (Table, error) {
+	switch format {
+	case CSV:
+		return readCSV(r, maxRows)
+	case JSONLines:
+		return readJSONLines(r, maxRows)
+	}
+	return Table{}, ErrFormat
+}
+
+func readCSV(r io.Reader, maxRows int) (Table, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return Table{}, errors.New("the file is empty")
+	}
+	if err != nil {
+		return Table{}, err
+	}
+
+	var table Table
+	seen := make(map[string]bool)
+	for i, name := range header {
+		if i == 0 {
+			// spreadsheets like to start their CSV with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column %d", i+1)
+		}
+		if seen[name] {
+			return Table{}, fmt.Errorf("column %q appears twice in the header", name)
+		}
+		seen[name] = true
+		table.Columns = append(table.Columns, name)
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Table{}, err
+		}
+		if maxRows > 0 && len(table.Rows) == maxRows {
+			return Table{}, ErrTooManyRows
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := Row{Line: line, Values: make(map[string]string, len(record))}
+		for i, value := range record {
+			if i < len(table.Columns) {
+				row.Values[table.Columns[i]] = value
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+func readJSONLines(r io.Reader, maxRows int) (Table, error) {
+	var table Table
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if line == 1 {
+			text = bytes.TrimPrefix(text, []byte("\ufeff"))
+		}
+		if len(text) == 0 {
+			continue
+		}
+		if maxRows > 0 && len(table.Rows) == maxRows {
+			return Table{}, ErrTooManyRows
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(text, &object); err != nil {
+			return Table{}, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		row := Row{Line: line, Values: make(map[string]string, len(object))}
+		// json does not keep the order of the keys, so new columns are added
+		// in the order they appear in the line
+		for _, name := range objectKeys(text) {
+			if !seen[name] {
+				seen[name] = true
+				table.Columns = append(table.Columns, name)
+			}
+			row.Values[name] = jsonText(object[name])
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Table{}, err
+	}
+	if len(table.Rows) == 0 {
+		return Table{}, errors.New("the file is empty")
+	}
+	return table, nil
+}
+
+// objectKeys returns the keys of a JSON object in the order they are written.
+func objectKeys(object []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+
+	var keys []string
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		key, _ := token.(string)
+		keys = append(keys, key)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// jsonText turns a JSON value into the text of a field: strings without their
+// quotes, null as empty, anything else as written.
+func jsonText(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	if string(value) == "null" {
+		return ""
+	}
+	return string(value)
+}
+
+// Writer writes rows with a fixed set of columns. Call Flush when done.
+type Writer struct {
+	format  string
+	columns []string
+	csv     *csv.Writer
+	w       *bufio.Writer
+}
+
+// NewWriter starts a table in w, CSV files get their header row right away.
+func NewWriter(w io.Writer, format string, columns []string) (*Writer, error) {
+	tw := &Writer{format: format, columns: columns}
+	switch format {
+	case CSV:
+		tw.csv = csv.NewWriter(w)
+		if err := tw.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	case JSONLines:
+		tw.w = bufio.NewWriter(w)
+	default:
+		return nil, ErrFormat
+	}
+	return tw, nil
+}
+
+// Write writes a row, values are in the order of the columns.
+func (tw *Writer) Write(values []string) error {
+	if len(values) != len(tw.columns) {
+		return fmt.Errorf("tabular: %d values for %d columns", len(values), len(tw.columns))
+	}
+
+	if tw.csv != nil {
+		return tw.csv.Write(values)
+	}
+
+	// written by hand to keep the keys in column order
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, column := range tw.columns {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, _ := json.Marshal(values[i])
+		line.Write(key)
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+	_, err := tw.w.Write(line.Bytes())
+	return err
+}
+
+func (tw *Writer) Flush() error {
+	if tw.csv != nil {
+		tw.csv.Flush()
+		return tw.csv.Error()
+	}
+	return tw.w.Flush()
+}
@@ -0,0 +1,108 @@
+package tabular
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	in := "\ufeffurl,Title,\n/a,\"A, with comma\",x\n/b,\"multi\nline\"\n"
+	table, err := Read(strings.NewReader(in), CSV, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"url", "Title", "column 3"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Fatalf("columns %q, want %q", table.Columns, want)
+	}
+	want := []Row{
+		{Line: 2, Values: map[string]string{"url": "/a", "Title": "A, with comma", "column 3": "x"}},
+		{Line: 3, Values: map[string]string{"url": "/b", "Title": "multi\nline"}},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Fatalf("rows %+v, want %+v", table.Rows, want)
+	}
+}
+
+func TestReadJSONLines(t *testing.T) {
+	in := `{"url":"/a","title":"A","price":12.5}` + "\n\n" + `{"title":"B","url":"/b","tags":["x"],"sold":true,"note":null}` + "\n"
+	table, err := Read(strings.NewReader(in), JSONLines, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"url", "title", "price", "tags", "sold", "note"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Fatalf("columns %q, want %q", table.Columns, want)
+	}
+	want := []Row{
+		{Line: 1, Values: map[string]string{"url": "/a", "title": "A", "price": "12.5"}},
+		{Line: 3, Values: map[string]string{"url": "/b", "title": "B", "tags": `["x"]`, "sold": "true", "note": ""}},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Fatalf("rows %+v, want %+v", table.Rows, want)
+	}
+
+	if _, err := Read(strings.NewReader("{\"url\":\n"), JSONLines, 0); err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Fatalf("broken line read with %v", err)
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	for _, format := range []string{CSV, JSONLines} {
+		if _, err := Read(strings.NewReader(""), format, 0); err == nil {
+			t.Fatalf("%s: an empty file was read", format)
+		}
+	}
+
+	in := "url\n/a\n/b\n/c\n"
+	if _, err := Read(strings.NewReader(in), CSV, 2); !errors.Is(err, ErrTooManyRows) {
+		t.Fatalf("read 3 rows with a limit of 2: %v", err)
+	}
+	if _, err := Read(strings.NewReader(in), CSV, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(strings.NewReader(in), "xlsx", 0); !errors.Is(err, ErrFormat) {
+		t.Fatalf("read an unknown format: %v", err)
+	}
+}
+
+func TestWriteAndReadBack(t *testing.T) {
+	columns := []string{"url", "title"}
+	rows := [][]string{{"/a", "A \"quoted\", title"}, {"/b", "Ünïcode\nsecond line"}}
+
+	for _, format := range []string{CSV, JSONLines} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if format == JSONLines && !strings.HasPrefix(buf.String(), `{"url":"/a","title":`) {
+			t.Fatalf("keys are not in column order:\n%s", buf.String())
+		}
+
+		table, err := Read(&buf, format, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(table.Columns, columns) || len(table.Rows) != len(rows) {
+			t.Fatalf("%s: read back %+v", format, table)
+		}
+		for i, row := range rows {
+			if table.Rows[i].Values["url"] != row[0] || table.Rows[i].Values["title"] != row[1] {
+				t.Fatalf("%s: row %d read back as %v", format, i, table.Rows[i].Values)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/annbelievable/go_listing/config"
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// setupTracing installs the tracer for the configured exporter. With the none
+// exporter spans are not recorded, but incoming trace context still flows
+// through to the logs.
+func setupTracing(cfg config.Tracing) error {
+	var exporter tracing.Exporter
+	switch cfg.Exporter {
+	case "none":
+		tracing.SetDefault(nil)
+		return nil
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		fileExporter, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return err
+		}
+		exporter = fileExporter
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(cfg.Endpoint, cfg.Headers)
+	default:
+		return fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	tracing.SetDefault(tracing.NewTracer(cfg.ServiceName, cfg.SampleRatio, exporter))
+	return nil
+}
+
+// shutdownTracing exports the spans still queued.
+func shutdownTracing(ctx context.Context) error {
+	tracer := tracing.Default()
+	if tracer == nil {
+		return nil
+	}
+	return tracer.Shutdown(ctx)
+}
+
+// tracingHandler starts the server span of a request, continuing the trace of
+// the caller when it sent a traceparent header. The trace id is added to the
+// request's log lines.
+func tracingHandler(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if remote, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithSpanContext(ctx, remote)
+		}
+
+		route := routeTemplate(router, r)
+		ctx, span := tracing.Start(ctx, r.Method+" "+route, tracing.KindServer)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With("trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String()))
+		}
+
+		span.SetAttributes(
+			"http.method", r.Method,
+			"http.route", route,
+			"http.target", r.URL.RequestURI(),
+			"http.user_agent", r.UserAgent(),
+			"http.client_ip", GetIP(r),
+			"http.request_id", requestId(r),
+		)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes("http.status_code", rec.status, "http.response_size", rec.size)
+		if rec.status >= 500 {
+			span.SetError(http.StatusText(rec.status))
+		}
+	})
+}
+
+// routeTemplate returns the path template of the route r matches, so
+// /update-page/7 and /update-page/8 are reported together.
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if router.Match(r, &match) && match.Route != nil {
+		if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
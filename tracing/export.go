@@ -0,0 +1,284 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Service    string
+	Name       string
+	Kind       Kind
+	TraceID    TraceID
+	SpanID     SpanID
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []interface{}
+	Status     int
+	Message    string
+}
+
+func (s *Span) data() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SpanData{
+		Service:    s.tracer.service,
+		Name:       s.name,
+		Kind:       s.kind,
+		TraceID:    s.sc.TraceID,
+		SpanID:     s.sc.SpanID,
+		Parent:     s.parent,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: append([]interface{}(nil), s.attributes...),
+		Status:     s.status,
+		Message:    s.message,
+	}
+}
+
+// The types below are the OTLP/JSON encoding of ExportTraceServiceRequest.
+// Ids are hex strings and 64 bit integers are decimal strings, as the OTLP
+// JSON mapping requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// encodeOTLP groups spans by service into one export request.
+func encodeOTLP(spans []SpanData) otlpRequest {
+	var req otlpRequest
+	index := make(map[string]int)
+
+	for _, s := range spans {
+		i, ok := index[s.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			index[s.Service] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: attributes([]interface{}{"service.name", s.Service})},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "go_listing/tracing"}}},
+			})
+		}
+
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+			Status:            otlpStatus{Code: s.Status, Message: s.Message},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	return req
+}
+
+func attributes(kv []interface{}) []otlpKeyValue {
+	var attrs []otlpKeyValue
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, otlpKeyValue{Key: fmt.Sprint(kv[i]), Value: attributeValue(kv[i+1])})
+	}
+	return attrs
+}
+
+func attributeValue(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case error:
+		s := v.Error()
+		return otlpValue{StringValue: &s}
+	case fmt.Stringer:
+		s := v.String()
+		return otlpValue{StringValue: &s}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s := strconv.FormatInt(rv.Int(), 10)
+		return otlpValue{IntValue: &s}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			s := strconv.FormatUint(rv.Uint(), 10)
+			return otlpValue{IntValue: &s}
+		}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		return otlpValue{DoubleValue: &f}
+	}
+
+	s := fmt.Sprint(v)
+	return otlpValue{StringValue: &s}
+}
+
+// WriterExporter writes every batch as one line of OTLP JSON, the format an
+// OpenTelemetry collector's file receiver reads.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// NewWriterExporter writes to w, which is not closed on shutdown.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter appends to the file at path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, c: f}, nil
+}
+
+func (e *WriterExporter) Export(ctx context.Context, spans []SpanData) error {
+	b, err := json.Marshal(encodeOTLP(spans))
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+// OTLPExporter posts spans to a collector with OTLP over HTTP using the JSON
+// encoding.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter sends to endpoint. An endpoint without a path gets the
+// standard /v1/traces path.
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	url := strings.TrimRight(endpoint, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/v1/traces"
+	}
+
+	return &OTLPExporter{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: exportTimeout},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	b, err := json.Marshal(encodeOTLP(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("tracing: collector returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
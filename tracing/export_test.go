@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestEncodeOTLP checks the export against the OTLP/JSON mapping of
+// ExportTraceServiceRequest: ids are lowercase hex, kind and status code
+// are enum numbers, 64 bit integers are decimal strings and zero values
+// are left out.
+func TestEncodeOTLP(t *testing.T) {
+	start := time.Unix(1700000000, 5)
+	spans := []SpanData{
+		{
+			Service:    "site",
+			Name:       "GET /pages",
+			Kind:       KindServer,
+			TraceID:    TraceID{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+			SpanID:     SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+			Start:      start,
+			End:        start.Add(time.Millisecond),
+			Attributes: []interface{}{"http.status_code", 200, "http.route", "/pages", "cache.hit", false, "sample", 0.5, "error", errors.New("boom")},
+		},
+		{
+			Service: "site",
+			Name:    "SELECT page",
+			Kind:    KindClient,
+			TraceID: TraceID{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+			SpanID:  SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x75},
+			Parent:  SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+			Start:   start,
+			End:     start.Add(time.Microsecond),
+			Status:  statusError,
+			Message: "timeout",
+		},
+		{
+			Service: "worker",
+			Name:    "purge",
+			Kind:    KindInternal,
+			TraceID: TraceID{15: 1},
+			SpanID:  SpanID{7: 1},
+			Start:   start,
+			End:     start,
+		},
+	}
+
+	want := `{"resourceSpans": [
+		{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "site"}}]},
+			"scopeSpans": [{
+				"scope": {"name": "go_listing/tracing"},
+				"spans": [
+					{
+						"traceId": "5b8efff798038103d269b633813fc60c",
+						"spanId": "eee19b7ec3c1b174",
+						"name": "GET /pages",
+						"kind": 2,
+						"startTimeUnixNano": "1700000000000000005",
+						"endTimeUnixNano": "1700000000001000005",
+						"attributes": [
+							{"key": "http.status_code", "value": {"intValue": "200"}},
+							{"key": "http.route", "value": {"stringValue": "/pages"}},
+							{"key": "cache.hit", "value": {"boolValue": false}},
+							{"key": "sample", "value": {"doubleValue": 0.5}},
+							{"key": "error", "value": {"stringValue": "boom"}}
+						],
+						"status": {}
+					},
+					{
+						"traceId": "5b8efff798038103d269b633813fc60c",
+						"spanId": "eee19b7ec3c1b175",
+						"parentSpanId": "eee19b7ec3c1b174",
+						"name": "SELECT page",
+						"kind": 3,
+						"startTimeUnixNano": "1700000000000000005",
+						"endTimeUnixNano": "1700000000000001005",
+						"status": {"code": 2, "message": "timeout"}
+					}
+				]
+			}]
+		},
+		{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "worker"}}]},
+			"scopeSpans": [{
+				"scope": {"name": "go_listing/tracing"},
+				"spans": [{
+					"traceId": "00000000000000000000000000000001",
+					"spanId": "0000000000000001",
+					"name": "purge",
+					"kind": 1,
+					"startTimeUnixNano": "1700000000000000005",
+					"endTimeUnixNano": "1700000000000000005",
+					"status": {}
+				}]
+			}]
+		}
+	]}`
+
+	var buf bytes.Buffer
+	if err := NewWriterExporter(&buf).Export(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Fatalf("the batch is not one line:\n%s", buf.String())
+	}
+
+	var got, wanted interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wanted); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("exported\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/annbelievable/go_listing/logger"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Exporter sends finished spans somewhere.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer creates spans and exports them in batches from a background
+// goroutine. Spans are dropped when the exporter cannot keep up.
+type Tracer struct {
+	service  string
+	ratio    float64
+	exporter Exporter
+
+	queue chan SpanData
+	flush chan chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	dropped int
+	closed  bool
+}
+
+// NewTracer starts a tracer that records the given share of new traces,
+// between 0 and 1. Traces started elsewhere follow the caller's decision.
+func NewTracer(service string, ratio float64, exporter Exporter) *Tracer {
+	t := &Tracer{
+		service:  service,
+		ratio:    ratio,
+		exporter: exporter,
+		queue:    make(chan SpanData, queueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// sample decides from the trace id so every service reaches the same result.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	if t.ratio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>1) < t.ratio*float64(uint64(1)<<63)
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	data := s.data()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			logger.Default().Warn("could not export spans", "error", err, "spans", len(batch))
+		}
+		cancel()
+		batch = nil
+
+		t.mu.Lock()
+		dropped := t.dropped
+		t.dropped = 0
+		t.mu.Unlock()
+		if dropped > 0 {
+			logger.Default().Warn("dropped spans, the exporter is too slow", "spans", dropped)
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				export()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case reply := <-t.flush:
+			// take what is queued right now, then export
+			for n := len(t.queue); n > 0; n-- {
+				batch = append(batch, <-t.queue)
+			}
+			export()
+			close(reply)
+		}
+	}
+}
+
+// ForceFlush exports the queued spans and waits until they are sent.
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case t.flush <- reply:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the remaining spans and closes the exporter. Spans ended
+// afterwards are discarded.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return t.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,260 @@
+// Package tracing records spans and exports them in the OTLP JSON format. It
+// implements the small part of OpenTelemetry the site needs: spans with
+// attributes, W3C trace context propagation and batched export.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// Remote is set for span contexts read from request headers.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind values match the OTLP SpanKind enum.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Status codes match the OTLP StatusCode enum.
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+// Span is one timed operation. All methods are safe on spans that are not
+// recorded, so callers never have to check.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   Kind
+	start  time.Time
+
+	mu         sync.Mutex
+	name       string
+	end        time.Time
+	attributes []interface{}
+	status     int
+	message    string
+	ended      bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// IsRecording reports whether the span will be exported.
+func (s *Span) IsRecording() bool {
+	return s.tracer != nil && s.sc.Sampled
+}
+
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttributes adds key value pairs to the span. Values may be strings,
+// bools, integers or floats; anything else is recorded with fmt.Sprint.
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, kv...)
+}
+
+// RecordError marks the span as failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if err == nil || !s.IsRecording() {
+		return
+	}
+	s.SetError(err.Error())
+}
+
+// SetError marks the span as failed with message.
+func (s *Span) SetError(message string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = statusError
+	s.message = message
+}
+
+// End finishes the span and hands it to the exporter. Later calls do nothing.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.enqueue(s)
+}
+
+type spanKey struct{}
+
+// ContextWithSpanContext returns ctx with a span context, usually a remote
+// one read by Extract, that new spans use as their parent.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, &Span{sc: sc})
+}
+
+// SpanFromContext returns the current span of ctx, or a span that is not
+// recorded.
+func SpanFromContext(ctx context.Context) *Span {
+	if s, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return s
+	}
+	return &Span{}
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultTracer *Tracer
+)
+
+// SetDefault installs the tracer used by Start. A nil tracer turns tracing off.
+func SetDefault(t *Tracer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultTracer = t
+}
+
+func Default() *Tracer {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultTracer
+}
+
+// Start begins a span with the default tracer as a child of the span in ctx.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	return Default().Start(ctx, name, kind)
+}
+
+// Start begins a span as a child of the span in ctx. A nil tracer returns a
+// span that is not recorded but still carries the parent's trace context.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx).sc
+
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if t == nil {
+		span.sc = parent
+		span.sc.Remote = false
+		return context.WithValue(ctx, spanKey{}, span), span
+	}
+
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = t.sample(span.sc.TraceID)
+	}
+	span.sc.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// Extract reads the W3C traceparent header. It reports false when the header
+// is missing or malformed.
+func Extract(h http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(h.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// version 00 has exactly four fields, later versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject writes the traceparent header for the span in ctx.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanFromContext(ctx).sc
+	if !sc.IsValid() {
+		return
+	}
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags))
+}
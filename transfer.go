@@ -0,0 +1,813 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/annbelievable/go_listing/database"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/tabular"
+	"github.com/annbelievable/go_listing/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// transferKind describes how one kind of row is exported and imported.
+type transferKind struct {
+	// Name is the kind in urls, Entity in the audit log.
+	Name   string
+	Entity string
+	// Columns are the columns of an export.
+	Columns []string
+	// Fields can be mapped from the columns of an import, Keys are the
+	// fields an import can match existing rows by.
+	Fields []string
+	Keys   []string
+	// List is where the rows are managed.
+	List string
+}
+
+var (
+	pageTransfer = &transferKind{
+		Name:    "pages",
+		Entity:  "page",
+		Columns: []string{"id", "url", "title", "teaser", "content", "status", "updated"},
+		Fields:  []string{"url", "title", "teaser", "content", "status"},
+		Keys:    []string{"url"},
+		List:    "/pages",
+	}
+	listingTransfer = &transferKind{
+		Name:    "listings",
+		Entity:  "listing",
+		Columns: []string{"id", "external_id", "url", "title", "description", "category", "status", "updated"},
+		Fields:  []string{"external_id", "url", "title", "description", "category", "status"},
+		Keys:    []string{"url", "external_id"},
+		List:    "/listings",
+	}
+	transferKinds = map[string]*transferKind{
+		pageTransfer.Name:    pageTransfer,
+		listingTransfer.Name: listingTransfer,
+	}
+)
+
+func pageRow(page models.Page) []string {
+	return []string{idString(page.Id), page.Url, page.Title, page.Teaser, page.Content, page.Status, page.DateUpdated.UTC().Format(time.RFC3339)}
+}
+
+func listingRow(listing models.Listing) []string {
+	return []string{idString(listing.Id), listing.ExternalId, listing.Url, listing.Title, listing.Description, listing.Category, listing.Status, listing.DateUpdated.UTC().Format(time.RFC3339)}
+}
+
+// writeTable sends the rows as a download named after the kind.
+func writeTable(w http.ResponseWriter, r *http.Request, kind *transferKind, format string, rows [][]string) {
+	w.Header().Set("Content-Type", tabular.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+kind.Name+"."+format+`"`)
+
+	tw, err := tabular.NewWriter(w, format, kind.Columns)
+	if err != nil {
+		LogError(r, err)
+		return
+	}
+	for _, row := range rows {
+		if err := tw.Write(row); err != nil {
+			LogError(r, err)
+			return
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		LogError(r, err)
+	}
+}
+
+type exportLink struct {
+	Label string
+	Href  string
+}
+
+// exportLinks link to the exports of a list filtered by filter.
+func exportLinks(kind *transferKind, filter url.Values) []exportLink {
+	var links []exportLink
+	for _, format := range []struct{ format, label string }{{tabular.CSV, "CSV"}, {tabular.JSONLines, "JSON Lines"}} {
+		values := url.Values{"format": {format.format}}
+		for key, value := range filter {
+			values[key] = value
+		}
+		links = append(links, exportLink{Label: "Export as " + format.label, Href: "/export/" + kind.Name + "?" + values.Encode()})
+	}
+	return links
+}
+
+// Export downloads the pages or listings that match the filters of their
+// list, all of them without filters.
+func (s *server) Export(w http.ResponseWriter, r *http.Request) {
+	kind := transferKinds[mux.Vars(r)["kind"]]
+	format := r.URL.Query().Get("format")
+	if kind == nil || (format != tabular.CSV && format != tabular.JSONLines) {
+		BadRequest(w, r)
+		return
+	}
+
+	var rows [][]string
+	var err error
+	if kind == pageTransfer {
+		rows, err = s.exportPageRows(r.Context(), pageListQuery(r))
+	} else {
+		rows, err = s.exportListingRows(r.Context(), listingFilterFrom(r))
+	}
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	summary := bulkSummary{
+		Options:   map[string]string{"format": format, "filter": r.URL.RawQuery},
+		Succeeded: len(rows),
+	}
+	s.recordAudit(r, s.currentActor(r), kind.Entity+".export", kind.Entity, "", nil, summary)
+
+	writeTable(w, r, kind, format, rows)
+}
+
+// exportPageRows pages through the whole list q filters, a window at a time.
+func (s *server) exportPageRows(ctx context.Context, q repository.PageQuery) ([][]string, error) {
+	q.After, q.Before = nil, nil
+	q.Limit = database.MaxPageLimit
+
+	var rows [][]string
+	for {
+		list, err := s.pages.Find(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, found := range list.Pages {
+			// the list leaves out the content
+			page, err := s.pages.Get(ctx, found.Id)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, pageRow(page))
+		}
+		if list.Next == nil {
+			return rows, nil
+		}
+		q.After = list.Next
+	}
+}
+
+func (s *server) exportListingRows(ctx context.Context, filter listingFilter) ([][]string, error) {
+	listings, err := s.findListings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(listings))
+	for _, listing := range listings {
+		rows = append(rows, listingRow(listing))
+	}
+	return rows, nil
+}
+
+// listingFilter narrows the listing list, zero values match everything.
+type listingFilter struct {
+	Search   string
+	Status   string
+	Category string
+}
+
+func listingFilterFrom(r *http.Request) listingFilter {
+	values := r.URL.Query()
+	filter := listingFilter{
+		Search:   strings.TrimSpace(values.Get("q")),
+		Status:   values.Get("status"),
+		Category: strings.TrimSpace(values.Get("category")),
+	}
+	if filter.Status != models.ListingActive && filter.Status != models.ListingExpired {
+		filter.Status = ""
+	}
+	return filter
+}
+
+func (f listingFilter) values() url.Values {
+	values := url.Values{}
+	if f.Search != "" {
+		values.Set("q", f.Search)
+	}
+	if f.Status != "" {
+		values.Set("status", f.Status)
+	}
+	if f.Category != "" {
+		values.Set("category", f.Category)
+	}
+	return values
+}
+
+func (f listingFilter) match(listing models.Listing) bool {
+	if f.Status != "" && listing.Status != f.Status {
+		return false
+	}
+	if f.Category != "" && !strings.EqualFold(listing.Category, f.Category) {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		return strings.Contains(strings.ToLower(listing.Title), search) || strings.Contains(strings.ToLower(listing.Url), search)
+	}
+	return true
+}
+
+func (s *server) findListings(ctx context.Context, filter listingFilter) ([]models.Listing, error) {
+	listings, err := s.listings.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []models.Listing
+	for _, listing := range listings {
+		if filter.match(listing) {
+			found = append(found, listing)
+		}
+	}
+	return found, nil
+}
+
+// maxImportSize and maxImportRows bound an uploaded file, a spreadsheet of a
+// few thousand rows is well within both.
+const (
+	maxImportSize = 32 << 20
+	maxImportRows = 20000
+)
+
+// importPreviewRows is how many valid rows the preview shows, every invalid
+// row is shown.
+const importPreviewRows = 20
+
+// importUpload is a file read for an import, kept while its columns are
+// mapped and the import is previewed and run.
+type importUpload struct {
+	Id       string
+	Kind     *transferKind
+	FileName string
+	Table    tabular.Table
+	Created  time.Time
+}
+
+// importUploads keeps the uploaded files in memory for an hour.
+type importUploads struct {
+	mu      sync.Mutex
+	uploads map[string]*importUpload
+}
+
+func newImportUploads() *importUploads {
+	return &importUploads{uploads: make(map[string]*importUpload)}
+}
+
+func (u *importUploads) add(upload *importUpload) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	upload.Id = hex.EncodeToString(b)
+	upload.Created = time.Now()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, old := range u.uploads {
+		if time.Since(old.Created) > time.Hour {
+			delete(u.uploads, id)
+		}
+	}
+	u.uploads[upload.Id] = upload
+	return nil
+}
+
+func (u *importUploads) get(id string) (*importUpload, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	upload, ok := u.uploads[id]
+	if !ok || time.Since(upload.Created) > time.Hour {
+		return nil, false
+	}
+	return upload, true
+}
+
+type importForm struct {
+	Kinds  []string
+	Kind   string
+	Format string
+}
+
+// Import asks for the file to import.
+func (s *server) Import(w http.ResponseWriter, r *http.Request) {
+	renderImport(w, r, importForm{Kind: r.URL.Query().Get("kind")}, nil)
+}
+
+func renderImport(w http.ResponseWriter, r *http.Request, form importForm, errs validate.Errors) {
+	form.Kinds = []string{pageTransfer.Name, listingTransfer.Name}
+	data := TemplateData{
+		Page:   models.Page{Title: "Import"},
+		Errors: errs,
+		Misc:   form,
+	}
+	renderPage(w, r, "import.html", data)
+}
+
+// importFormat is the format the admin chose, or the one the file name
+// suggests.
+func importFormat(chosen, fileName string) string {
+	if chosen != "" {
+		return chosen
+	}
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".csv":
+		return tabular.CSV
+	case ".jsonl", ".ndjson", ".json":
+		return tabular.JSONLines
+	}
+	return ""
+}
+
+// ImportUpload reads the uploaded file and goes on to map its columns.
+func (s *server) ImportUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		renderImport(w, r, importForm{}, validate.Errors{"File": fmt.Sprintf("Choose a file of at most %d MB.", maxImportSize>>20)})
+		return
+	}
+
+	form := importForm{Kind: r.FormValue("kind"), Format: r.FormValue("format")}
+	errs := validate.Errors{}
+	kind := transferKinds[form.Kind]
+	if kind == nil {
+		errs["Kind"] = "Choose what to import."
+	}
+
+	var table tabular.Table
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		errs["File"] = "Choose a file."
+	} else {
+		defer file.Close()
+
+		format := importFormat(form.Format, header.Filename)
+		switch {
+		case format != tabular.CSV && format != tabular.JSONLines:
+			errs["Format"] = "Choose the format of the file."
+		default:
+			table, err = tabular.Read(file, format, maxImportRows)
+			if errors.Is(err, tabular.ErrTooManyRows) {
+				errs["File"] = fmt.Sprintf("The file has more than %d rows, split it into smaller files.", maxImportRows)
+			} else if err != nil {
+				errs["File"] = "The file could not be read: " + err.Error()
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		renderImport(w, r, form, errs)
+		return
+	}
+
+	upload := &importUpload{Kind: kind, FileName: header.Filename, Table: table}
+	if err := s.imports.add(upload); err != nil {
+		LogError(r, err)
+		InternalServerError(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/import/"+upload.Id, http.StatusFound)
+}
+
+// importMapping says which column of the file fills each field, and which
+// field matches the rows to the existing ones.
+type importMapping struct {
+	Key     string
+	Columns map[string]string
+}
+
+// normalizeColumn lets "External ID" and "external_id" name the same field.
+func normalizeColumn(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// guessMapping maps every field to the column of the same name.
+func guessMapping(kind *transferKind, columns []string) importMapping {
+	m := importMapping{Key: kind.Keys[0], Columns: make(map[string]string)}
+	for _, field := range kind.Fields {
+		for _, column := range columns {
+			if normalizeColumn(column) == normalizeColumn(field) {
+				m.Columns[field] = column
+				break
+			}
+		}
+	}
+	return m
+}
+
+// mappingFromForm reads the mapping screen. It fails when the form names
+// columns or fields the import does not have, which the screen cannot send.
+func mappingFromForm(r *http.Request, upload *importUpload) (importMapping, bool) {
+	columns := make(map[string]bool)
+	for _, column := range upload.Table.Columns {
+		columns[column] = true
+	}
+
+	m := importMapping{Key: r.PostForm.Get("key"), Columns: make(map[string]string)}
+	for _, field := range upload.Kind.Fields {
+		column := r.PostForm.Get("map_" + field)
+		if column == "" {
+			continue
+		}
+		if !columns[column] {
+			return m, false
+		}
+		m.Columns[field] = column
+	}
+
+	for _, key := range upload.Kind.Keys {
+		if key == m.Key {
+			return m, true
+		}
+	}
+	return m, false
+}
+
+type importFieldView struct {
+	Name   string
+	Column string
+}
+
+// importView is the Misc of import_mapping.html.
+type importView struct {
+	Upload  *importUpload
+	Fields  []importFieldView
+	Key     string
+	Sample  [][]string
+	Preview *importPreview
+}
+
+func newImportView(upload *importUpload, m importMapping) importView {
+	view := importView{Upload: upload, Key: m.Key}
+	for _, field := range upload.Kind.Fields {
+		view.Fields = append(view.Fields, importFieldView{Name: field, Column: m.Columns[field]})
+	}
+	for i, row := range upload.Table.Rows {
+		if i == 3 {
+			break
+		}
+		values := make([]string, len(upload.Table.Columns))
+		for j, column := range upload.Table.Columns {
+			values[j] = row.Values[column]
+		}
+		view.Sample = append(view.Sample, values)
+	}
+	return view
+}
+
+func (s *server) importUpload(w http.ResponseWriter, r *http.Request) (*importUpload, bool) {
+	upload, ok := s.imports.get(mux.Vars(r)["id"])
+	if !ok {
+		notFound().ServeHTTP(w, r)
+	}
+	return upload, ok
+}
+
+func renderImportMapping(w http.ResponseWriter, r *http.Request, view importView, errs validate.Errors) {
+	data := TemplateData{
+		Page:   models.Page{Title: "Import " + view.Upload.Kind.Name + " from " + view.Upload.FileName},
+		Errors: errs,
+		Misc:   view,
+	}
+	renderPage(w, r, "import_mapping.html", data)
+}
+
+// ImportMapping shows the columns of the uploaded file to map them to fields.
+func (s *server) ImportMapping(w http.ResponseWriter, r *http.Request) {
+	upload, ok := s.importUpload(w, r)
+	if !ok {
+		return
+	}
+
+	renderImportMapping(w, r, newImportView(upload, guessMapping(upload.Kind, upload.Table.Columns)), nil)
+}
+
+// ImportAction previews the import with the submitted mapping, or runs it.
+func (s *server) ImportAction(w http.ResponseWriter, r *http.Request) {
+	upload, ok := s.importUpload(w, r)
+	if !ok {
+		return
+	}
+	m, ok := mappingFromForm(r, upload)
+	if !ok {
+		BadRequest(w, r)
+		return
+	}
+
+	view := newImportView(upload, m)
+	if m.Columns[m.Key] == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		renderImportMapping(w, r, view, validate.Errors{"Key": "Map a column to " + m.Key + ", rows are matched by it."})
+		return
+	}
+
+	switch r.PostForm.Get("mode") {
+	case "preview":
+		preview, err := s.previewImport(r.Context(), upload, m)
+		if err != nil {
+			repositoryError(w, r, err)
+			return
+		}
+		view.Preview = &preview
+		renderImportMapping(w, r, view, nil)
+	case "import":
+		s.runImport(w, r, upload, m)
+	default:
+		BadRequest(w, r)
+	}
+}
+
+// importPlan is what importing a row does.
+type importPlan struct {
+	Line   int
+	Key    string
+	Update bool
+	// Errors explain why the row cannot be imported.
+	Errors []string
+	save   func(ctx context.Context) error
+}
+
+// duplicateKeys finds the rows whose key an earlier row already has, and
+// returns the line of the earlier row for each.
+func duplicateKeys(table tabular.Table, column string) map[int]int {
+	first := make(map[string]int)
+	duplicates := make(map[int]int)
+	for _, row := range table.Rows {
+		key := strings.TrimSpace(row.Values[column])
+		if key == "" {
+			continue
+		}
+		if line, ok := first[key]; ok {
+			duplicates[row.Line] = line
+			continue
+		}
+		first[key] = row.Line
+	}
+	return duplicates
+}
+
+// planImportRow works out what importing the row would do without saving it.
+// Errors are only returned when the repository fails, an invalid row is a
+// plan with Errors.
+func (s *server) planImportRow(ctx context.Context, kind *transferKind, m importMapping, row tabular.Row, duplicateOf int) (importPlan, error) {
+	// a line of JSON may leave out a column, that is not the same as clearing
+	// the field
+	values := make(map[string]string)
+	for field, column := range m.Columns {
+		if value, ok := row.Values[column]; ok {
+			values[field] = value
+		}
+	}
+
+	plan := importPlan{Line: row.Line, Key: strings.TrimSpace(values[m.Key])}
+	if plan.Key == "" {
+		plan.Errors = []string{m.Key + ": rows are matched by it, it cannot be empty."}
+		return plan, nil
+	}
+	if duplicateOf > 0 {
+		plan.Errors = []string{fmt.Sprintf("%s: line %d has the same %s.", m.Key, duplicateOf, m.Key)}
+		return plan, nil
+	}
+
+	if kind == pageTransfer {
+		return s.planPageRow(ctx, plan, values)
+	}
+	return s.planListingRow(ctx, plan, m.Key, values)
+}
+
+// setField overwrites a field with its column, fields without a column keep
+// their value.
+func setField(values map[string]string, field string, to *string, trim bool) {
+	value, ok := values[field]
+	if !ok {
+		return
+	}
+	if trim {
+		value = strings.TrimSpace(value)
+	}
+	*to = value
+}
+
+// setStatus sets the status from its column, ignoring case. An empty cell
+// keeps the status, new rows get the default one.
+func setStatus(values map[string]string, to *string) {
+	status := strings.ToLower(strings.TrimSpace(values["status"]))
+	if status != "" {
+		*to = status
+	}
+}
+
+func (s *server) planPageRow(ctx context.Context, plan importPlan, values map[string]string) (importPlan, error) {
+	page, err := s.pages.GetByUrl(ctx, plan.Key)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		page = models.Page{Status: models.PagePublished}
+	case err != nil:
+		return plan, err
+	default:
+		plan.Update = true
+	}
+
+	setField(values, "url", &page.Url, true)
+	setField(values, "title", &page.Title, true)
+	setField(values, "teaser", &page.Teaser, true)
+	setField(values, "content", &page.Content, false)
+	setStatus(values, &page.Status)
+
+	errs, err := s.validatePage(ctx, page)
+	if err != nil {
+		return plan, err
+	}
+	plan.Errors = importErrors(errs, pageTransfer)
+
+	update := plan.Update
+	plan.save = func(ctx context.Context) error {
+		if update {
+			return s.pages.Update(ctx, page)
+		}
+		_, err := s.pages.Create(ctx, page)
+		return err
+	}
+	return plan, nil
+}
+
+func (s *server) planListingRow(ctx context.Context, plan importPlan, key string, values map[string]string) (importPlan, error) {
+	var listing models.Listing
+	var err error
+	if key == "external_id" {
+		listing, err = s.listings.GetByExternalId(ctx, plan.Key)
+	} else {
+		listing, err = s.listings.GetByUrl(ctx, plan.Key)
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		listing = models.Listing{Status: models.ListingActive}
+	case err != nil:
+		return plan, err
+	default:
+		plan.Update = true
+	}
+
+	setField(values, "external_id", &listing.ExternalId, true)
+	setField(values, "url", &listing.Url, true)
+	setField(values, "title", &listing.Title, true)
+	setField(values, "description", &listing.Description, false)
+	setField(values, "category", &listing.Category, true)
+	setStatus(values, &listing.Status)
+
+	errs, err := s.validateListing(ctx, listing)
+	if err != nil {
+		return plan, err
+	}
+	plan.Errors = importErrors(errs, listingTransfer)
+
+	update := plan.Update
+	plan.save = func(ctx context.Context) error {
+		if update {
+			return s.listings.Update(ctx, listing)
+		}
+		_, err := s.listings.Create(ctx, listing)
+		return err
+	}
+	return plan, nil
+}
+
+// importErrors names the fields of validation errors as the import does,
+// ExternalId as external_id, in the order of the fields.
+func importErrors(errs validate.Errors, kind *transferKind) []string {
+	var fields []string
+	messages := make(map[string]string)
+	for name, message := range errs {
+		var field strings.Builder
+		for i, r := range name {
+			if unicode.IsUpper(r) && i > 0 {
+				field.WriteByte('_')
+			}
+			field.WriteRune(unicode.ToLower(r))
+		}
+		fields = append(fields, field.String())
+		messages[field.String()] = message
+	}
+
+	order := make(map[string]int)
+	for i, field := range kind.Fields {
+		order[field] = i
+	}
+	sort.Slice(fields, func(i, j int) bool { return order[fields[i]] < order[fields[j]] })
+
+	var list []string
+	for _, field := range fields {
+		list = append(list, field+": "+messages[field])
+	}
+	return list
+}
+
+// importPreview is what an import would do, found without saving anything.
+type importPreview struct {
+	Create  int
+	Update  int
+	Invalid int
+	// Rows are the invalid rows and the first valid ones, Hidden counts the
+	// valid rows left out.
+	Rows   []importPlan
+	Hidden int
+}
+
+func (s *server) previewImport(ctx context.Context, upload *importUpload, m importMapping) (importPreview, error) {
+	var preview importPreview
+	duplicates := duplicateKeys(upload.Table, m.Columns[m.Key])
+	shown := 0
+	for _, row := range upload.Table.Rows {
+		plan, err := s.planImportRow(ctx, upload.Kind, m, row, duplicates[row.Line])
+		if err != nil {
+			return preview, err
+		}
+
+		switch {
+		case len(plan.Errors) > 0:
+			preview.Invalid++
+			preview.Rows = append(preview.Rows, plan)
+			continue
+		case plan.Update:
+			preview.Update++
+		default:
+			preview.Create++
+		}
+
+		if shown < importPreviewRows {
+			shown++
+			preview.Rows = append(preview.Rows, plan)
+		} else {
+			preview.Hidden++
+		}
+	}
+	return preview, nil
+}
+
+// runImport saves every valid row, as a bulk action with a result per line.
+func (s *server) runImport(w http.ResponseWriter, r *http.Request, upload *importUpload, m importMapping) {
+	duplicates := duplicateKeys(upload.Table, m.Columns[m.Key])
+	rows := make(map[string]tabular.Row)
+	var lines []string
+	for _, row := range upload.Table.Rows {
+		line := strconv.Itoa(row.Line)
+		rows[line] = row
+		lines = append(lines, line)
+	}
+
+	options := map[string]string{"file": upload.FileName, "key": m.Key}
+	for field, column := range m.Columns {
+		options["column."+field] = column
+	}
+
+	s.runBulk(w, r, upload.Kind.Entity+".import", upload.Kind.Entity, options, lines, func(ctx context.Context, line string) (string, error) {
+		row := rows[line]
+		plan, err := s.planImportRow(ctx, upload.Kind, m, row, duplicates[row.Line])
+		if err != nil {
+			return plan.Key, err
+		}
+		if len(plan.Errors) > 0 {
+			return plan.Key, bulkReason(strings.Join(plan.Errors, " "))
+		}
+		if err := plan.save(ctx); err != nil {
+			return plan.Key, err
+		}
+		if plan.Update {
+			return plan.Key + " (updated)", nil
+		}
+		return plan.Key + " (created)", nil
+	})
+}
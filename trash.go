@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/annbelievable/go_listing/logger"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// confirmation is the Misc of confirm.html, a question answered by posting
+// to Action.
+type confirmation struct {
+	Question string
+	Action   string
+	Button   string
+	Cancel   string
+}
+
+func pageIdVar(r *http.Request) (uint64, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id, err == nil
+}
+
+// DeletePage asks before a page goes to the trash.
+func (s *server) DeletePage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageIdVar(r)
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	page, err := s.pages.Get(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		Page: models.Page{Title: "Delete page"},
+		Misc: confirmation{
+			Question: fmt.Sprintf("Move %q (%s) to the trash? It can be restored from there.", page.Title, page.Url),
+			Action:   "/delete-page/" + idString(id),
+			Button:   "Move to trash",
+			Cancel:   "/pages",
+		},
+	}
+	renderPage(w, r, "confirm.html", data)
+}
+
+func (s *server) DeletePageAction(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageIdVar(r)
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	before, err := s.pages.Get(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	if err := s.pages.Trash(r.Context(), id); err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "page.delete", "page", idString(id), before, nil)
+
+	http.Redirect(w, r, "/pages", http.StatusFound)
+}
+
+// Trash lists the deleted pages with their restore and purge actions.
+func (s *server) Trash(w http.ResponseWriter, r *http.Request) {
+	s.renderTrash(w, r, "")
+}
+
+func (s *server) renderTrash(w http.ResponseWriter, r *http.Request, message string) {
+	pages, err := s.pages.ListTrash(r.Context())
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		Page:    models.Page{Title: "Trash"},
+		Message: message,
+		Pages:   pages,
+	}
+	if s.trashRetention > 0 {
+		data.Content = fmt.Sprintf("Pages are purged %s after they were deleted.", formatRetention(s.trashRetention))
+	}
+	renderPage(w, r, "trash.html", data)
+}
+
+// formatRetention writes whole days as days, which is how retentions are
+// usually set.
+func formatRetention(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		if d == day {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
+
+// trashedPage finds a page in the trash, the other lookups skip them.
+func (s *server) trashedPage(ctx context.Context, id uint64) (models.Page, error) {
+	pages, err := s.pages.ListTrash(ctx)
+	if err != nil {
+		return models.Page{}, err
+	}
+	for _, page := range pages {
+		if page.Id == id {
+			return page, nil
+		}
+	}
+	return models.Page{}, repository.ErrNotFound
+}
+
+func (s *server) TrashRestoreAction(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageIdVar(r)
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	page, err := s.trashedPage(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	err = s.pages.Restore(r.Context(), id)
+	if errors.Is(err, repository.ErrUniqueViolation) {
+		w.WriteHeader(http.StatusConflict)
+		s.renderTrash(w, r, fmt.Sprintf("%q cannot be restored, another page uses %s now. Change that page's url first.", page.Title, page.Url))
+		return
+	}
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "page.restore", "page", idString(id), nil, page)
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
+
+// TrashPurge asks before a page is deleted for good.
+func (s *server) TrashPurge(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageIdVar(r)
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	page, err := s.trashedPage(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		Page: models.Page{Title: "Purge page"},
+		Misc: confirmation{
+			Question: fmt.Sprintf("Delete %q (%s) for good? This cannot be undone.", page.Title, page.Url),
+			Action:   "/trash/" + idString(id) + "/purge",
+			Button:   "Purge",
+			Cancel:   "/trash",
+		},
+	}
+	renderPage(w, r, "confirm.html", data)
+}
+
+func (s *server) TrashPurgeAction(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageIdVar(r)
+	if !ok {
+		notFound().ServeHTTP(w, r)
+		return
+	}
+
+	page, err := s.trashedPage(r.Context(), id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	if err := s.pages.Purge(r.Context(), id); err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+
+	s.recordAudit(r, s.currentActor(r), "page.purge", "page", idString(id), page, nil)
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
+
+// purgeTrash deletes the pages that have been in the trash for longer than
+// the retention.
+func (s *server) purgeTrash(ctx context.Context) error {
+	purged, err := s.pages.PurgeTrashed(ctx, time.Now().Add(-s.trashRetention))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		logger.Default().Info("purged pages from the trash", "count", purged, "retention", s.trashRetention)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package validate checks submitted values against declared rules and collects
+// one message per failing field, the shape TemplateData.Errors has.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule checks a value and returns the message to show next to its field, or ""
+// when the value passes. An error means the check itself could not run, such
+// as a lookup that failed.
+type Rule func(value string) (string, error)
+
+// Field is a submitted value and the rules it has to pass, in order.
+type Field struct {
+	Name  string
+	Value string
+	Rules []Rule
+}
+
+// Errors maps a field name to the message of its first failing rule.
+type Errors map[string]string
+
+// Check runs the rules of every field. Only the first failing rule of a field
+// is reported. Errors is nil when every field passes.
+func Check(fields ...Field) (Errors, error) {
+	var errs Errors
+	for _, field := range fields {
+		for _, rule := range field.Rules {
+			message, err := rule(field.Value)
+			if err != nil {
+				return nil, fmt.Errorf("validate %s: %w", field.Name, err)
+			}
+			if message != "" {
+				if errs == nil {
+					errs = make(Errors)
+				}
+				errs[field.Name] = message
+				break
+			}
+		}
+	}
+	return errs, nil
+}
+
+// The rules below let empty values pass, so a field is optional unless it is
+// also Required.
+
+// Required fails on values that are empty or only whitespace.
+func Required(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "This field is required.", nil
+	}
+	return "", nil
+}
+
+// MaxLength fails on values longer than n characters, which is how PostgreSQL
+// counts the length of a VARCHAR(n).
+func MaxLength(n int) Rule {
+	return func(value string) (string, error) {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("Use at most %d characters.", n), nil
+		}
+		return "", nil
+	}
+}
+
+// Path fails on anything but a path on this site, such as /about.
+func Path(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	const message = "Enter a path that starts with /, such as /about."
+	if !strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//") || strings.ContainsAny(value, " \t\r\n?#") {
+		return message, nil
+	}
+	if _, err := url.ParseRequestURI(value); err != nil {
+		return message, nil
+	}
+	return "", nil
+}
+
+// URL fails on anything but an absolute http or https URL.
+func URL(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(value, " \t\r\n") {
+		return "Enter a full URL such as https://example.com/item.", nil
+	}
+	return "", nil
+}
+
+// Email fails on anything but a bare address such as name@example.com.
+func Email(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	// ParseAddress also accepts display names and hosts without a dot
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		return "Enter an email address such as name@example.com.", nil
+	}
+	return "", nil
+}
+
+// OneOf fails on values that are not one of the listed ones.
+func OneOf(values ...string) Rule {
+	return func(value string) (string, error) {
+		if value == "" {
+			return "", nil
+		}
+		for _, allowed := range values {
+			if value == allowed {
+				return "", nil
+			}
+		}
+		return "Choose one of " + strings.Join(values, ", ") + ".", nil
+	}
+}
+
+// Unique fails with message when taken reports the value as used by another
+// record.
+func Unique(message string, taken func(value string) (bool, error)) Rule {
+	return func(value string) (string, error) {
+		if value == "" {
+			return "", nil
+		}
+
+		used, err := taken(value)
+		if err != nil {
+			return "", err
+		}
+		if used {
+			return message, nil
+		}
+		return "", nil
+	}
+}
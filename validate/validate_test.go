@@ -0,0 +1,83 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		value string
+		pass  bool
+	}{
+		{"required", Required, "x", true},
+		{"required empty", Required, "", false},
+		{"required blank", Required, " \t", false},
+		{"max length", MaxLength(3), "abc", true},
+		{"max length counts characters", MaxLength(3), "äöü", true},
+		{"max length too long", MaxLength(3), "abcd", false},
+		{"path", Path, "/about/us", true},
+		{"path empty", Path, "", true},
+		{"path relative", Path, "about", false},
+		{"path with space", Path, "/about us", false},
+		{"path with query", Path, "/about?x=1", false},
+		{"path protocol relative", Path, "//example.com", false},
+		{"url", URL, "https://example.com/item?id=1", true},
+		{"url without scheme", URL, "example.com/item", false},
+		{"url other scheme", URL, "ftp://example.com", false},
+		{"email", Email, "name@example.com", true},
+		{"email without at", Email, "name.example.com", false},
+		{"email with name", Email, "Name <name@example.com>", false},
+		{"email without dot", Email, "name@localhost", false},
+		{"one of", OneOf("a", "b"), "b", true},
+		{"one of other", OneOf("a", "b"), "c", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := test.rule(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (message == "") != test.pass {
+				t.Fatalf("%q: message %q, want pass %v", test.value, message, test.pass)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	taken := Unique("taken", func(value string) (bool, error) {
+		return value == "used", nil
+	})
+
+	errs, err := Check(
+		Field{Name: "A", Value: "", Rules: []Rule{Required, MaxLength(1)}},
+		Field{Name: "B", Value: "used", Rules: []Rule{Required, MaxLength(1), taken}},
+		Field{Name: "C", Value: "free", Rules: []Rule{Required, taken}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Errors{"A": "This field is required.", "B": "Use at most 1 characters."}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("got %v, want %v", errs, want)
+	}
+
+	errs, err = Check(Field{Name: "A", Value: "ok", Rules: []Rule{Required}})
+	if errs != nil || err != nil {
+		t.Fatalf("valid fields gave %v, %v", errs, err)
+	}
+
+	failed := errors.New("lookup failed")
+	_, err = Check(Field{Name: "A", Value: "x", Rules: []Rule{Unique("taken", func(string) (bool, error) {
+		return false, failed
+	})}})
+	if !errors.Is(err, failed) || !strings.Contains(err.Error(), "A") {
+		t.Fatalf("got error %v, want the lookup error for A", err)
+	}
+}
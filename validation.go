@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/validate"
+)
+
+// maxVarchar is the length of the VARCHAR(255) and CHAR(255) columns.
+const maxVarchar = 255
+
+// maxPassword is the most bytes bcrypt hashes, longer passwords fail to hash.
+const maxPassword = 72
+
+// validatePage checks a page submitted to be created or, when page.Id is set,
+// updated.
+func (s *server) validatePage(ctx context.Context, page models.Page) (validate.Errors, error) {
+	urlTaken := validate.Unique("A page with this url already exists.", func(url string) (bool, error) {
+		existing, err := s.pages.GetByUrl(ctx, url)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil && existing.Id != page.Id, err
+	})
+
+	return validate.Check(
+		validate.Field{Name: "Url", Value: page.Url, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar), validate.Path, urlTaken}},
+		validate.Field{Name: "Title", Value: page.Title, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar)}},
+		validate.Field{Name: "Teaser", Value: page.Teaser, Rules: []validate.Rule{validate.MaxLength(maxVarchar)}},
+		validate.Field{Name: "Status", Value: page.Status, Rules: []validate.Rule{validate.Required, validate.OneOf(models.PagePublished, models.PageDraft)}},
+	)
+}
+
+// validateListing checks a listing to be created or, when listing.Id is set,
+// updated.
+func (s *server) validateListing(ctx context.Context, listing models.Listing) (validate.Errors, error) {
+	urlTaken := validate.Unique("A listing with this url already exists.", func(url string) (bool, error) {
+		existing, err := s.listings.GetByUrl(ctx, url)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil && existing.Id != listing.Id, err
+	})
+	externalIdTaken := validate.Unique("A listing with this external id already exists.", func(externalId string) (bool, error) {
+		existing, err := s.listings.GetByExternalId(ctx, externalId)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil && existing.Id != listing.Id, err
+	})
+
+	return validate.Check(
+		validate.Field{Name: "ExternalId", Value: listing.ExternalId, Rules: []validate.Rule{validate.MaxLength(maxVarchar), externalIdTaken}},
+		validate.Field{Name: "Url", Value: listing.Url, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar), validate.Path, urlTaken}},
+		validate.Field{Name: "Title", Value: listing.Title, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar)}},
+		validate.Field{Name: "Category", Value: listing.Category, Rules: []validate.Rule{validate.MaxLength(maxVarchar)}},
+		validate.Field{Name: "Status", Value: listing.Status, Rules: []validate.Rule{validate.Required, validate.OneOf(models.ListingActive, models.ListingExpired)}},
+	)
+}
+
+// validateAdmin checks the email and password of an admin registering.
+func (s *server) validateAdmin(ctx context.Context, email, password string) (validate.Errors, error) {
+	emailTaken := validate.Unique("An admin with this email already exists.", func(email string) (bool, error) {
+		_, err := s.admins.GetByEmail(ctx, email)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+
+	passwordFits := func(password string) (string, error) {
+		if len(password) > maxPassword {
+			return "Use a password of at most 72 bytes.", nil
+		}
+		return "", nil
+	}
+
+	return validate.Check(
+		validate.Field{Name: "Email", Value: email, Rules: []validate.Rule{validate.Required, validate.MaxLength(maxVarchar), validate.Email, emailTaken}},
+		validate.Field{Name: "Password", Value: password, Rules: []validate.Rule{validate.Required, passwordFits}},
+	)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/annbelievable/go_listing/media"
+	"github.com/annbelievable/go_listing/models"
+	"github.com/annbelievable/go_listing/repository"
+	"github.com/annbelievable/go_listing/wordpress"
+)
+
+// mediaPrefix is the path media files are served under.
+const mediaPrefix = "/media/"
+
+// mediaTimeout bounds the download of one attachment.
+const mediaTimeout = 2 * time.Minute
+
+// uploadsPath is where WordPress keeps uploaded files, the part after it
+// becomes the media name so 2021/05/photo.jpg stays 2021/05/photo.jpg.
+const uploadsPath = "/wp-content/uploads/"
+
+var (
+	slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+	// the size WordPress appends to the scaled copies of an image, such as
+	// photo-300x200.jpg
+	imageSize = regexp.MustCompile(`-[0-9]+x[0-9]+(\.[A-Za-z0-9]+)$`)
+)
+
+type wordpressOptions struct {
+	// Client downloads the attachments.
+	Client *http.Client
+	// DryRun finds what the import would do without saving anything or
+	// downloading the attachments.
+	DryRun bool
+}
+
+// wordpressReport counts what an import did. Errors name the items that
+// failed and why.
+type wordpressReport struct {
+	Created   int      `json:"created"`
+	Updated   int      `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	Skipped   int      `json:"skipped"`
+	Media     int      `json:"media"`
+	Redirects int      `json:"redirects"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// wordpressImport holds what one import learns about the site it reads from.
+type wordpressImport struct {
+	s      *server
+	opts   wordpressOptions
+	site   *url.URL
+	report wordpressReport
+	// targets maps the old addresses of pages, posts and attachments, as
+	// oldKey returns them, to where they are now.
+	targets map[string]string
+}
+
+// importWordPress moves the pages, posts and attachments of a WordPress
+// export into the site. Pages and posts become pages at their slug, a page
+// already there is updated, so the import can run again. The files of
+// attachments go to the media store, and the old permalinks redirect to the
+// new addresses.
+func (s *server) importWordPress(ctx context.Context, export wordpress.Export, opts wordpressOptions) wordpressReport {
+	site, err := url.Parse(export.Link)
+	if err != nil || export.Link == "" {
+		site = &url.URL{}
+	}
+	imp := &wordpressImport{s: s, opts: opts, site: site, targets: make(map[string]string)}
+
+	byId := make(map[int]wordpress.Item)
+	for _, item := range export.Items {
+		byId[item.Id] = item
+	}
+
+	// every address is known before the content is converted, pages link to
+	// each other and to the attachments
+	var pages []wordpress.Item
+	urls := make(map[int]string)
+	taken := make(map[string]int)
+	for _, item := range export.Items {
+		switch item.Type {
+		case wordpress.TypeAttachment:
+			imp.attachment(ctx, item)
+			continue
+		case wordpress.TypePage, wordpress.TypePost:
+		default:
+			// menus, revisions and the post types of plugins
+			imp.report.Skipped++
+			continue
+		}
+		if wordpressStatus(item.Status) == "" {
+			imp.report.Skipped++
+			continue
+		}
+
+		pageUrl := wordpressUrl(item, byId)
+		if other, ok := taken[pageUrl]; ok {
+			imp.fail(item, fmt.Sprintf("%s is also the url of %s %d", pageUrl, byId[other].Type, other))
+			continue
+		}
+		taken[pageUrl] = item.Id
+		urls[item.Id] = pageUrl
+		pages = append(pages, item)
+
+		imp.target(item.Link, pageUrl)
+		imp.target(imp.plainLink("p", item.Id), pageUrl)
+		if item.Type == wordpress.TypePage {
+			imp.target(imp.plainLink("page_id", item.Id), pageUrl)
+		}
+	}
+
+	for _, item := range pages {
+		if ctx.Err() != nil {
+			imp.fail(item, "stopped: "+ctx.Err().Error())
+			break
+		}
+		if imp.page(ctx, item, urls[item.Id]) {
+			imp.redirect(ctx, item.Link, urls[item.Id])
+			imp.redirect(ctx, imp.plainLink("p", item.Id), urls[item.Id])
+			if item.Type == wordpress.TypePage {
+				imp.redirect(ctx, imp.plainLink("page_id", item.Id), urls[item.Id])
+			}
+		}
+	}
+
+	return imp.report
+}
+
+func (imp *wordpressImport) fail(item wordpress.Item, reason string) {
+	imp.report.Failed++
+	name := item.Slug
+	if name == "" {
+		name = item.Title
+	}
+	imp.report.Errors = append(imp.report.Errors, fmt.Sprintf("%s %d (%s): %s", item.Type, item.Id, name, reason))
+}
+
+// wordpressStatus is the page status of a post, "" for posts that are not
+// imported: the trash, auto drafts and revisions.
+func wordpressStatus(status string) string {
+	switch status {
+	case wordpress.StatusPublish:
+		return models.PagePublished
+	case wordpress.StatusDraft, wordpress.StatusPending, wordpress.StatusPrivate, wordpress.StatusFuture:
+		return models.PageDraft
+	}
+	return ""
+}
+
+// wordpressSlug is the slug of the item, made from the title for drafts that
+// never got one.
+func wordpressSlug(item wordpress.Item) string {
+	if item.Slug != "" {
+		return item.Slug
+	}
+	if slug := strings.Trim(slugChars.ReplaceAllString(strings.ToLower(item.Title), "-"), "-"); slug != "" {
+		return slug
+	}
+	return item.Type + "-" + strconv.Itoa(item.Id)
+}
+
+// wordpressUrl is the page url of a page or post. Child pages keep the slugs
+// of their parents in front, as in WordPress.
+func wordpressUrl(item wordpress.Item, byId map[int]wordpress.Item) string {
+	slugs := []string{wordpressSlug(item)}
+	seen := map[int]bool{item.Id: true}
+	for item.Type == wordpress.TypePage {
+		parent, ok := byId[item.Parent]
+		// a broken export can have a loop of parents
+		if !ok || parent.Type != wordpress.TypePage || seen[parent.Id] {
+			break
+		}
+		seen[parent.Id] = true
+		slugs = append([]string{wordpressSlug(parent)}, slugs...)
+		item = parent
+	}
+	return "/" + strings.Join(slugs, "/")
+}
+
+// oldKey is how an address of the old site is looked up: its path and query
+// without a trailing slash. Addresses on other hosts have none.
+func (imp *wordpressImport) oldKey(address string) (string, bool) {
+	u, err := url.Parse(address)
+	if err != nil || address == "" {
+		return "", false
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, imp.site.Host) {
+		return "", false
+	}
+	if u.Host == "" && !strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	key := strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key, true
+}
+
+// plainLink is the address WordPress answers for any post, whatever the
+// permalink format: /?p=12, or /?page_id=12 for pages.
+func (imp *wordpressImport) plainLink(param string, id int) string {
+	return strings.TrimSuffix(imp.site.Path, "/") + "/?" + param + "=" + strconv.Itoa(id)
+}
+
+func (imp *wordpressImport) target(address, target string) {
+	if key, ok := imp.oldKey(address); ok {
+		imp.targets[key] = target
+	}
+}
+
+// rewrite returns the new address of a link or image in the content. Scaled
+// copies of images link to the whole image, only that one is imported.
+func (imp *wordpressImport) rewrite(address string) string {
+	key, ok := imp.oldKey(address)
+	if !ok {
+		return address
+	}
+	if target, ok := imp.targets[key]; ok {
+		return target
+	}
+	if target, ok := imp.targets[imageSize.ReplaceAllString(key, "$1")]; ok {
+		return target
+	}
+	return address
+}
+
+// redirect sends the old address, on the old site, to target. The front
+// page is not redirected, it is the front page here too.
+func (imp *wordpressImport) redirect(ctx context.Context, address, target string) {
+	u, err := url.Parse(address)
+	if err != nil || address == "" {
+		return
+	}
+	if key, ok := imp.oldKey(address); !ok || key == "" {
+		return
+	}
+	from := u.EscapedPath()
+	if u.RawQuery != "" {
+		from += "?" + u.RawQuery
+	}
+	// /about/ redirects to /about, redirectHandler does not send /about back
+	if from == target || len(from) > maxVarchar {
+		return
+	}
+
+	if !imp.opts.DryRun {
+		if err := imp.s.redirects.Save(ctx, models.Redirect{Path: from, Target: target}); err != nil {
+			imp.report.Failed++
+			imp.report.Errors = append(imp.report.Errors, fmt.Sprintf("redirect %s: %s", from, bulkItemError(nil, err)))
+			return
+		}
+	}
+	imp.report.Redirects++
+}
+
+// mediaName is the name the file of an attachment is stored under.
+func mediaName(attachmentURL string) string {
+	u, err := url.Parse(attachmentURL)
+	if err != nil {
+		return ""
+	}
+	if i := strings.Index(u.Path, uploadsPath); i >= 0 {
+		return media.CleanName(u.Path[i+len(uploadsPath):])
+	}
+	return media.CleanName("wordpress/" + path.Base(u.Path))
+}
+
+// attachment imports the file of an attachment, unless an earlier run did.
+func (imp *wordpressImport) attachment(ctx context.Context, item wordpress.Item) {
+	name := mediaName(item.AttachmentURL)
+	if name == "" {
+		imp.fail(item, "it has no file")
+		return
+	}
+	target := mediaPrefix + name
+
+	if err := imp.download(ctx, item.AttachmentURL, name); err != nil {
+		imp.fail(item, err.Error())
+		return
+	}
+
+	imp.target(item.AttachmentURL, target)
+	imp.target(item.Link, target)
+	imp.redirect(ctx, item.AttachmentURL, target)
+	imp.redirect(ctx, item.Link, target)
+}
+
+func (imp *wordpressImport) download(ctx context.Context, address, name string) error {
+	store := imp.s.media
+	if store == nil {
+		return errors.New("no media store is configured")
+	}
+	exists, err := store.Exists(name)
+	if err != nil {
+		return err
+	}
+	if exists || imp.opts.DryRun {
+		if !exists {
+			imp.report.Media++
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := imp.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", address, resp.Status)
+	}
+
+	if err := store.Save(name, resp.Body); err != nil {
+		return fmt.Errorf("storing %s: %w", name, err)
+	}
+	imp.report.Media++
+	return nil
+}
+
+// page creates or updates the page of a post. It reports whether the page
+// is there, so its old addresses can redirect to it.
+func (imp *wordpressImport) page(ctx context.Context, item wordpress.Item, pageUrl string) bool {
+	s := imp.s
+	existing, err := s.pages.GetByUrl(ctx, pageUrl)
+	found := err == nil
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		imp.fail(item, bulkItemError(nil, err).Error())
+		return false
+	}
+
+	page := existing
+	page.Url = pageUrl
+	page.Title = item.Title
+	page.Teaser = truncate(wordpress.Text(item.Excerpt, imp.rewrite), maxVarchar)
+	page.Content = wordpress.Text(item.Content, imp.rewrite)
+	page.Status = wordpressStatus(item.Status)
+	if found && page == existing {
+		imp.report.Unchanged++
+		return true
+	}
+
+	errs, err := s.validatePage(ctx, page)
+	if err != nil {
+		imp.fail(item, bulkItemError(nil, err).Error())
+		return false
+	}
+	if errs != nil {
+		imp.fail(item, strings.Join(importErrors(errs, pageTransfer), " "))
+		return false
+	}
+
+	if !imp.opts.DryRun {
+		if found {
+			err = s.pages.Update(ctx, page)
+		} else {
+			_, err = s.pages.Create(ctx, page)
+		}
+		if err != nil {
+			imp.fail(item, bulkItemError(nil, err).Error())
+			return false
+		}
+	}
+	if found {
+		imp.report.Updated++
+	} else {
+		imp.report.Created++
+	}
+	return true
+}
+
+// truncate cuts text to at most max characters, at a space when there is
+// one.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)[:max-1]
+	cut := string(runes)
+	if i := strings.LastIndexAny(cut, " \n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut) + "…"
+}
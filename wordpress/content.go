@@ -0,0 +1,309 @@
+package wordpress
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	blockComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// shortcodes such as [gallery ids="1,2"] or [/caption]
+	shortcode = regexp.MustCompile(`\[/?[a-z][a-z0-9_-]*(\s[^\]]*)?/?\]`)
+	blockTag  = regexp.MustCompile(`(?i)<(p|div|h[1-6]|ul|ol|blockquote|pre|table|figure)[\s>]`)
+	anyTag    = regexp.MustCompile(`<[^>]*>`)
+	breakTag  = regexp.MustCompile(`(?i)<br\s*/?>|</?(p|div|h[1-6]|li|ul|ol|blockquote|pre|table|tr|figure)(\s[^>]*)?>`)
+	// a < that does not open a tag, like in "a < b"
+	looseLt   = regexp.MustCompile(`<([^a-zA-Z/!])`)
+	lineSpace = regexp.MustCompile(`[ \t]+`)
+	blankLine = regexp.MustCompile(`\n\s*\n`)
+	spaces    = regexp.MustCompile(`\s+`)
+)
+
+// Text converts the HTML of a post to Markdown, which reads as text where
+// the site shows content as is. Block editor comments and shortcodes are
+// dropped, the text inside [caption] is kept. rewrite returns the address
+// to use for the address of a link or image, nil keeps them.
+func Text(content string, rewrite func(string) string) string {
+	if rewrite == nil {
+		rewrite = func(address string) string { return address }
+	}
+
+	content = blockComment.ReplaceAllString(content, "")
+	content = shortcode.ReplaceAllString(content, "")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	// posts of the classic editor are stored without paragraphs, WordPress
+	// adds them when the post is shown
+	if !blockTag.MatchString(content) {
+		content = autop(content)
+	}
+
+	c := converter{rewrite: rewrite}
+	if err := c.convert(looseLt.ReplaceAllString(content, "&lt;$1")); err != nil {
+		// not even loose HTML, keep the text and the paragraphs
+		text := breakTag.ReplaceAllString(content, "\n\n")
+		text = html.UnescapeString(anyTag.ReplaceAllString(text, ""))
+		text = lineSpace.ReplaceAllString(text, " ")
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\n ", "\n"), " \n", "\n")
+		return strings.TrimSpace(blankLine.ReplaceAllString(text, "\n\n"))
+	}
+	return c.String()
+}
+
+// autop wraps the paragraphs of classic editor content, blank lines apart,
+// in <p> and turns the other line breaks into <br>.
+func autop(content string) string {
+	var b strings.Builder
+	for _, paragraph := range blankLine.Split(strings.TrimSpace(content), -1) {
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(strings.TrimSpace(paragraph), "\n", "<br>"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+type list struct {
+	ordered bool
+	count   int
+}
+
+type block struct {
+	text string
+	// list items of one list are not set apart by a blank line
+	item   bool
+	quotes int
+}
+
+type converter struct {
+	rewrite func(string) string
+	blocks  []block
+	// line is the text of the block being read
+	line   strings.Builder
+	prefix string
+	item   bool
+	lists  []list
+	quotes int
+	links  []string
+	pre    bool
+	skip   int
+}
+
+func (c *converter) convert(content string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<div>" + content + "</div>"))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			c.flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			c.start(strings.ToLower(t.Name.Local), t.Attr)
+		case xml.EndElement:
+			c.end(strings.ToLower(t.Name.Local))
+		case xml.CharData:
+			if c.skip > 0 {
+				continue
+			}
+			if c.pre {
+				c.line.Write(t)
+				continue
+			}
+			text := spaces.ReplaceAllString(string(t), " ")
+			if strings.HasSuffix(c.line.String(), "\n") || c.line.Len() == 0 || strings.HasSuffix(c.line.String(), " ") {
+				text = strings.TrimLeft(text, " ")
+			}
+			c.line.WriteString(text)
+		}
+	}
+}
+
+func attr(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+func (c *converter) start(name string, attrs []xml.Attr) {
+	if c.skip > 0 {
+		if name == "script" || name == "style" {
+			c.skip++
+		}
+		return
+	}
+
+	switch name {
+	case "script", "style":
+		c.skip++
+	case "p", "div", "figure", "figcaption", "table", "tr":
+		c.flush()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.flush()
+		level, _ := strconv.Atoi(name[1:])
+		c.prefix = strings.Repeat("#", level) + " "
+	case "blockquote":
+		c.flush()
+		c.quotes++
+	case "ul", "ol":
+		c.flush()
+		c.lists = append(c.lists, list{ordered: name == "ol"})
+	case "li":
+		c.flush()
+		if len(c.lists) == 0 {
+			c.lists = append(c.lists, list{})
+		}
+		l := &c.lists[len(c.lists)-1]
+		l.count++
+		c.prefix = strings.Repeat("  ", len(c.lists)-1) + "- "
+		if l.ordered {
+			c.prefix = strings.Repeat("  ", len(c.lists)-1) + strconv.Itoa(l.count) + ". "
+		}
+		c.item = true
+	case "pre":
+		c.flush()
+		c.pre = true
+	case "hr":
+		c.flush()
+		c.blocks = append(c.blocks, block{text: "---"})
+	case "br":
+		c.line.WriteString("\n")
+	case "td", "th":
+		if c.line.Len() > 0 {
+			c.line.WriteString(" | ")
+		}
+	case "strong", "b":
+		c.line.WriteString("**")
+	case "em", "i":
+		c.line.WriteString("_")
+	case "code":
+		if !c.pre {
+			c.line.WriteString("`")
+		}
+	case "a":
+		href := attr(attrs, "href")
+		c.links = append(c.links, href)
+		if href != "" {
+			c.line.WriteString("[")
+		}
+	case "img":
+		if src := attr(attrs, "src"); src != "" {
+			c.line.WriteString("![" + attr(attrs, "alt") + "](" + c.rewrite(src) + ")")
+		}
+	}
+}
+
+func (c *converter) end(name string) {
+	if c.skip > 0 {
+		if name == "script" || name == "style" {
+			c.skip--
+		}
+		return
+	}
+
+	switch name {
+	case "p", "div", "figure", "figcaption", "table", "tr", "li",
+		"h1", "h2", "h3", "h4", "h5", "h6":
+		c.flush()
+	case "blockquote":
+		c.flush()
+		if c.quotes > 0 {
+			c.quotes--
+		}
+	case "ul", "ol":
+		c.flush()
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+	case "pre":
+		text := strings.Trim(c.line.String(), "\n")
+		c.line.Reset()
+		c.pre = false
+		c.add(block{text: "```\n" + text + "\n```"})
+	case "strong", "b":
+		c.line.WriteString("**")
+	case "em", "i":
+		c.line.WriteString("_")
+	case "code":
+		if !c.pre {
+			c.line.WriteString("`")
+		}
+	case "a":
+		if len(c.links) == 0 {
+			return
+		}
+		href := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+		if href != "" {
+			c.line.WriteString("](" + c.rewrite(href) + ")")
+		}
+	}
+}
+
+// flush ends the block being read.
+func (c *converter) flush() {
+	if c.pre {
+		return
+	}
+	var lines []string
+	for _, line := range strings.Split(c.line.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	c.line.Reset()
+	if len(lines) > 0 {
+		c.add(block{text: c.prefix + strings.Join(lines, "\n"), item: c.item})
+	}
+	c.prefix = ""
+	c.item = false
+}
+
+func (c *converter) add(b block) {
+	if c.quotes > 0 {
+		quote := strings.Repeat("> ", c.quotes)
+		b.text = quote + strings.ReplaceAll(b.text, "\n", "\n"+quote)
+		b.quotes = c.quotes
+	}
+	c.blocks = append(c.blocks, b)
+}
+
+func (c *converter) String() string {
+	var b strings.Builder
+	for i, block := range c.blocks {
+		if i > 0 {
+			previous := c.blocks[i-1]
+			switch {
+			case block.item && previous.item:
+				b.WriteString("\n")
+			case block.quotes > 0 && previous.quotes > 0:
+				// paragraphs of one quote
+				quotes := block.quotes
+				if previous.quotes < quotes {
+					quotes = previous.quotes
+				}
+				b.WriteString("\n" + strings.TrimSpace(strings.Repeat("> ", quotes)) + "\n")
+			default:
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(block.text)
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package wordpress
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const export = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>Old site</title>
+	<link>https://old.example</link>
+	<wp:wxr_version>1.2</wp:wxr_version>
+	<wp:base_site_url>https://old.example</wp:base_site_url>
+	<item>
+		<title>Hello &amp; welcome</title>
+		<link>https://old.example/2021/05/hello/</link>
+		<dc:creator><![CDATA[admin]]></dc:creator>
+		<content:encoded><![CDATA[<!-- wp:paragraph --><p>Hi</p><!-- /wp:paragraph -->]]></content:encoded>
+		<excerpt:encoded><![CDATA[Short]]></excerpt:encoded>
+		<wp:post_id>12</wp:post_id>
+		<wp:post_name><![CDATA[hello]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_parent>0</wp:post_parent>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+	<item>
+		<title>photo</title>
+		<link>https://old.example/2021/05/hello/photo/</link>
+		<wp:post_id>13</wp:post_id>
+		<wp:post_name>photo</wp:post_name>
+		<wp:status>inherit</wp:status>
+		<wp:post_parent>12</wp:post_parent>
+		<wp:post_type>attachment</wp:post_type>
+		<wp:attachment_url>https://old.example/wp-content/uploads/2021/05/photo.jpg</wp:attachment_url>
+	</item>
+</channel>
+</rss>`
+
+func TestParse(t *testing.T) {
+	got, err := Parse(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Export{
+		Title: "Old site",
+		Link:  "https://old.example",
+		Items: []Item{
+			{Id: 12, Type: TypePost, Title: "Hello & welcome", Slug: "hello", Status: StatusPublish, Link: "https://old.example/2021/05/hello/",
+				Content: "<!-- wp:paragraph --><p>Hi</p><!-- /wp:paragraph -->", Excerpt: "Short"},
+			{Id: 13, Type: TypeAttachment, Title: "photo", Slug: "photo", Status: "inherit", Parent: 12, Link: "https://old.example/2021/05/hello/photo/",
+				AttachmentURL: "https://old.example/wp-content/uploads/2021/05/photo.jpg"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse returned\n%+v\nwant\n%+v", got, want)
+	}
+
+	for _, in := range []string{`<rss version="2.0"><channel><title>Feed</title></channel></rss>`, `<urlset></urlset>`} {
+		if _, err := Parse(strings.NewReader(in)); !errors.Is(err, ErrNotWXR) {
+			t.Errorf("Parse(%q) returned %v, want ErrNotWXR", in, err)
+		}
+	}
+	if _, err := Parse(strings.NewReader("<rss><channel>")); err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Errorf("Parse of a cut off file returned %v", err)
+	}
+}
+
+func TestText(t *testing.T) {
+	rewrite := func(address string) string {
+		return strings.Replace(address, "https://old.example/wp-content/uploads/", "/media/", 1)
+	}
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "<!-- wp:paragraph --><!-- /wp:paragraph -->", ""},
+		{
+			"block editor",
+			"<!-- wp:heading --><h2>Rooms</h2><!-- /wp:heading -->\n\n<!-- wp:paragraph -->\n<p>Two <strong>big</strong> rooms, see <a href=\"/contact/\">us&nbsp;now</a>.</p>\n<!-- /wp:paragraph -->",
+			"## Rooms\n\nTwo **big** rooms, see [us now](/contact/).",
+		},
+		{
+			"classic editor",
+			"First line\nsecond line\n\n[caption id=\"attachment_13\"]<img src=\"https://old.example/wp-content/uploads/2021/05/photo.jpg\" alt=\"A photo\" /> The garden[/caption]\n\nFish & chips",
+			"First line\nsecond line\n\n![A photo](/media/2021/05/photo.jpg) The garden\n\nFish & chips",
+		},
+		{
+			"lists",
+			"<ul><li>one</li><li>two<ol><li>two a</li><li>two b</li></ol></li></ul><p>after</p>",
+			"- one\n- two\n  1. two a\n  2. two b\n\nafter",
+		},
+		{
+			"quote and code",
+			"<blockquote><p>quoted</p><p>twice</p></blockquote><pre>if a < b {\n\treturn\n}</pre><p>x<br>y</p><script>alert(1)</script>",
+			"> quoted\n>\n> twice\n\n```\nif a < b {\n\treturn\n}\n```\n\nx\ny",
+		},
+		{"broken html", "<p>one</div> two</p>", "one\n\ntwo"},
+	}
+	for _, test := range tests {
+		if got := Text(test.in, rewrite); got != test.want {
+			t.Errorf("%s: Text returned\n%q\nwant\n%q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package wordpress reads WordPress eXtended RSS (WXR) export files and
+// converts their content to text.
+package wordpress
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Post types the importer knows.
+const (
+	TypePage       = "page"
+	TypePost       = "post"
+	TypeAttachment = "attachment"
+)
+
+// Statuses of posts and pages. Attachments have "inherit".
+const (
+	StatusPublish = "publish"
+	StatusDraft   = "draft"
+	StatusPending = "pending"
+	StatusPrivate = "private"
+	StatusFuture  = "future"
+	StatusTrash   = "trash"
+)
+
+// ErrNotWXR is returned for a file that is not a WordPress export.
+var ErrNotWXR = errors.New("not a WordPress export file")
+
+const (
+	contentSpace = "http://purl.org/rss/1.0/modules/content/"
+	// the excerpt namespace has the WXR version in it, such as
+	// http://wordpress.org/export/1.2/excerpt/
+	excerptSuffix = "/excerpt/"
+)
+
+// Export is the site and the items of a WXR file.
+type Export struct {
+	Title string
+	// Link is the address of the site, such as https://example.com/blog.
+	Link  string
+	Items []Item
+}
+
+// Item is a page, post, attachment or any other post type of the export.
+type Item struct {
+	Id    int
+	Type  string
+	Title string
+	// Slug is the last segment of the permalink, it is empty for drafts that
+	// never had one.
+	Slug   string
+	Status string
+	// Parent is the id of the parent page, or of the post an attachment
+	// belongs to, 0 for none.
+	Parent int
+	// Link is the permalink the item had on the site.
+	Link    string
+	Content string
+	Excerpt string
+	// AttachmentURL is the address of the file of an attachment.
+	AttachmentURL string
+}
+
+type wxrText struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+type wxrItem struct {
+	Title  string `xml:"title"`
+	Link   string `xml:"link"`
+	PostId string `xml:"post_id"`
+	// content:encoded and excerpt:encoded only differ by namespace
+	Encoded       []wxrText `xml:"encoded"`
+	PostName      string    `xml:"post_name"`
+	Status        string    `xml:"status"`
+	PostParent    string    `xml:"post_parent"`
+	PostType      string    `xml:"post_type"`
+	AttachmentURL string    `xml:"attachment_url"`
+}
+
+type wxrFile struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		WXRVersion  string    `xml:"wxr_version"`
+		BaseSiteURL string    `xml:"base_site_url"`
+		Items       []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Parse reads a WXR file. Items keep the order of the file.
+func Parse(r io.Reader) (Export, error) {
+	var file wxrFile
+	decoder := xml.NewDecoder(r)
+	// exports of older sites declare their charset, pass it through
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&file); err != nil {
+		var syntax *xml.SyntaxError
+		if errors.As(err, &syntax) {
+			return Export{}, fmt.Errorf("line %d: %s", syntax.Line, syntax.Msg)
+		}
+		// the root element is not <rss>
+		var unmarshal xml.UnmarshalError
+		if errors.As(err, &unmarshal) {
+			return Export{}, ErrNotWXR
+		}
+		return Export{}, err
+	}
+	if file.Channel.WXRVersion == "" {
+		return Export{}, ErrNotWXR
+	}
+
+	export := Export{
+		Title: strings.TrimSpace(file.Channel.Title),
+		Link:  strings.TrimSpace(file.Channel.Link),
+	}
+	if export.Link == "" {
+		export.Link = strings.TrimSpace(file.Channel.BaseSiteURL)
+	}
+
+	for i, raw := range file.Channel.Items {
+		id, err := strconv.Atoi(strings.TrimSpace(raw.PostId))
+		if err != nil {
+			return Export{}, fmt.Errorf("item %d: post_id %q is not a number", i+1, raw.PostId)
+		}
+		// a missing parent is 0 like in WordPress
+		parent, _ := strconv.Atoi(strings.TrimSpace(raw.PostParent))
+
+		item := Item{
+			Id:            id,
+			Type:          strings.TrimSpace(raw.PostType),
+			Title:         strings.TrimSpace(raw.Title),
+			Slug:          strings.TrimSpace(raw.PostName),
+			Status:        strings.TrimSpace(raw.Status),
+			Parent:        parent,
+			Link:          strings.TrimSpace(raw.Link),
+			AttachmentURL: strings.TrimSpace(raw.AttachmentURL),
+		}
+		for _, encoded := range raw.Encoded {
+			switch {
+			case encoded.XMLName.Space == contentSpace:
+				item.Content = encoded.Text
+			case strings.HasSuffix(encoded.XMLName.Space, excerptSuffix):
+				item.Excerpt = encoded.Text
+			}
+		}
+		export.Items = append(export.Items, item)
+	}
+
+	return export, nil
+}
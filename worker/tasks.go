@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ItemFunc processes one item of a task and returns a label to show for it,
+// such as a url. It should return soon after ctx is done.
+type ItemFunc func(ctx context.Context, item string) (string, error)
+
+// ItemResult is the outcome of one item of a task.
+type ItemResult struct {
+	Item  string
+	Label string
+	// Error is empty when the item succeeded.
+	Error string
+}
+
+// Task is the state of a one-off job over a list of items, as reported by
+// Tasks.Get.
+type Task struct {
+	Id       string
+	Name     string
+	Total    int
+	Results  []ItemResult
+	Failed   int
+	Started  time.Time
+	Finished time.Time
+}
+
+// Done is the number of items processed so far.
+func (t Task) Done() int {
+	return len(t.Results)
+}
+
+func (t Task) Running() bool {
+	return t.Finished.IsZero()
+}
+
+// Tasks runs one-off jobs over lists of items, one item after the other,
+// and keeps their results in memory for a while after they finish.
+type Tasks struct {
+	mu     sync.Mutex
+	tasks  map[string]*Task
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// keep is how long finished tasks stay available.
+	keep time.Duration
+}
+
+func NewTasks() *Tasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tasks{
+		tasks:  make(map[string]*Task),
+		ctx:    ctx,
+		cancel: cancel,
+		keep:   time.Hour,
+	}
+}
+
+// Start runs fn over the items in the background and returns the id of the
+// task. done, if not nil, is called with the final state once every item has
+// been processed or the tasks are stopped; items left when they are stopped
+// fail as cancelled.
+func (t *Tasks) Start(name string, items []string, fn ItemFunc, done func(Task)) string {
+	task := t.add(name, items)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(t.ctx, task.Id, items, fn, done)
+	}()
+
+	return task.Id
+}
+
+// Run runs fn over the items before it returns, for selections small enough
+// to wait for, and keeps the result like Start does.
+func (t *Tasks) Run(ctx context.Context, name string, items []string, fn ItemFunc, done func(Task)) string {
+	task := t.add(name, items)
+	t.run(ctx, task.Id, items, fn, done)
+	return task.Id
+}
+
+// Get returns a copy of the task.
+func (t *Tasks) Get(id string) (Task, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	task, ok := t.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+
+	copied := *task
+	copied.Results = append([]ItemResult(nil), task.Results...)
+	return copied, true
+}
+
+// List returns every task kept, newest first.
+func (t *Tasks) List() []Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Task, 0, len(t.tasks))
+	for _, task := range t.tasks {
+		copied := *task
+		copied.Results = nil
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Started.After(list[j].Started)
+	})
+	return list
+}
+
+// Stop cancels the running tasks and waits for them to return, or for ctx to
+// be done.
+func (t *Tasks) Stop(ctx context.Context) error {
+	t.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tasks) add(name string, items []string) *Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+	task := &Task{
+		Id:      newTaskId(),
+		Name:    name,
+		Total:   len(items),
+		Results: make([]ItemResult, 0, len(items)),
+		Started: time.Now(),
+	}
+	t.tasks[task.Id] = task
+	return task
+}
+
+// prune drops the tasks that finished longer than keep ago.
+func (t *Tasks) prune() {
+	for id, task := range t.tasks {
+		if !task.Finished.IsZero() && time.Since(task.Finished) > t.keep {
+			delete(t.tasks, id)
+		}
+	}
+}
+
+func (t *Tasks) run(ctx context.Context, id string, items []string, fn ItemFunc, done func(Task)) {
+	for _, item := range items {
+		result := ItemResult{Item: item}
+		if ctx.Err() != nil {
+			result.Error = "cancelled: " + ctx.Err().Error()
+		} else {
+			label, err := runItem(ctx, fn, item)
+			result.Label = label
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+
+		t.mu.Lock()
+		task := t.tasks[id]
+		task.Results = append(task.Results, result)
+		if result.Error != "" {
+			task.Failed++
+		}
+		t.mu.Unlock()
+	}
+
+	// the task is reported running until done has returned, so whatever done
+	// records is there once it shows as finished
+	task, _ := t.Get(id)
+	task.Finished = time.Now()
+	if done != nil {
+		done(task)
+	}
+
+	t.mu.Lock()
+	t.tasks[id].Finished = task.Finished
+	t.mu.Unlock()
+}
+
+// runItem turns a panic into an error like runOnce does, so one bad item does
+// not end the task.
+func runItem(ctx context.Context, fn ItemFunc, item string) (label string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx, item)
+}
+
+func newTaskId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
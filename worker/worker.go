@@ -0,0 +1,155 @@
+// Package worker runs the periodic background jobs of the site and keeps the
+// outcome of their last run for the health checks.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Func does one run of a job. It should return soon after ctx is done.
+type Func func(ctx context.Context) error
+
+// Status is the state of a job as reported by Group.Status.
+type Status struct {
+	Name      string
+	Interval  time.Duration
+	Running   bool
+	Runs      int
+	LastRun   time.Time
+	LastError string
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      Func
+}
+
+// Group runs jobs on their interval until it is stopped.
+type Group struct {
+	mu       sync.Mutex
+	jobs     []job
+	statuses map[string]*Status
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	return &Group{statuses: make(map[string]*Status)}
+}
+
+// Add registers a job. It runs once when the group starts and then every
+// interval. Jobs must be added before Start.
+func (g *Group) Add(name string, interval time.Duration, run Func) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.jobs = append(g.jobs, job{name: name, interval: interval, run: run})
+	g.statuses[name] = &Status{Name: name, Interval: interval}
+}
+
+// Start runs every job in its own goroutine.
+func (g *Group) Start(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ctx, g.cancel = context.WithCancel(ctx)
+	for _, j := range g.jobs {
+		g.statuses[j.name].Running = true
+		g.wg.Add(1)
+		go g.loop(ctx, j)
+	}
+}
+
+// Stop cancels the jobs and waits for them to return, or for ctx to be done.
+func (g *Group) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	cancel := g.cancel
+	g.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the state of every job sorted by name.
+func (g *Group) Status() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	statuses := make([]Status, 0, len(g.statuses))
+	for _, s := range g.statuses {
+		statuses = append(statuses, *s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+func (g *Group) loop(ctx context.Context, j job) {
+	defer g.wg.Done()
+	defer func() {
+		g.mu.Lock()
+		g.statuses[j.name].Running = false
+		g.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		err := runOnce(ctx, j.run)
+		if ctx.Err() != nil {
+			return
+		}
+
+		g.mu.Lock()
+		status := g.statuses[j.name]
+		status.Runs++
+		status.LastRun = time.Now()
+		status.LastError = ""
+		if err != nil {
+			status.LastError = err.Error()
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce turns a panic of the job into an error so one bad run does not take
+// the server down.
+func runOnce(ctx context.Context, run Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run(ctx)
+}